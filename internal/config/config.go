@@ -3,19 +3,39 @@ package config
 import (
 	"github.com/spf13/viper"
 	"log"
+	"time"
 )
 
 type Configuration struct {
-	App    *AppConfig
-	DB     *DBConfig
-	HashId HashIdConfig
-	Stripe *StripeConfig
+	App        *AppConfig
+	DB         *DBConfig
+	HashId     HashIdConfig
+	Stripe     *GatewayConfig
+	StripeTest *GatewayConfig
+	Gateway    string
+	Gateways   map[string]GatewayConfig
+	Sources    []SourceConfig
+	Routing    []RoutingRuleConfig
+	Resilience *ResilienceConfig
+	Risk       []RiskRuleConfig
+	ApiKeys    []ApiKeyConfig
+	Charges    *ChargesConfig
+	Cards      *CardsConfig
+	Events     *EventsConfig
+	Webhooks   *WebhooksConfig
 }
 
 type AppConfig struct {
-	AppName string
-	Env     string
-	Addr    string
+	AppName     string
+	Env         string
+	Addr        string
+	MetricsAddr string
+}
+
+// Livemode reports whether requests that are not signed with an API key run
+// against live gateway credentials. Only the production environment does.
+func (c *AppConfig) Livemode() bool {
+	return c.Env == "production"
 }
 
 type DBConfig struct {
@@ -26,15 +46,170 @@ type DBConfig struct {
 	Name string
 }
 
+// HashIdConfig is the active hashid key. Legacy keys are only used to
+// decode ids issued before the active key was rotated in.
 type HashIdConfig struct {
-	Salt      string
-	Alphabet  string
-	MinLength int
+	Version   int    `mapstructure:"version"`
+	Salt      string `mapstructure:"salt"`
+	Alphabet  string `mapstructure:"alphabet"`
+	MinLength int    `mapstructure:"min-length"`
+	Legacy    []HashIdConfig
+}
+
+// GatewayConfig holds the credentials of one gateway account. Which fields
+// are used depends on the gateway.
+type GatewayConfig struct {
+	PublishableKey string `mapstructure:"pk"`
+	SecretKey      string `mapstructure:"sk"`
+	MerchantId     string `mapstructure:"merchant-id"`
+	URL            string `mapstructure:"url"`
+}
+
+// SourceConfig gives a source its own live and test gateway credentials,
+// used instead of the default ones. Gateway names the gateway new customers
+// of the source are created on.
+type SourceConfig struct {
+	Id         int64                    `mapstructure:"id"`
+	Gateway    string                   `mapstructure:"gateway"`
+	Gateways   map[string]GatewayConfig `mapstructure:"gateways"`
+	Stripe     GatewayConfig            `mapstructure:"stripe"`
+	StripeTest GatewayConfig            `mapstructure:"stripe-test"`
+}
+
+// Credentials returns the default credentials of a gateway in live or test
+// mode, or nil if there are none. Test credentials are keyed "<name>-test".
+func (c *Configuration) Credentials(gateway string, livemode bool) *GatewayConfig {
+	return credentials(c.Gateways, c.Stripe, c.StripeTest, gateway, livemode)
+}
+
+// Credentials returns the source's own credentials of a gateway in live or
+// test mode, or nil if there are none.
+func (c *SourceConfig) Credentials(gateway string, livemode bool) *GatewayConfig {
+	return credentials(c.Gateways, &c.Stripe, &c.StripeTest, gateway, livemode)
+}
+
+// credentials looks a gateway up in gateways, falling back to the stripe and
+// stripe-test keys for Stripe.
+func credentials(gateways map[string]GatewayConfig, stripe, stripeTest *GatewayConfig, gateway string, livemode bool) *GatewayConfig {
+	key := gateway
+	if !livemode {
+		key += "-test"
+	}
+
+	if cfg, ok := gateways[key]; ok && cfg.SecretKey != "" {
+		return &cfg
+	}
+
+	if gateway == "stripe" {
+		cfg := stripe
+		if !livemode {
+			cfg = stripeTest
+		}
+		if cfg != nil && cfg.SecretKey != "" {
+			return cfg
+		}
+	}
+
+	return nil
+}
+
+// RoutingRuleConfig sends the new customers and charges it matches to a
+// gateway. Empty criteria match anything, and amounts are in minor units.
+// Percent routes only that share of matching traffic; 0 routes all of it.
+// Failover names the gateway a charge is retried on when Gateway is
+// unavailable.
+type RoutingRuleConfig struct {
+	Name      string `mapstructure:"name"`
+	SourceId  int64  `mapstructure:"source-id"`
+	Currency  string `mapstructure:"currency"`
+	Brand     string `mapstructure:"brand"`
+	MinAmount int64  `mapstructure:"min-amount"`
+	MaxAmount int64  `mapstructure:"max-amount"`
+	Percent   int    `mapstructure:"percent"`
+	Gateway   string `mapstructure:"gateway"`
+	Failover  string `mapstructure:"failover"`
+}
+
+// RiskRuleConfig is a rule run before every charge. Type is one of
+// max-amount, velocity, new-card, bin, country or account, and decides which
+// of the other fields are used. Action is allow, review or block. SourceId
+// and Currency, if set, limit the rule to charges of that source or currency.
+// Amounts are in minor units.
+type RiskRuleConfig struct {
+	Name      string        `mapstructure:"name"`
+	Type      string        `mapstructure:"type"`
+	Action    string        `mapstructure:"action"`
+	SourceId  int64         `mapstructure:"source-id"`
+	Currency  string        `mapstructure:"currency"`
+	MaxAmount int64         `mapstructure:"max-amount"`
+	MaxCount  int64         `mapstructure:"max-count"`
+	Window    time.Duration `mapstructure:"window"`
+	Scope     string        `mapstructure:"scope"`
+	Bins      []string      `mapstructure:"bins"`
+	Countries []string      `mapstructure:"countries"`
+	Accounts  []int64       `mapstructure:"accounts"`
+}
+
+// ApiKeyConfig is a key clients sign requests with. It is bound to one source
+// and to either live or test mode.
+type ApiKeyConfig struct {
+	Key      string `mapstructure:"key"`
+	SourceId int64  `mapstructure:"source-id"`
+	Livemode bool   `mapstructure:"livemode"`
 }
 
-type StripeConfig struct {
-	PublishableKey string
-	SecretKey      string
+// ResilienceConfig governs every call to a payment gateway. Calls are given
+// up after Timeout, or ChargeTimeout for charges, and retried up to Retries
+// times with jittered exponential backoff from RetryBackoff. After
+// BreakerFailures consecutive failures a gateway account's circuit breaker
+// opens, and calls fail fast for BreakerCooldown.
+type ResilienceConfig struct {
+	Timeout         time.Duration
+	ChargeTimeout   time.Duration
+	Retries         int
+	RetryBackoff    time.Duration
+	BreakerFailures int
+	BreakerCooldown time.Duration
+}
+
+type ChargesConfig struct {
+	RecoveryInterval time.Duration
+	RecoveryAge      time.Duration
+	WatchHeartbeat   time.Duration
+	// ReviewExpiry is how long a charge may be held for review before its
+	// authorization is voided. It must be shorter than the gateways keep
+	// authorizations, which is seven days for most cards.
+	ReviewExpiry   time.Duration
+	ReviewInterval time.Duration
+	// ActionExpiry is how long a charge may wait for the cardholder to
+	// authenticate before charge recovery cancels it. 0 never cancels.
+	ActionExpiry time.Duration
+}
+
+// CardsConfig governs the card expiry worker. Cards expiring within
+// ExpiryWindow are announced with a card.expiring event, and expired primary
+// cards are replaced, every ExpiryInterval. Cards of erased customers that
+// could not be detached at the gateway are retried every DetachInterval.
+type CardsConfig struct {
+	ExpiryWindow   time.Duration
+	ExpiryInterval time.Duration
+	DetachInterval time.Duration
+}
+
+type EventsConfig struct {
+	Sink          string
+	Path          string
+	URL           string
+	RelayInterval time.Duration
+	BatchSize     int
+}
+
+type WebhooksConfig struct {
+	DispatchInterval time.Duration
+	Timeout          time.Duration
+	MaxAttempts      int
+	BackoffBase      time.Duration
+	BackoffMax       time.Duration
 }
 
 func GetConfig(path string) *Configuration {
@@ -51,6 +226,31 @@ func GetConfig(path string) *Configuration {
 
 	config.AutomaticEnv()
 
+	config.SetDefault("gateway", "stripe")
+	config.SetDefault("resilience.timeout", "10s")
+	config.SetDefault("resilience.charge-timeout", "30s")
+	config.SetDefault("resilience.retries", 2)
+	config.SetDefault("resilience.retry-backoff", "200ms")
+	config.SetDefault("resilience.breaker-failures", 5)
+	config.SetDefault("resilience.breaker-cooldown", "30s")
+	config.SetDefault("charges.recovery-interval", "5m")
+	config.SetDefault("charges.recovery-age", "10m")
+	config.SetDefault("charges.watch-heartbeat", "15s")
+	config.SetDefault("charges.review-expiry", "144h")
+	config.SetDefault("charges.review-interval", "10m")
+	config.SetDefault("charges.action-expiry", "24h")
+	config.SetDefault("cards.expiry-window", "720h")
+	config.SetDefault("cards.expiry-interval", "1h")
+	config.SetDefault("cards.detach-interval", "1h")
+	config.SetDefault("events.sink", "stdout")
+	config.SetDefault("events.relay-interval", "5s")
+	config.SetDefault("events.batch-size", 100)
+	config.SetDefault("webhooks.dispatch-interval", "5s")
+	config.SetDefault("webhooks.timeout", "10s")
+	config.SetDefault("webhooks.max-attempts", 8)
+	config.SetDefault("webhooks.backoff-base", "30s")
+	config.SetDefault("webhooks.backoff-max", "6h")
+
 	err := config.ReadInConfig()
 	if err != nil {
 		log.Fatal("Could not load config file: #{err} \n")
@@ -58,9 +258,10 @@ func GetConfig(path string) *Configuration {
 
 	return &Configuration{
 		App: &AppConfig{
-			AppName: config.GetString("app.app-name"),
-			Env:     config.GetString("app.env"),
-			Addr:    config.GetString("server.addr"),
+			AppName:     config.GetString("app.app-name"),
+			Env:         config.GetString("app.env"),
+			Addr:        config.GetString("server.addr"),
+			MetricsAddr: config.GetString("server.metrics-addr"),
 		},
 		DB: &DBConfig{
 			Host: config.GetString("db.host"),
@@ -70,13 +271,126 @@ func GetConfig(path string) *Configuration {
 			Name: config.GetString("db.name"),
 		},
 		HashId: HashIdConfig{
+			Version:   config.GetInt("hashid.version"),
 			Salt:      config.GetString("hashid.salt"),
 			Alphabet:  config.GetString("hashid.alphabet"),
 			MinLength: config.GetInt("hashid.min-length"),
+			Legacy:    getLegacyHashIdConfigs(config),
 		},
-		Stripe: &StripeConfig{
+		Stripe: &GatewayConfig{
 			PublishableKey: config.GetString("stripe.pk"),
 			SecretKey:      config.GetString("stripe.sk"),
 		},
+		StripeTest: &GatewayConfig{
+			PublishableKey: config.GetString("stripe-test.pk"),
+			SecretKey:      config.GetString("stripe-test.sk"),
+		},
+		Gateway:  config.GetString("gateway"),
+		Gateways: getGatewayConfigs(config),
+		Sources:  getSourceConfigs(config),
+		Routing:  getRoutingRuleConfigs(config),
+		Risk:     getRiskRuleConfigs(config),
+		ApiKeys:  getApiKeyConfigs(config),
+		Resilience: &ResilienceConfig{
+			Timeout:         config.GetDuration("resilience.timeout"),
+			ChargeTimeout:   config.GetDuration("resilience.charge-timeout"),
+			Retries:         config.GetInt("resilience.retries"),
+			RetryBackoff:    config.GetDuration("resilience.retry-backoff"),
+			BreakerFailures: config.GetInt("resilience.breaker-failures"),
+			BreakerCooldown: config.GetDuration("resilience.breaker-cooldown"),
+		},
+		Charges: &ChargesConfig{
+			RecoveryInterval: config.GetDuration("charges.recovery-interval"),
+			RecoveryAge:      config.GetDuration("charges.recovery-age"),
+			WatchHeartbeat:   config.GetDuration("charges.watch-heartbeat"),
+			ReviewExpiry:     config.GetDuration("charges.review-expiry"),
+			ReviewInterval:   config.GetDuration("charges.review-interval"),
+			ActionExpiry:     config.GetDuration("charges.action-expiry"),
+		},
+		Cards: &CardsConfig{
+			ExpiryWindow:   config.GetDuration("cards.expiry-window"),
+			ExpiryInterval: config.GetDuration("cards.expiry-interval"),
+			DetachInterval: config.GetDuration("cards.detach-interval"),
+		},
+		Events: &EventsConfig{
+			Sink:          config.GetString("events.sink"),
+			Path:          config.GetString("events.path"),
+			URL:           config.GetString("events.url"),
+			RelayInterval: config.GetDuration("events.relay-interval"),
+			BatchSize:     config.GetInt("events.batch-size"),
+		},
+		Webhooks: &WebhooksConfig{
+			DispatchInterval: config.GetDuration("webhooks.dispatch-interval"),
+			Timeout:          config.GetDuration("webhooks.timeout"),
+			MaxAttempts:      config.GetInt("webhooks.max-attempts"),
+			BackoffBase:      config.GetDuration("webhooks.backoff-base"),
+			BackoffMax:       config.GetDuration("webhooks.backoff-max"),
+		},
+	}
+}
+
+func getLegacyHashIdConfigs(config *viper.Viper) []HashIdConfig {
+	var legacy []HashIdConfig
+
+	err := config.UnmarshalKey("hashid.legacy", &legacy)
+	if err != nil {
+		log.Fatal("Could not load legacy hashid keys: ", err)
 	}
+
+	return legacy
+}
+
+func getSourceConfigs(config *viper.Viper) []SourceConfig {
+	var sources []SourceConfig
+
+	err := config.UnmarshalKey("sources", &sources)
+	if err != nil {
+		log.Fatal("Could not load source configs: ", err)
+	}
+
+	return sources
+}
+
+func getRoutingRuleConfigs(config *viper.Viper) []RoutingRuleConfig {
+	var rules []RoutingRuleConfig
+
+	err := config.UnmarshalKey("routing", &rules)
+	if err != nil {
+		log.Fatal("Could not load routing rules: ", err)
+	}
+
+	return rules
+}
+
+func getRiskRuleConfigs(config *viper.Viper) []RiskRuleConfig {
+	var rules []RiskRuleConfig
+
+	err := config.UnmarshalKey("risk", &rules)
+	if err != nil {
+		log.Fatal("Could not load risk rules: ", err)
+	}
+
+	return rules
+}
+
+func getApiKeyConfigs(config *viper.Viper) []ApiKeyConfig {
+	var keys []ApiKeyConfig
+
+	err := config.UnmarshalKey("api-keys", &keys)
+	if err != nil {
+		log.Fatal("Could not load api keys: ", err)
+	}
+
+	return keys
+}
+
+func getGatewayConfigs(config *viper.Viper) map[string]GatewayConfig {
+	var gateways map[string]GatewayConfig
+
+	err := config.UnmarshalKey("gateways", &gateways)
+	if err != nil {
+		log.Fatal("Could not load gateway configs: ", err)
+	}
+
+	return gateways
 }
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/robertkohut/go-payments/internal/config"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+type livemodeKey struct{}
+
+// authenticator checks the API key a request is signed with and records the
+// key's mode on the request context. With no keys configured every request
+// is accepted and runs in the mode of the environment.
+type authenticator struct {
+	keys     map[string]config.ApiKeyConfig
+	livemode bool
+}
+
+func newAuthenticator(cfg *config.Configuration) *authenticator {
+	a := &authenticator{
+		keys:     make(map[string]config.ApiKeyConfig),
+		livemode: cfg.App.Livemode(),
+	}
+
+	for _, key := range cfg.ApiKeys {
+		a.keys[hashApiKey(key.Key)] = key
+	}
+
+	return a
+}
+
+// Keys are looked up by hash so the lookup does not leak how much of a key
+// matched.
+func hashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *authenticator) authenticate(ctx context.Context) (context.Context, *config.ApiKeyConfig, error) {
+	if len(a.keys) == 0 {
+		return context.WithValue(ctx, livemodeKey{}, a.livemode), nil, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+		return nil, nil, status.Error(codes.Unauthenticated, "missing api key")
+	}
+
+	key, ok := a.keys[hashApiKey(strings.TrimPrefix(values[0], "Bearer "))]
+	if !ok {
+		return nil, nil, status.Error(codes.Unauthenticated, "invalid api key")
+	}
+
+	return context.WithValue(ctx, livemodeKey{}, key.Livemode), &key, nil
+}
+
+// authorize checks that a request only addresses the source its key is bound
+// to.
+func authorize(key *config.ApiKeyConfig, req interface{}) error {
+	if key == nil {
+		return nil
+	}
+
+	var sourceId int64
+	switch r := req.(type) {
+	case interface{ GetSourceId() int64 }:
+		sourceId = r.GetSourceId()
+	case interface{ GetFilter() *pb.CustomerFilter }:
+		sourceId = r.GetFilter().GetSourceId()
+	}
+
+	if sourceId != key.SourceId {
+		return status.Error(codes.PermissionDenied, "api key is not valid for this source")
+	}
+
+	return nil
+}
+
+func (a *authenticator) unaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if isHealthCheck(info.FullMethod) {
+		return handler(ctx, req)
+	}
+
+	ctx, key, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorize(key, req); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (a *authenticator) streamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if isHealthCheck(info.FullMethod) {
+		return handler(srv, ss)
+	}
+
+	ctx, key, err := a.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx, key: key})
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	key *config.ApiKeyConfig
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authenticatedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	return authorize(s.key, m)
+}
+
+// livemode reports whether a request runs against live data.
+func (s *Server) livemode(ctx context.Context) bool {
+	if livemode, ok := ctx.Value(livemodeKey{}).(bool); ok {
+		return livemode
+	}
+
+	return s.config.App.Livemode()
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"github.com/robertkohut/go-payments/internal/config"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestAuthenticateApiKey(t *testing.T) {
+	a := newAuthenticator(&config.Configuration{
+		App: &config.AppConfig{Env: "production"},
+		ApiKeys: []config.ApiKeyConfig{
+			{Key: "key_test", SourceId: 1, Livemode: false},
+		},
+	})
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer key_test"))
+
+	ctx, key, err := a.authenticate(ctx)
+	if err != nil {
+		t.Fatalf("Could not authenticate: %v", err)
+	}
+
+	if livemode, _ := ctx.Value(livemodeKey{}).(bool); livemode {
+		t.Errorf("Expected a test key to run in test mode")
+	}
+
+	if err := authorize(key, &pb.GetCustomerByIdRequest{SourceId: 1}); err != nil {
+		t.Errorf("Expected the key's own source to be allowed, got %v", err)
+	}
+
+	err = authorize(key, &pb.GetCustomerByIdRequest{SourceId: 2})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied for another source, got %v", err)
+	}
+
+	err = authorize(key, &pb.ListCustomersRequest{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied for a listing across sources, got %v", err)
+	}
+}
+
+func TestAuthenticateRejectsUnknownKey(t *testing.T) {
+	a := newAuthenticator(&config.Configuration{
+		App:     &config.AppConfig{},
+		ApiKeys: []config.ApiKeyConfig{{Key: "key_live", SourceId: 1, Livemode: true}},
+	})
+
+	for _, md := range []metadata.MD{nil, metadata.Pairs("authorization", "Bearer nope")} {
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+
+		_, _, err := a.authenticate(ctx)
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Expected Unauthenticated, got %v", err)
+		}
+	}
+}
+
+func TestAuthenticateWithoutKeysUsesEnv(t *testing.T) {
+	a := newAuthenticator(&config.Configuration{App: &config.AppConfig{Env: "production"}})
+
+	ctx, key, err := a.authenticate(context.Background())
+	if err != nil {
+		t.Fatalf("Could not authenticate: %v", err)
+	}
+
+	if livemode, _ := ctx.Value(livemodeKey{}).(bool); !livemode || key != nil {
+		t.Errorf("Expected production to run in live mode without a key")
+	}
+}
+
+func TestHealthChecksSkipAuthentication(t *testing.T) {
+	a := newAuthenticator(&config.Configuration{
+		App:     &config.AppConfig{},
+		ApiKeys: []config.ApiKeyConfig{{Key: "key_live", SourceId: 1, Livemode: true}},
+	})
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+	if _, err := a.unaryInterceptor(context.Background(), nil, info, handler); err != nil {
+		t.Errorf("Expected health checks to need no api key, got %v", err)
+	}
+
+	info = &grpc.UnaryServerInfo{FullMethod: "/payments.PaymentService/GetCustomerById"}
+	_, err := a.unaryInterceptor(context.Background(), &pb.GetCustomerByIdRequest{SourceId: 1}, info, handler)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	pb "github.com/robertkohut/go-payments/proto"
+)
+
+func (s *Server) CreateBlocklistEntry(ctx context.Context, req *pb.CreateBlocklistEntryRequest) (*pb.CreateBlocklistEntryResponse, error) {
+	entry, err := s.svc.BlocklistSvc.CreateEntry(req.GetSourceId(), req.GetEntry())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.CreateBlocklistEntryResponse{
+		Entry: entry,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) ListBlocklistEntries(ctx context.Context, req *pb.ListBlocklistEntriesRequest) (*pb.ListBlocklistEntriesResponse, error) {
+	entries, err := s.svc.BlocklistSvc.ListEntries(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListBlocklistEntriesResponse{
+		Entries: entries,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) UpdateBlocklistEntry(ctx context.Context, req *pb.UpdateBlocklistEntryRequest) (*pb.UpdateBlocklistEntryResponse, error) {
+	entry, err := s.svc.BlocklistSvc.UpdateEntry(req.GetSourceId(), req.GetEntryId(), req.GetEntry(), req.GetUpdateMask().GetPaths())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.UpdateBlocklistEntryResponse{
+		Entry: entry,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) DeleteBlocklistEntry(ctx context.Context, req *pb.DeleteBlocklistEntryRequest) (*pb.DeleteBlocklistEntryResponse, error) {
+	err := s.svc.BlocklistSvc.DeleteEntry(req.GetSourceId(), req.GetEntryId())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.DeleteBlocklistEntryResponse{
+		Success: true,
+	}
+
+	return resp, nil
+}
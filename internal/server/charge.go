@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"github.com/robertkohut/go-payments/pkg/metadata"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+// defaultWatchHeartbeat is used when charges.watch-heartbeat is not positive.
+const defaultWatchHeartbeat = 15 * time.Second
+
+// watchHeartbeat returns how often WatchCharges sends a heartbeat.
+func (s *Server) watchHeartbeat() time.Duration {
+	if s.config.Charges.WatchHeartbeat <= 0 {
+		return defaultWatchHeartbeat
+	}
+
+	return s.config.Charges.WatchHeartbeat
+}
+
+func (s *Server) GetCharge(ctx context.Context, req *pb.GetChargeRequest) (*pb.GetChargeResponse, error) {
+	customer, err := s.svc.CustomerSvc.GetCustomerById(req.GetSourceId(), req.GetAccountId(), s.livemode(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	chargeId, err := s.decodeId(req.GetChargeId(), metadata.HDChargeId, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	charge, err := s.svc.ChargeSvc.GetCustomerCharge(customer, chargeId, req.GetExtId())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.GetChargeResponse{
+		Charge: charge,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) UpdateCharge(ctx context.Context, req *pb.UpdateChargeRequest) (*pb.UpdateChargeResponse, error) {
+	customer, err := s.svc.CustomerSvc.GetCustomerById(req.GetSourceId(), req.GetAccountId(), s.livemode(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetChargeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "charge id is required")
+	}
+
+	chargeId, err := s.decodeId(req.GetChargeId(), metadata.HDChargeId, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	charge, err := s.svc.ChargeSvc.GetCustomerCharge(customer, chargeId, "")
+	if err != nil {
+		return nil, err
+	}
+
+	charge, err = s.svc.ChargeSvc.UpdateChargeDetails(charge, req.GetCharge(), req.GetUpdateMask().GetPaths())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.UpdateChargeResponse{
+		Charge: charge,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) WatchCharges(req *pb.WatchChargesRequest, stream pb.PaymentService_WatchChargesServer) error {
+	customer, err := s.svc.CustomerSvc.GetCustomerById(req.GetSourceId(), req.GetAccountId(), s.livemode(stream.Context()))
+	if err != nil {
+		return err
+	}
+
+	chargeId, err := s.decodeId(req.GetChargeId(), metadata.HDChargeId, 0)
+	if err != nil {
+		return err
+	}
+
+	// Subscribe before reading the current state so no update is missed in
+	// between. A charge may be sent twice; clients should keep the latest.
+	sub, cancel := s.svc.ChargeSvc.WatchCharges(customer)
+	defer cancel()
+
+	var since time.Time
+	if req.GetSince() != nil {
+		since = req.GetSince().AsTime()
+	}
+
+	charges, err := s.svc.ChargeSvc.GetUpdatedCharges(customer, chargeId, since)
+	if err != nil {
+		return err
+	}
+
+	for _, charge := range charges {
+		if err := stream.Send(&pb.WatchChargesResponse{Event: &pb.WatchChargesResponse_Charge{Charge: charge}}); err != nil {
+			return err
+		}
+	}
+
+	heartbeat := time.NewTicker(s.watchHeartbeat())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case charge, ok := <-sub.C:
+			if !ok {
+				if sub.Lagged() {
+					return status.Error(codes.Aborted, "watcher fell behind, resume with since")
+				}
+				return nil
+			}
+
+			if chargeId != 0 && charge.GetId() != chargeId {
+				continue
+			}
+
+			if err := stream.Send(&pb.WatchChargesResponse{Event: &pb.WatchChargesResponse_Charge{Charge: charge}}); err != nil {
+				return err
+			}
+		case t := <-heartbeat.C:
+			hb := &pb.Heartbeat{Time: timestamppb.New(t)}
+			if err := stream.Send(&pb.WatchChargesResponse{Event: &pb.WatchChargesResponse_Heartbeat{Heartbeat: hb}}); err != nil {
+				return err
+			}
+		}
+	}
+}
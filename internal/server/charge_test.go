@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"github.com/robertkohut/go-payments/internal/config"
+	"github.com/robertkohut/go-payments/internal/services"
+	"github.com/robertkohut/go-payments/pkg/charges"
+	"github.com/robertkohut/go-payments/pkg/customers"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"testing"
+	"time"
+)
+
+// oneCustomer returns customer 1 for any account.
+type oneCustomer struct {
+	customers.Service
+}
+
+func (oneCustomer) GetCustomerById(sourceId, accountId int64, livemode bool) (*pb.Customer, error) {
+	return &pb.Customer{Id: 1, SourceId: sourceId, AccountId: accountId}, nil
+}
+
+// watchedCharges serves the charges updated since a time from a list and
+// subscribes through a real hub.
+type watchedCharges struct {
+	charges.Service
+	hub     *charges.Hub
+	charges []*pb.Charge
+	since   time.Time
+}
+
+func (c *watchedCharges) GetUpdatedCharges(customer *pb.Customer, chargeId int64, since time.Time) ([]*pb.Charge, error) {
+	c.since = since
+	return c.charges, nil
+}
+
+func (c *watchedCharges) WatchCharges(customer *pb.Customer) (*charges.Subscription, func()) {
+	return c.hub.Subscribe(customer.GetId())
+}
+
+// watchStream collects what WatchCharges sends. Send blocks while hold is
+// set and not closed.
+type watchStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *pb.WatchChargesResponse
+	hold chan struct{}
+}
+
+func (s *watchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *watchStream) Send(resp *pb.WatchChargesResponse) error {
+	if s.hold != nil {
+		<-s.hold
+	}
+	s.sent <- resp
+	return nil
+}
+
+func newWatchServer(heartbeat time.Duration, svc *watchedCharges) *Server {
+	return &Server{
+		config: &config.Configuration{
+			App:     &config.AppConfig{},
+			Charges: &config.ChargesConfig{WatchHeartbeat: heartbeat},
+		},
+		svc: &services.Services{CustomerSvc: oneCustomer{}, ChargeSvc: svc},
+	}
+}
+
+func TestWatchChargesSince(t *testing.T) {
+	svc := &watchedCharges{hub: charges.NewHub(), charges: []*pb.Charge{{Id: 5, CustomerId: 1}}}
+	s := newWatchServer(time.Hour, svc)
+
+	since := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &watchStream{ctx: ctx, sent: make(chan *pb.WatchChargesResponse, 10)}
+
+	done := make(chan error)
+	go func() {
+		done <- s.WatchCharges(&pb.WatchChargesRequest{SourceId: 1, AccountId: 2, Since: timestamppb.New(since)}, stream)
+	}()
+
+	if resp := <-stream.sent; resp.GetCharge().GetId() != 5 {
+		t.Errorf("Expected the updated charge 5 first, got %v", resp)
+	}
+
+	svc.hub.Publish(&pb.Charge{Id: 6, CustomerId: 1})
+
+	if resp := <-stream.sent; resp.GetCharge().GetId() != 6 {
+		t.Errorf("Expected the published charge 6, got %v", resp)
+	}
+
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Errorf("Expected the watch to end cleanly, got %v", err)
+	}
+
+	if !svc.since.Equal(since) {
+		t.Errorf("Expected charges since %v, got %v", since, svc.since)
+	}
+
+	// Without since, all charges are read.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	stream = &watchStream{ctx: ctx, sent: make(chan *pb.WatchChargesResponse, 10)}
+	if err := s.WatchCharges(&pb.WatchChargesRequest{SourceId: 1, AccountId: 2}, stream); err != nil {
+		t.Fatalf("Could not watch charges: %v", err)
+	}
+
+	if !svc.since.IsZero() {
+		t.Errorf("Expected a zero since without a filter, got %v", svc.since)
+	}
+}
+
+func TestWatchChargesHeartbeat(t *testing.T) {
+	for _, heartbeat := range []time.Duration{0, -time.Second} {
+		if got := newWatchServer(heartbeat, nil).watchHeartbeat(); got != defaultWatchHeartbeat {
+			t.Errorf("Expected the default heartbeat for %v, got %v", heartbeat, got)
+		}
+	}
+
+	s := newWatchServer(time.Millisecond, &watchedCharges{hub: charges.NewHub()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := &watchStream{ctx: ctx, sent: make(chan *pb.WatchChargesResponse, 10)}
+	go s.WatchCharges(&pb.WatchChargesRequest{SourceId: 1, AccountId: 2}, stream)
+
+	select {
+	case resp := <-stream.sent:
+		if resp.GetHeartbeat() == nil {
+			t.Errorf("Expected a heartbeat, got %v", resp)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected a heartbeat within a second")
+	}
+}
+
+func TestWatchChargesSlowSubscriber(t *testing.T) {
+	svc := &watchedCharges{hub: charges.NewHub()}
+	s := newWatchServer(time.Hour, svc)
+
+	stream := &watchStream{ctx: context.Background(), sent: make(chan *pb.WatchChargesResponse, 100), hold: make(chan struct{})}
+
+	done := make(chan error)
+	go func() {
+		done <- s.WatchCharges(&pb.WatchChargesRequest{SourceId: 1, AccountId: 2}, stream)
+	}()
+
+	// The first charge is taken off the subscription and stuck in Send, the
+	// rest overflow its buffer.
+	for i := 0; i < 100; i++ {
+		svc.hub.Publish(&pb.Charge{Id: int64(i), CustomerId: 1})
+		time.Sleep(time.Millisecond)
+	}
+
+	close(stream.hold)
+
+	select {
+	case err := <-done:
+		if status.Code(err) != codes.Aborted {
+			t.Errorf("Expected Aborted for a watcher that fell behind, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the watch to end once it fell behind")
+	}
+}
@@ -2,16 +2,56 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/robertkohut/go-payments/pkg/metadata"
 	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"log"
 )
 
+// findCustomer looks a customer up by its id_str when one is given, and by
+// source and account otherwise.
+func (s *Server) findCustomer(ctx context.Context, sourceId, accountId int64, customerIdStr string) (*pb.Customer, error) {
+	livemode := s.livemode(ctx)
+
+	customerId, err := s.decodeId(customerIdStr, metadata.HDCustomerId, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if customerId != 0 {
+		return s.svc.CustomerSvc.GetCustomer(sourceId, customerId, livemode)
+	}
+
+	return s.svc.CustomerSvc.GetCustomerById(sourceId, accountId, livemode)
+}
+
 func (s *Server) CreateCustomer(ctx context.Context, req *pb.CreateCustomerRequest) (*pb.CreateCustomerResponse, error) {
 	customer := &pb.Customer{
 		SourceId:  req.GetSourceId(),
 		AccountId: req.GetAccountId(),
 		Name:      req.GetName(),
+		Email:     req.GetEmail(),
+		Phone:     req.GetPhone(),
+		Address:   req.GetAddress(),
+		Metadata:  req.GetMetadata(),
+		Livemode:  s.livemode(ctx),
+	}
+
+	var org *pb.Organization
+	if req.GetOrgId() != 0 {
+		if req.GetAccountId() == 0 {
+			return nil, status.Error(codes.InvalidArgument, "account id is required to join an organization")
+		}
+
+		var err error
+		org, err = s.svc.OrganizationSvc.GetOrganization(req.GetSourceId(), req.GetOrgId(), s.livemode(ctx))
+		if err != nil {
+			return nil, err
+		}
+		customer.OrgId = org.OrgId
 	}
 
 	extId, err := s.svc.CustomerSvc.AddCustomer(customer)
@@ -19,8 +59,21 @@ func (s *Server) CreateCustomer(ctx context.Context, req *pb.CreateCustomerReque
 		return nil, err
 	}
 
+	// Unlinked, the customer would not be billed as part of the organization,
+	// so it is erased again.
+	if org != nil {
+		_, err = s.svc.OrganizationSvc.LinkAccount(org, customer.AccountId)
+		if err != nil {
+			if eraseErr := s.svc.CustomerSvc.EraseCustomer(customer); eraseErr != nil {
+				log.Println("Could not erase unlinked customer", customer.Id, eraseErr)
+			}
+			return nil, err
+		}
+	}
+
 	resp := &pb.CreateCustomerResponse{
 		Customer: &pb.Customer{
+			IdStr: customer.IdStr,
 			ExtId: *extId,
 		},
 	}
@@ -32,7 +85,7 @@ func (s *Server) GetCustomerById(ctx context.Context, req *pb.GetCustomerByIdReq
 	sourceId := req.GetSourceId()
 	accountId := req.GetAccountId()
 
-	c, err := s.svc.CustomerSvc.GetCustomerById(sourceId, accountId)
+	c, err := s.findCustomer(ctx, sourceId, accountId, req.GetCustomerId())
 	if err != nil {
 		return nil, err
 	}
@@ -52,12 +105,111 @@ func (s *Server) GetCustomerById(ctx context.Context, req *pb.GetCustomerByIdReq
 	return resp, nil
 }
 
+func (s *Server) UpdateCustomer(ctx context.Context, req *pb.UpdateCustomerRequest) (*pb.UpdateCustomerResponse, error) {
+	customer, err := s.findCustomer(ctx, req.GetSourceId(), req.GetAccountId(), req.GetCustomerId())
+	if err != nil {
+		return nil, err
+	}
+
+	customer, err = s.svc.CustomerSvc.UpdateCustomer(customer, req.GetCustomer(), req.GetUpdateMask().GetPaths())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.UpdateCustomerResponse{
+		Customer: customer,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) DeleteCustomer(ctx context.Context, req *pb.DeleteCustomerRequest) (*pb.DeleteCustomerResponse, error) {
+	switch req.GetMode() {
+	case pb.DeleteCustomerMode_DELETE_CUSTOMER_MODE_UNSPECIFIED, pb.DeleteCustomerMode_DELETE_CUSTOMER_MODE_DEACTIVATE:
+		customer, err := s.findCustomer(ctx, req.GetSourceId(), req.GetAccountId(), req.GetCustomerId())
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.svc.CustomerSvc.DeleteCustomer(customer)
+		if err != nil {
+			return nil, err
+		}
+	case pb.DeleteCustomerMode_DELETE_CUSTOMER_MODE_ERASE:
+		// A customer is often deactivated first and erased later, so erasing
+		// also finds deactivated customers.
+		customerId, err := s.decodeId(req.GetCustomerId(), metadata.HDCustomerId, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		customer, err := s.svc.CustomerSvc.GetErasableCustomer(req.GetSourceId(), req.GetAccountId(), customerId, s.livemode(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.svc.CustomerSvc.EraseCustomer(customer)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, status.Error(codes.InvalidArgument, "unknown delete mode")
+	}
+
+	resp := &pb.DeleteCustomerResponse{
+		Success: true,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) RestoreCustomer(ctx context.Context, req *pb.RestoreCustomerRequest) (*pb.RestoreCustomerResponse, error) {
+	customer, err := s.svc.CustomerSvc.RestoreCustomer(req.GetSourceId(), req.GetAccountId(), s.livemode(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.RestoreCustomerResponse{
+		Customer: customer,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) ListCustomers(ctx context.Context, req *pb.ListCustomersRequest) (*pb.ListCustomersResponse, error) {
+	customers, total, err := s.svc.CustomerSvc.ListCustomers(req.GetFilter(), s.livemode(ctx), req.GetLimit(), req.GetOffset())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListCustomersResponse{
+		Customers: customers,
+		Total:     total,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) SearchCustomers(ctx context.Context, req *pb.SearchCustomersRequest) (*pb.SearchCustomersResponse, error) {
+	customers, total, err := s.svc.CustomerSvc.SearchCustomers(req.GetFilter(), s.livemode(ctx), req.GetEmail(), req.GetName(), req.GetLimit(), req.GetOffset())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.SearchCustomersResponse{
+		Customers: customers,
+		Total:     total,
+	}
+
+	return resp, nil
+}
+
 func (s *Server) AddCustomerPaymentMethod(ctx context.Context, req *pb.AddCustomerPaymentMethodRequest) (*pb.AddCustomerPaymentMethodResponse, error) {
 	sourceId := req.GetSourceId()
 	accountId := req.GetAccountId()
 	card := req.GetCard()
 
-	customer, err := s.svc.CustomerSvc.GetCustomerById(sourceId, accountId)
+	customer, err := s.findCustomer(ctx, sourceId, accountId, req.GetCustomerId())
 	if err != nil {
 		return nil, err
 	}
@@ -69,13 +221,6 @@ func (s *Server) AddCustomerPaymentMethod(ctx context.Context, req *pb.AddCustom
 		return nil, err
 	}
 
-	if len(customer.Cards) == 0 {
-		err = s.svc.CustomerSvc.SetCustomerPrimaryPaymentMethod(customer, c)
-		if err != nil {
-			log.Println("Customer -> AddCustomerPaymentMethod():", err)
-		}
-	}
-
 	log.Println("AddCustomerPaymentMethod", c)
 
 	resp := &pb.AddCustomerPaymentMethodResponse{
@@ -86,12 +231,54 @@ func (s *Server) AddCustomerPaymentMethod(ctx context.Context, req *pb.AddCustom
 	return resp, nil
 }
 
+func (s *Server) CreateSetupIntent(ctx context.Context, req *pb.CreateSetupIntentRequest) (*pb.CreateSetupIntentResponse, error) {
+	customer, err := s.findCustomer(ctx, req.GetSourceId(), req.GetAccountId(), req.GetCustomerId())
+	if err != nil {
+		return nil, err
+	}
+
+	setup, err := s.svc.CustomerSvc.CreateSetupIntent(customer)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.CreateSetupIntentResponse{
+		SetupIntent: setup,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) CompleteSetupIntent(ctx context.Context, req *pb.CompleteSetupIntentRequest) (*pb.CompleteSetupIntentResponse, error) {
+	customer, err := s.findCustomer(ctx, req.GetSourceId(), req.GetAccountId(), req.GetCustomerId())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("CompleteSetupIntent", req.GetSourceId(), req.GetAccountId(), req.GetSetupIntentId())
+
+	setup, err := s.svc.CustomerSvc.CompleteSetupIntent(customer, req.GetSetupIntentId())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.CompleteSetupIntentResponse{
+		SetupIntent: setup,
+	}
+
+	return resp, nil
+}
+
 func (s *Server) RemoveCustomerPaymentMethod(ctx context.Context, req *pb.RemoveCustomerPaymentMethodRequest) (*pb.RemoveCustomerPaymentMethodResponse, error) {
 	sourceId := req.GetSourceId()
 	accountId := req.GetAccountId()
-	cardId := req.GetCardId()
 
-	customer, err := s.svc.CustomerSvc.GetCustomerById(sourceId, accountId)
+	cardId, err := s.decodeId(req.GetCardIdStr(), metadata.HDCardId, req.GetCardId())
+	if err != nil {
+		return nil, err
+	}
+
+	customer, err := s.findCustomer(ctx, sourceId, accountId, req.GetCustomerId())
 	if err != nil {
 		return nil, err
 	}
@@ -116,9 +303,13 @@ func (s *Server) RemoveCustomerPaymentMethod(ctx context.Context, req *pb.Remove
 func (s *Server) SetCustomerPrimaryPaymentMethod(ctx context.Context, req *pb.SetCustomerPrimaryPaymentMethodRequest) (*pb.SetCustomerPrimaryPaymentMethodResponse, error) {
 	sourceId := req.GetSourceId()
 	accountId := req.GetAccountId()
-	cardId := req.GetCardId()
 
-	customer, err := s.svc.CustomerSvc.GetCustomerById(sourceId, accountId)
+	cardId, err := s.decodeId(req.GetCardIdStr(), metadata.HDCardId, req.GetCardId())
+	if err != nil {
+		return nil, err
+	}
+
+	customer, err := s.findCustomer(ctx, sourceId, accountId, req.GetCustomerId())
 	if err != nil {
 		return nil, err
 	}
@@ -140,12 +331,25 @@ func (s *Server) SetCustomerPrimaryPaymentMethod(ctx context.Context, req *pb.Se
 	return resp, nil
 }
 
+func (s *Server) ListExpiringCards(ctx context.Context, req *pb.ListExpiringCardsRequest) (*pb.ListExpiringCardsResponse, error) {
+	cards, err := s.svc.CustomerSvc.ListExpiringCards(req.GetSourceId(), s.livemode(ctx), req.GetDays(), req.GetIncludeExpired(), req.GetLimit(), req.GetOffset())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListExpiringCardsResponse{
+		Cards: cards,
+	}
+
+	return resp, nil
+}
+
 func (s *Server) RetrieveCustomerCharges(ctx context.Context, req *pb.RetrieveCustomerChargesRequest) (*pb.RetrieveCustomerChargesResponse, error) {
 	sourceId := req.GetSourceId()
 	accountId := req.GetAccountId()
 	filters := req.GetFilters()
 
-	customer, err := s.svc.CustomerSvc.GetCustomerById(sourceId, accountId)
+	customer, err := s.svc.CustomerSvc.GetCustomerById(sourceId, accountId, s.livemode(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -162,13 +366,13 @@ func (s *Server) RetrieveCustomerCharges(ctx context.Context, req *pb.RetrieveCu
 	return resp, nil
 }
 
+var errInvalidInput = errors.New("invalid input")
+
 func (s *Server) CreateCharge(ctx context.Context, req *pb.CreateChargeRequest) (*pb.CreateChargeResponse, error) {
 	const (
-		errInvalidInput      = "invalid input"
 		errSourceIDRequired  = "source id is required"
 		errAccountIDRequired = "account id is required"
 		errCurrencyRequired  = "currency is required"
-		errNoPrimaryCardSet  = "no primary card set"
 	)
 
 	if req.GetSourceId() == 0 {
@@ -184,28 +388,35 @@ func (s *Server) CreateCharge(ctx context.Context, req *pb.CreateChargeRequest)
 	}
 
 	charge := req.GetCharge()
-	cardId := charge.GetPmId()
 
-	customer, err := s.svc.CustomerSvc.GetCustomerById(req.GetSourceId(), req.GetAccountId())
+	cardId, err := s.decodeId(charge.GetPmIdStr(), metadata.HDCardId, charge.GetPmId())
 	if err != nil {
 		return nil, err
 	}
 
-	// A default card was not set. Use the primary card
-	if cardId == 0 {
-		cardId = customer.GetPrimaryCardId()
+	customer, err := s.chargedCustomer(ctx, req)
+	if err != nil {
+		return nil, err
+	}
 
-		// TODO: No primary card was set. Use the first card
-		if cardId == 0 {
-			return nil, fmt.Errorf("%w: %s", errInvalidInput, errNoPrimaryCardSet)
-		}
+	// Charge the primary card unless a card was given.
+	var card *pb.Card
+	if cardId == 0 {
+		card, err = s.svc.CustomerSvc.GetPrimaryPaymentMethod(customer)
+	} else {
+		card, err = s.svc.CustomerSvc.GetCustomerPaymentMethod(customer, cardId)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	card, err := s.svc.CustomerSvc.GetCustomerPaymentMethod(customer, cardId)
+	err = s.svc.CustomerSvc.LoadCardCredentials(customer, card)
 	if err != nil {
 		return nil, err
 	}
 
+	charge.AccountId = req.GetAccountId()
+
 	charge, err = s.svc.ChargeSvc.ChargeCustomerPaymentMethod(customer, card, charge)
 	if err != nil {
 		return nil, err
@@ -217,3 +428,22 @@ func (s *Server) CreateCharge(ctx context.Context, req *pb.CreateChargeRequest)
 
 	return resp, nil
 }
+
+// chargedCustomer returns the customer a charge request is billed to: the
+// account's own customer, or its organization's billing customer when
+// bill_org is set.
+func (s *Server) chargedCustomer(ctx context.Context, req *pb.CreateChargeRequest) (*pb.Customer, error) {
+	if !req.GetBillOrg() {
+		return s.svc.CustomerSvc.GetCustomerById(req.GetSourceId(), req.GetAccountId(), s.livemode(ctx))
+	}
+
+	org, err := s.svc.OrganizationSvc.GetAccountOrganization(req.GetSourceId(), req.GetAccountId(), s.livemode(ctx))
+	if status.Code(err) == codes.NotFound {
+		return nil, status.Error(codes.FailedPrecondition, "account is not linked to an organization")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return org.GetCustomer(), nil
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"github.com/robertkohut/go-payments/internal/config"
+	"github.com/robertkohut/go-payments/internal/services"
+	"github.com/robertkohut/go-payments/pkg/customers"
+	"github.com/robertkohut/go-payments/pkg/organizations"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+// createdCustomers records created and erased customers.
+type createdCustomers struct {
+	customers.Service
+	created []*pb.Customer
+	erased  []*pb.Customer
+}
+
+func (c *createdCustomers) AddCustomer(customer *pb.Customer) (*string, error) {
+	customer.Id = int64(len(c.created) + 1)
+	extId := "cus_1"
+	c.created = append(c.created, customer)
+	return &extId, nil
+}
+
+func (c *createdCustomers) EraseCustomer(customer *pb.Customer) error {
+	c.erased = append(c.erased, customer)
+	return nil
+}
+
+// linkingOrganizations finds organization 7 and links accounts unless
+// linkErr is set.
+type linkingOrganizations struct {
+	organizations.Service
+	linkErr error
+}
+
+func (o *linkingOrganizations) GetOrganization(sourceId, orgId int64, livemode bool) (*pb.Organization, error) {
+	if orgId != 7 {
+		return nil, status.Error(codes.NotFound, "organization not found")
+	}
+	return &pb.Organization{Id: 1, SourceId: sourceId, OrgId: orgId}, nil
+}
+
+func (o *linkingOrganizations) LinkAccount(org *pb.Organization, accountId int64) (*pb.Organization, error) {
+	return org, o.linkErr
+}
+
+func TestCreateCustomerErasesUnlinkedCustomer(t *testing.T) {
+	customerSvc := &createdCustomers{}
+	orgSvc := &linkingOrganizations{linkErr: status.Error(codes.FailedPrecondition, "account is linked to another organization")}
+
+	s := &Server{
+		config: &config.Configuration{App: &config.AppConfig{}},
+		svc:    &services.Services{CustomerSvc: customerSvc, OrganizationSvc: orgSvc},
+	}
+
+	req := &pb.CreateCustomerRequest{SourceId: 1, AccountId: 3, OrgId: 7}
+
+	if _, err := s.CreateCustomer(context.Background(), req); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Expected the link error, got %v", err)
+	}
+
+	if len(customerSvc.created) != 1 || len(customerSvc.erased) != 1 || customerSvc.erased[0] != customerSvc.created[0] {
+		t.Errorf("Expected the unlinked customer to be erased, created %v, erased %v", customerSvc.created, customerSvc.erased)
+	}
+
+	orgSvc.linkErr = nil
+
+	if _, err := s.CreateCustomer(context.Background(), req); err != nil {
+		t.Fatalf("Could not create customer: %v", err)
+	}
+
+	if len(customerSvc.created) != 2 || len(customerSvc.erased) != 1 {
+		t.Errorf("Expected a linked customer to be kept, created %d, erased %d", len(customerSvc.created), len(customerSvc.erased))
+	}
+}
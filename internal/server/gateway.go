@@ -6,7 +6,7 @@ import (
 )
 
 func (s *Server) GetPublishableKey(ctx context.Context, req *pb.GetPublishableKeyRequest) (*pb.GetPublishableKeyResponse, error) {
-	key, err := s.svc.CustomerSvc.GetPublishableKey()
+	key, err := s.svc.CustomerSvc.GetPublishableKey(req.GetSourceId(), s.livemode(ctx))
 	if err != nil {
 		return nil, err
 	}
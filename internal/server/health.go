@@ -0,0 +1,42 @@
+package server
+
+import (
+	"github.com/robertkohut/go-payments/pkg/payments"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"strings"
+	"time"
+)
+
+const healthInterval = time.Second
+
+// registerHealth serves the standard gRPC health service. The server itself
+// is always serving; each gateway account is reported as the service
+// "gateway/<gateway>/<account>/<mode>", which is not serving while its
+// circuit breaker is open.
+func (s *Server) registerHealth(server *grpc.Server) {
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(server, hs)
+
+	go runEvery("gateway-health", healthInterval, func() error {
+		for _, b := range s.svc.Gateways.Breakers() {
+			hs.SetServingStatus("gateway/"+b.Name(), breakerHealth(b.State()))
+		}
+		return nil
+	})
+}
+
+func breakerHealth(state payments.BreakerState) healthpb.HealthCheckResponse_ServingStatus {
+	if state == payments.BreakerOpen {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	return healthpb.HealthCheckResponse_SERVING
+}
+
+// isHealthCheck reports whether a method belongs to the health service,
+// which load balancers call without an API key.
+func isHealthCheck(method string) bool {
+	return strings.HasPrefix(method, "/grpc.health.v1.Health/")
+}
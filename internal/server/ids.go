@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"github.com/robertkohut/go-payments/pkg/metadata"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// decodeId returns the internal id encoded in idStr, checking it carries the
+// expected metadata.HD* type tag. Requests that still send the raw internal
+// id are supported by passing it as fallback, used when idStr is empty.
+func (s *Server) decodeId(idStr string, tag int64, fallback int64) (int64, error) {
+	if idStr == "" {
+		return fallback, nil
+	}
+
+	id, err := s.svc.HashId.DecodeId(idStr, tag)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid id %q", idStr)
+	}
+
+	return id, nil
+}
+
+// hideIdsInterceptor strips internal ids from responses, leaving only their
+// hashids. Responses are copied first, as they may share messages with the
+// services.
+func hideIdsInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if msg, ok := resp.(proto.Message); ok && err == nil {
+		return metadata.HideInternalIds(msg), nil
+	}
+	return resp, err
+}
+
+func hideIdsStreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	return handler(srv, &hiddenIdsStream{ss})
+}
+
+type hiddenIdsStream struct {
+	grpc.ServerStream
+}
+
+func (s *hiddenIdsStream) SendMsg(m interface{}) error {
+	if msg, ok := m.(proto.Message); ok {
+		m = metadata.HideInternalIds(msg)
+	}
+	return s.ServerStream.SendMsg(m)
+}
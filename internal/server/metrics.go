@@ -0,0 +1,24 @@
+package server
+
+import (
+	_ "expvar"
+	"log"
+	"net/http"
+)
+
+// startMetrics serves the expvar metrics on /debug/vars of the metrics
+// address, if one is configured.
+func (s *Server) startMetrics() {
+	if s.config.App.MetricsAddr == "" {
+		return
+	}
+
+	go func() {
+		log.Println("Serving metrics on", s.config.App.MetricsAddr)
+
+		err := http.ListenAndServe(s.config.App.MetricsAddr, nil)
+		if err != nil {
+			log.Println("Metrics server stopped:", err)
+		}
+	}()
+}
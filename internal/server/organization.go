@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	pb "github.com/robertkohut/go-payments/proto"
+)
+
+func (s *Server) CreateOrganization(ctx context.Context, req *pb.CreateOrganizationRequest) (*pb.CreateOrganizationResponse, error) {
+	org := &pb.Organization{
+		SourceId: req.GetSourceId(),
+		OrgId:    req.GetOrgId(),
+		Name:     req.GetName(),
+		Livemode: s.livemode(ctx),
+		Customer: &pb.Customer{
+			Name:     req.GetName(),
+			Email:    req.GetEmail(),
+			Phone:    req.GetPhone(),
+			Address:  req.GetAddress(),
+			Metadata: req.GetMetadata(),
+		},
+	}
+
+	org, err := s.svc.OrganizationSvc.CreateOrganization(org)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.CreateOrganizationResponse{
+		Organization: org,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) GetOrganization(ctx context.Context, req *pb.GetOrganizationRequest) (*pb.GetOrganizationResponse, error) {
+	org, err := s.svc.OrganizationSvc.GetOrganization(req.GetSourceId(), req.GetOrgId(), s.livemode(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.GetOrganizationResponse{
+		Organization: org,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) LinkOrganizationAccount(ctx context.Context, req *pb.LinkOrganizationAccountRequest) (*pb.LinkOrganizationAccountResponse, error) {
+	org, err := s.svc.OrganizationSvc.GetOrganization(req.GetSourceId(), req.GetOrgId(), s.livemode(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	org, err = s.svc.OrganizationSvc.LinkAccount(org, req.GetAccountId())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.LinkOrganizationAccountResponse{
+		Organization: org,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) UnlinkOrganizationAccount(ctx context.Context, req *pb.UnlinkOrganizationAccountRequest) (*pb.UnlinkOrganizationAccountResponse, error) {
+	org, err := s.svc.OrganizationSvc.GetOrganization(req.GetSourceId(), req.GetOrgId(), s.livemode(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	org, err = s.svc.OrganizationSvc.UnlinkAccount(org, req.GetAccountId())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.UnlinkOrganizationAccountResponse{
+		Organization: org,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) ListOrganizationCharges(ctx context.Context, req *pb.ListOrganizationChargesRequest) (*pb.ListOrganizationChargesResponse, error) {
+	org, err := s.svc.OrganizationSvc.GetOrganization(req.GetSourceId(), req.GetOrgId(), s.livemode(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	charges, err := s.svc.ChargeSvc.GetOrganizationCharges(org, req.GetLimit(), req.GetOffset())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListOrganizationChargesResponse{
+		Charges: charges,
+	}
+
+	return resp, nil
+}
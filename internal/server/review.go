@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"github.com/robertkohut/go-payments/pkg/metadata"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) ListReviews(ctx context.Context, req *pb.ListReviewsRequest) (*pb.ListReviewsResponse, error) {
+	charges, err := s.svc.ChargeSvc.ListReviews(req.GetSourceId(), s.livemode(ctx), req.GetStatus(), req.GetLimit(), req.GetOffset())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListReviewsResponse{
+		Charges: charges,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) ApproveReview(ctx context.Context, req *pb.ApproveReviewRequest) (*pb.ApproveReviewResponse, error) {
+	chargeId, err := s.decodeReviewChargeId(req.GetChargeId())
+	if err != nil {
+		return nil, err
+	}
+
+	charge, err := s.svc.ChargeSvc.ApproveReview(req.GetSourceId(), s.livemode(ctx), chargeId, req.GetReviewer(), req.GetNotes())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ApproveReviewResponse{
+		Charge: charge,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) RejectReview(ctx context.Context, req *pb.RejectReviewRequest) (*pb.RejectReviewResponse, error) {
+	chargeId, err := s.decodeReviewChargeId(req.GetChargeId())
+	if err != nil {
+		return nil, err
+	}
+
+	charge, err := s.svc.ChargeSvc.RejectReview(req.GetSourceId(), s.livemode(ctx), chargeId, req.GetReviewer(), req.GetNotes())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.RejectReviewResponse{
+		Charge: charge,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) decodeReviewChargeId(idStr string) (int64, error) {
+	if idStr == "" {
+		return 0, status.Error(codes.InvalidArgument, "charge id is required")
+	}
+
+	return s.decodeId(idStr, metadata.HDChargeId, 0)
+}
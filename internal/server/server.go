@@ -3,9 +3,15 @@ package server
 import (
 	"context"
 	"github.com/robertkohut/go-payments/internal/services/hashid"
+	"github.com/robertkohut/go-payments/pkg/blocklist"
 	"github.com/robertkohut/go-payments/pkg/charges"
 	"github.com/robertkohut/go-payments/pkg/customers"
+	"github.com/robertkohut/go-payments/pkg/events"
+	"github.com/robertkohut/go-payments/pkg/organizations"
 	"github.com/robertkohut/go-payments/pkg/payments"
+	"github.com/robertkohut/go-payments/pkg/risk"
+	"github.com/robertkohut/go-payments/pkg/routing"
+	"github.com/robertkohut/go-payments/pkg/webhooks"
 	"google.golang.org/grpc/status"
 	"log"
 	"net"
@@ -30,19 +36,53 @@ func NewServer(cfg *config.Configuration) *Server {
 		log.Panic("Unable to connect to database")
 	}
 
-	hashIdService, _ := hashid.New(&cfg.HashId)
+	hashIdService, err := hashid.New(&cfg.HashId)
+	if err != nil {
+		log.Panic("Unable to create hashid service: ", err)
+	}
+
+	gateways, err := payments.NewRegistry(cfg)
+	if err != nil {
+		log.Panic("Unable to create payment gateways: ", err)
+	}
+
+	router, err := routing.NewEngine(cfg.Routing)
+	if err != nil {
+		log.Panic("Unable to load routing rules: ", err)
+	}
+
+	blocklistSvc := blocklist.NewService(blocklist.NewRepository(db, hashIdService), hashIdService)
+	customerSvc := customers.NewService(gateways, router, blocklistSvc, customers.NewRepository(db, hashIdService), cfg.Cards)
+	chargesRepo := charges.NewRepository(db, hashIdService)
+
+	riskRules, err := risk.NewEngine(cfg.Risk, chargesRepo)
+	if err != nil {
+		log.Panic("Unable to load risk rules: ", err)
+	}
 
-	ps := payments.NewService("stripe", cfg)
-	customerSvc := customers.NewService(ps, customers.NewRepository(db, hashIdService))
-	chargesSvc := charges.NewService(ps, charges.NewRepository(db, hashIdService), hashIdService)
+	chargesSvc := charges.NewService(gateways, router, riskRules, blocklistSvc, chargesRepo, hashIdService, cfg.Charges)
+	organizationSvc := organizations.NewService(customerSvc, organizations.NewRepository(db, hashIdService))
+
+	sink, err := events.NewSink(cfg.Events.Sink, cfg.Events.Path, cfg.Events.URL)
+	if err != nil {
+		log.Panic("Unable to create event sink: ", err)
+	}
+
+	webhookSvc := webhooks.NewService(webhooks.NewRepository(db, hashIdService), hashIdService, cfg.Webhooks)
+	relay := events.NewRelay(events.NewRepository(db, hashIdService), events.NewMultiSink(sink, webhookSvc), cfg.Events.BatchSize)
 
 	return &Server{
 		config: cfg,
 		svc: &services.Services{
-			DB:          db,
-			HashId:      hashIdService,
-			CustomerSvc: customerSvc,
-			ChargeSvc:   chargesSvc,
+			DB:              db,
+			HashId:          hashIdService,
+			Gateways:        gateways,
+			CustomerSvc:     customerSvc,
+			ChargeSvc:       chargesSvc,
+			BlocklistSvc:    blocklistSvc,
+			OrganizationSvc: organizationSvc,
+			WebhookSvc:      webhookSvc,
+			EventRelay:      relay,
 		},
 	}
 }
@@ -55,11 +95,19 @@ func (s *Server) Run() error {
 		log.Fatalf("Unable to listen on port %s: %v", s.config.App.Addr, err)
 	}
 
+	auth := newAuthenticator(s.config)
+
 	server := grpc.NewServer(
-		grpc.UnaryInterceptor(loggingInterceptor),
+		grpc.ChainUnaryInterceptor(loggingInterceptor, auth.unaryInterceptor, hideIdsInterceptor),
+		grpc.ChainStreamInterceptor(streamLoggingInterceptor, auth.streamInterceptor, hideIdsStreamInterceptor),
 	)
 
 	pb.RegisterPaymentServiceServer(server, s)
+	s.registerHealth(server)
+
+	s.startWorkers()
+	s.startMetrics()
+
 	if err := server.Serve(listener); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
@@ -83,6 +131,20 @@ func loggingInterceptor(
 	return resp, nil
 }
 
+func streamLoggingInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	log.Printf("gRPC stream: %s", info.FullMethod)
+	err := handler(srv, ss)
+	if err != nil {
+		log.Printf("gRPC stream error: %v", err)
+	}
+	return err
+}
+
 func (s *Server) CloseDB() error {
 	return s.svc.DB.Close()
 }
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	pb "github.com/robertkohut/go-payments/proto"
+)
+
+func (s *Server) CreateWebhookEndpoint(ctx context.Context, req *pb.CreateWebhookEndpointRequest) (*pb.CreateWebhookEndpointResponse, error) {
+	endpoint, err := s.svc.WebhookSvc.CreateEndpoint(req.GetSourceId(), s.livemode(ctx), req.GetUrl(), req.GetEventTypes())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.CreateWebhookEndpointResponse{
+		Endpoint: endpoint,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) ListWebhookEndpoints(ctx context.Context, req *pb.ListWebhookEndpointsRequest) (*pb.ListWebhookEndpointsResponse, error) {
+	endpoints, err := s.svc.WebhookSvc.ListEndpoints(req.GetSourceId(), s.livemode(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListWebhookEndpointsResponse{
+		Endpoints: endpoints,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) DeleteWebhookEndpoint(ctx context.Context, req *pb.DeleteWebhookEndpointRequest) (*pb.DeleteWebhookEndpointResponse, error) {
+	err := s.svc.WebhookSvc.DeleteEndpoint(req.GetSourceId(), s.livemode(ctx), req.GetEndpointId())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.DeleteWebhookEndpointResponse{
+		Success: true,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) ListWebhookDeliveries(ctx context.Context, req *pb.ListWebhookDeliveriesRequest) (*pb.ListWebhookDeliveriesResponse, error) {
+	deliveries, err := s.svc.WebhookSvc.ListDeliveries(req, s.livemode(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListWebhookDeliveriesResponse{
+		Deliveries: deliveries,
+	}
+
+	return resp, nil
+}
+
+func (s *Server) RedeliverWebhook(ctx context.Context, req *pb.RedeliverWebhookRequest) (*pb.RedeliverWebhookResponse, error) {
+	delivery, err := s.svc.WebhookSvc.Redeliver(req.GetSourceId(), s.livemode(ctx), req.GetDeliveryId())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.RedeliverWebhookResponse{
+		Delivery: delivery,
+	}
+
+	return resp, nil
+}
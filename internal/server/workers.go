@@ -0,0 +1,49 @@
+package server
+
+import (
+	"log"
+	"time"
+)
+
+// runEvery calls fn once immediately and then on every tick of interval.
+func runEvery(name string, interval time.Duration, fn func() error) {
+	if interval <= 0 {
+		log.Println("Worker", name, "disabled")
+		return
+	}
+
+	for {
+		if err := fn(); err != nil {
+			log.Println("Worker", name, err)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+func (s *Server) startWorkers() {
+	go runEvery("charge-recovery", s.config.Charges.RecoveryInterval, func() error {
+		return s.svc.ChargeSvc.RecoverPendingCharges(s.config.Charges.RecoveryAge)
+	})
+
+	go runEvery("review-expiry", s.config.Charges.ReviewInterval, s.svc.ChargeSvc.ExpireReviews)
+
+	go runEvery("card-expiry", s.config.Cards.ExpiryInterval, s.svc.CustomerSvc.NotifyExpiringCards)
+
+	go runEvery("card-detach", s.config.Cards.DetachInterval, s.svc.CustomerSvc.RetryCardDetaches)
+
+	go runEvery("event-relay", s.config.Events.RelayInterval, func() error {
+		// Keep draining while full batches are being published.
+		for {
+			n, err := s.svc.EventRelay.Publish()
+			if err != nil || n < s.config.Events.BatchSize {
+				return err
+			}
+		}
+	})
+
+	go runEvery("webhook-dispatch", s.config.Webhooks.DispatchInterval, func() error {
+		_, err := s.svc.WebhookSvc.DeliverDue()
+		return err
+	})
+}
@@ -2,28 +2,50 @@ package hashid
 
 import (
 	"errors"
+	"expvar"
 	"github.com/robertkohut/go-payments/internal/config"
 	"github.com/speps/go-hashids/v2"
+	"strconv"
 )
 
+// legacyDecodes counts ids decoded with a legacy key, by key version. Once a
+// version stops increasing its salt can be retired.
+var legacyDecodes = expvar.NewMap("hashid_legacy_decodes")
+
+type key struct {
+	version int
+	hd      *hashids.HashID
+}
+
+// Service encodes ids with the active key and decodes them with the active
+// key or any of the legacy keys, tried in order.
 type Service struct {
-	hd *hashids.HashID
+	keys []key
 }
 
 func New(cfg *config.HashIdConfig) (*Service, error) {
-	hd := hashids.NewData()
-	hd.Salt = cfg.Salt
-	hd.MinLength = cfg.MinLength
-	hd.Alphabet = cfg.Alphabet
-	hashID, err := hashids.NewWithData(hd)
-	if err != nil {
-		return nil, err
+	s := &Service{}
+
+	configs := append([]config.HashIdConfig{*cfg}, cfg.Legacy...)
+	for _, c := range configs {
+		hd := hashids.NewData()
+		hd.Salt = c.Salt
+		hd.MinLength = c.MinLength
+		if c.Alphabet != "" {
+			hd.Alphabet = c.Alphabet
+		}
+		hashID, err := hashids.NewWithData(hd)
+		if err != nil {
+			return nil, err
+		}
+		s.keys = append(s.keys, key{version: c.Version, hd: hashID})
 	}
-	return &Service{hd: hashID}, nil
+
+	return s, nil
 }
 
 func (s *Service) Encode(ids []int64) (string, error) {
-	hash, err := s.hd.EncodeInt64(ids)
+	hash, err := s.keys[0].hd.EncodeInt64(ids)
 	if err != nil {
 		return "", err
 	}
@@ -31,12 +53,38 @@ func (s *Service) Encode(ids []int64) (string, error) {
 }
 
 func (s *Service) Decode(hash string) ([]int64, error) {
-	ids, err := s.hd.DecodeInt64WithError(hash)
+	ids, _, err := s.DecodeWithVersion(hash)
+	return ids, err
+}
+
+// DecodeWithVersion decodes a hash and reports the version of the key that
+// decoded it.
+func (s *Service) DecodeWithVersion(hash string) ([]int64, int, error) {
+	if hash == "" {
+		return nil, 0, errors.New("no valid ids found")
+	}
+	for i, k := range s.keys {
+		ids, err := k.hd.DecodeInt64WithError(hash)
+		if err != nil || len(ids) == 0 {
+			continue
+		}
+		if i > 0 {
+			legacyDecodes.Add(strconv.Itoa(k.version), 1)
+		}
+		return ids, k.version, nil
+	}
+	return nil, 0, errors.New("no valid ids found")
+}
+
+// DecodeId decodes a hash produced by Encode([]int64{id, tag}) and checks that
+// it carries the expected type tag.
+func (s *Service) DecodeId(hash string, tag int64) (int64, error) {
+	ids, err := s.Decode(hash)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	if len(ids) == 0 {
-		return nil, errors.New("no valid ids found")
+	if len(ids) != 2 || ids[1] != tag {
+		return 0, errors.New("invalid id")
 	}
-	return ids, nil
+	return ids[0], nil
 }
@@ -0,0 +1,60 @@
+package hashid
+
+import (
+	"expvar"
+	"github.com/robertkohut/go-payments/internal/config"
+	"testing"
+)
+
+func legacyDecodeCount(version string) int64 {
+	if v, ok := legacyDecodes.Get(version).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestDecodeLegacyKey(t *testing.T) {
+	legacy := config.HashIdConfig{Version: 1, Salt: "old salt", MinLength: 6}
+
+	old, err := New(&legacy)
+	if err != nil {
+		t.Fatalf("Could not create legacy service: %v", err)
+	}
+
+	ring, err := New(&config.HashIdConfig{
+		Version:   2,
+		Salt:      "new salt",
+		MinLength: 10,
+		Legacy:    []config.HashIdConfig{legacy},
+	})
+	if err != nil {
+		t.Fatalf("Could not create keyring: %v", err)
+	}
+
+	oldHash, _ := old.Encode([]int64{42, 52})
+	newHash, _ := ring.Encode([]int64{42, 52})
+
+	if oldHash == newHash {
+		t.Fatalf("expected keys to produce different hashes")
+	}
+
+	ids, version, err := ring.DecodeWithVersion(newHash)
+	if err != nil || version != 2 || ids[0] != 42 {
+		t.Fatalf("active key: got %v version %d err %v", ids, version, err)
+	}
+
+	before := legacyDecodeCount("1")
+
+	ids, version, err = ring.DecodeWithVersion(oldHash)
+	if err != nil || version != 1 || ids[0] != 42 {
+		t.Fatalf("legacy key: got %v version %d err %v", ids, version, err)
+	}
+
+	if legacyDecodeCount("1") != before+1 {
+		t.Fatalf("expected legacy decode to be counted")
+	}
+
+	if _, err := old.DecodeId(newHash, 52); err == nil {
+		t.Fatalf("expected legacy-only service to reject a hash from the new key")
+	}
+}
@@ -3,13 +3,23 @@ package services
 import (
 	"github.com/jmoiron/sqlx"
 	"github.com/robertkohut/go-payments/internal/services/hashid"
+	"github.com/robertkohut/go-payments/pkg/blocklist"
 	"github.com/robertkohut/go-payments/pkg/charges"
 	"github.com/robertkohut/go-payments/pkg/customers"
+	"github.com/robertkohut/go-payments/pkg/events"
+	"github.com/robertkohut/go-payments/pkg/organizations"
+	"github.com/robertkohut/go-payments/pkg/payments"
+	"github.com/robertkohut/go-payments/pkg/webhooks"
 )
 
 type Services struct {
-	DB          *sqlx.DB
-	HashId      *hashid.Service
-	CustomerSvc customers.Service
-	ChargeSvc   charges.Service
+	DB              *sqlx.DB
+	HashId          *hashid.Service
+	Gateways        payments.Registry
+	CustomerSvc     customers.Service
+	ChargeSvc       charges.Service
+	BlocklistSvc    blocklist.Service
+	OrganizationSvc organizations.Service
+	WebhookSvc      webhooks.Service
+	EventRelay      *events.Relay
 }
@@ -0,0 +1,290 @@
+package blocklist
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/robertkohut/go-payments/internal/services/hashid"
+	"github.com/robertkohut/go-payments/pkg/metadata"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"strings"
+	"time"
+)
+
+const (
+	typePrefix   = "BLOCKLIST_TYPE_"
+	reasonPrefix = "BLOCKLIST_REASON_"
+)
+
+// Key is a value of one type to look up in the blocklist.
+type Key struct {
+	Type  pb.BlocklistType
+	Value string
+}
+
+type Repository interface {
+	InsertEntry(entry *pb.BlocklistEntry) (int64, error)
+	SelectEntries(sourceId int64, t pb.BlocklistType, includeExpired bool, limit, offset int64) ([]*pb.BlocklistEntry, error)
+	SelectEntry(sourceId, entryId int64) (*pb.BlocklistEntry, error)
+	UpdateEntry(entry *pb.BlocklistEntry) error
+	DeleteEntry(entry *pb.BlocklistEntry) error
+	// SelectMatchingEntry returns an unexpired entry of the source matching
+	// any of keys, or nil if there is none.
+	SelectMatchingEntry(sourceId int64, keys []Key, now time.Time) (*pb.BlocklistEntry, error)
+}
+
+const selectEntriesStmt = `SELECT id, source_id, type, value, reason, notes, created_by, expires_at, flags, created_at, updated_at
+             FROM blocklist_entries`
+
+type repository struct {
+	db *sqlx.DB
+	hd *hashid.Service
+}
+
+func NewRepository(db *sqlx.DB, hd *hashid.Service) Repository {
+	return &repository{db: db, hd: hd}
+}
+
+func (r *repository) InsertEntry(entry *pb.BlocklistEntry) (int64, error) {
+	stmt := `INSERT INTO blocklist_entries (source_id, type, value, reason, notes, created_by, expires_at, flags)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	entry.Flags = entry.Flags | metadata.FlagsBlocklistEntryActive
+
+	result, err := r.db.Exec(
+		stmt,
+		entry.SourceId,
+		TypeName(entry.Type),
+		entry.Value,
+		ReasonName(entry.Reason),
+		entry.Notes,
+		entry.CreatedBy,
+		expiresAt(entry),
+		entry.Flags,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	entry.Id, err = result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	entry.IdStr, err = r.hd.Encode([]int64{entry.Id, metadata.HDBlocklistEntryId})
+	entry.CreatedAt = timestamppb.Now()
+	entry.UpdatedAt = entry.CreatedAt
+
+	return entry.Id, err
+}
+
+func (r *repository) SelectEntries(sourceId int64, t pb.BlocklistType, includeExpired bool, limit, offset int64) ([]*pb.BlocklistEntry, error) {
+	stmt := selectEntriesStmt + `
+			 WHERE source_id = ?
+			   AND (flags & ?) = ?`
+
+	args := []interface{}{sourceId, metadata.FlagsBlocklistEntryActive, metadata.FlagsBlocklistEntryActive}
+
+	if t != pb.BlocklistType_BLOCKLIST_TYPE_UNSPECIFIED {
+		stmt += ` AND type = ?`
+		args = append(args, TypeName(t))
+	}
+
+	if !includeExpired {
+		stmt += ` AND (expires_at IS NULL OR expires_at > ?)`
+		args = append(args, time.Now())
+	}
+
+	stmt += ` ORDER BY id DESC`
+
+	if limit > 0 {
+		stmt += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, offset)
+	}
+
+	return r.queryEntries(stmt, args...)
+}
+
+func (r *repository) SelectEntry(sourceId, entryId int64) (*pb.BlocklistEntry, error) {
+	stmt := selectEntriesStmt + `
+			 WHERE id = ?
+			   AND source_id = ?
+			   AND (flags & ?) = ?`
+
+	row := r.db.QueryRow(stmt, entryId, sourceId, metadata.FlagsBlocklistEntryActive, metadata.FlagsBlocklistEntryActive)
+
+	entry, err := r.scanEntry(row)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, status.Error(codes.NotFound, "blocklist entry not found")
+	case nil:
+		return entry, nil
+	default:
+		return nil, err
+	}
+}
+
+func (r *repository) UpdateEntry(entry *pb.BlocklistEntry) error {
+	stmt := `UPDATE blocklist_entries
+			 SET reason = ?,
+			     notes = ?,
+			     expires_at = ?,
+			     updated_at = CURRENT_TIMESTAMP
+			 WHERE id = ?
+			   AND source_id = ?`
+
+	_, err := r.db.Exec(stmt, ReasonName(entry.Reason), entry.Notes, expiresAt(entry), entry.Id, entry.SourceId)
+	if err != nil {
+		return err
+	}
+
+	entry.UpdatedAt = timestamppb.Now()
+
+	return nil
+}
+
+func (r *repository) DeleteEntry(entry *pb.BlocklistEntry) error {
+	stmt := `UPDATE blocklist_entries SET flags = flags &~ ?, updated_at = CURRENT_TIMESTAMP
+				 WHERE id = ?
+				   AND source_id = ?`
+
+	_, err := r.db.Exec(stmt, metadata.FlagsBlocklistEntryActive, entry.Id, entry.SourceId)
+
+	return err
+}
+
+func (r *repository) SelectMatchingEntry(sourceId int64, keys []Key, now time.Time) (*pb.BlocklistEntry, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	var match []string
+	args := []interface{}{sourceId, metadata.FlagsBlocklistEntryActive, metadata.FlagsBlocklistEntryActive, now}
+
+	for _, key := range keys {
+		match = append(match, `(type = ? AND value = ?)`)
+		args = append(args, TypeName(key.Type), key.Value)
+	}
+
+	stmt := selectEntriesStmt + `
+			 WHERE source_id = ?
+			   AND (flags & ?) = ?
+			   AND (expires_at IS NULL OR expires_at > ?)
+			   AND (` + strings.Join(match, " OR ") + `)
+			 LIMIT 1`
+
+	entries, err := r.queryEntries(stmt, args...)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	return entries[0], nil
+}
+
+func (r *repository) queryEntries(stmt string, args ...interface{}) ([]*pb.BlocklistEntry, error) {
+	var entries []*pb.BlocklistEntry
+
+	rows, err := r.db.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := r.scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (r *repository) scanEntry(row interface{ Scan(...interface{}) error }) (*pb.BlocklistEntry, error) {
+	entry := &pb.BlocklistEntry{}
+
+	var entryType, reason string
+	var expires sql.NullTime
+	var createdAt, updatedAt time.Time
+
+	err := row.Scan(
+		&entry.Id,
+		&entry.SourceId,
+		&entryType,
+		&entry.Value,
+		&reason,
+		&entry.Notes,
+		&entry.CreatedBy,
+		&expires,
+		&entry.Flags,
+		&createdAt,
+		&updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.Type, err = ParseType(entryType)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.Reason, err = ParseReason(reason)
+	if err != nil {
+		return nil, err
+	}
+
+	if expires.Valid {
+		entry.ExpiresAt = timestamppb.New(expires.Time)
+	}
+
+	entry.CreatedAt = timestamppb.New(createdAt)
+	entry.UpdatedAt = timestamppb.New(updatedAt)
+	entry.IdStr, err = r.hd.Encode([]int64{entry.Id, metadata.HDBlocklistEntryId})
+
+	return entry, err
+}
+
+func expiresAt(entry *pb.BlocklistEntry) sql.NullTime {
+	if entry.GetExpiresAt() == nil {
+		return sql.NullTime{}
+	}
+
+	return sql.NullTime{Time: entry.GetExpiresAt().AsTime(), Valid: true}
+}
+
+// TypeName returns the lowercase name stored in the blocklist_entries table,
+// e.g. "card_fingerprint".
+func TypeName(t pb.BlocklistType) string {
+	return strings.ToLower(strings.TrimPrefix(t.String(), typePrefix))
+}
+
+func ParseType(name string) (pb.BlocklistType, error) {
+	t, ok := pb.BlocklistType_value[typePrefix+strings.ToUpper(name)]
+	if !ok {
+		return pb.BlocklistType_BLOCKLIST_TYPE_UNSPECIFIED, fmt.Errorf("unknown blocklist type %q", name)
+	}
+
+	return pb.BlocklistType(t), nil
+}
+
+// ReasonName returns the lowercase name stored in the blocklist_entries
+// table, e.g. "fraud".
+func ReasonName(reason pb.BlocklistReason) string {
+	return strings.ToLower(strings.TrimPrefix(reason.String(), reasonPrefix))
+}
+
+func ParseReason(name string) (pb.BlocklistReason, error) {
+	reason, ok := pb.BlocklistReason_value[reasonPrefix+strings.ToUpper(name)]
+	if !ok {
+		return pb.BlocklistReason_BLOCKLIST_REASON_UNSPECIFIED, fmt.Errorf("unknown blocklist reason %q", name)
+	}
+
+	return pb.BlocklistReason(reason), nil
+}
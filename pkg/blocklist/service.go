@@ -0,0 +1,232 @@
+package blocklist
+
+import (
+	"github.com/robertkohut/go-payments/internal/services/hashid"
+	"github.com/robertkohut/go-payments/pkg/metadata"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Subject is what a request is checked against the blocklist for. Empty
+// fields are not checked.
+type Subject struct {
+	SourceId      int64
+	AccountId     int64
+	Email         string
+	CustomerExtId string
+	Fingerprint   string
+}
+
+type Service interface {
+	CreateEntry(sourceId int64, entry *pb.BlocklistEntry) (*pb.BlocklistEntry, error)
+	ListEntries(req *pb.ListBlocklistEntriesRequest) ([]*pb.BlocklistEntry, error)
+	UpdateEntry(sourceId int64, entryId string, update *pb.BlocklistEntry, paths []string) (*pb.BlocklistEntry, error)
+	DeleteEntry(sourceId int64, entryId string) error
+
+	// Check returns a PermissionDenied error if anything about subject is
+	// blocked.
+	Check(subject *Subject) error
+}
+
+// subjects describe each type in errors returned by Check.
+var subjects = map[pb.BlocklistType]string{
+	pb.BlocklistType_BLOCKLIST_TYPE_CARD_FINGERPRINT: "card",
+	pb.BlocklistType_BLOCKLIST_TYPE_GATEWAY_CUSTOMER: "customer",
+	pb.BlocklistType_BLOCKLIST_TYPE_ACCOUNT:          "account",
+	pb.BlocklistType_BLOCKLIST_TYPE_EMAIL_DOMAIN:     "email domain",
+}
+
+type service struct {
+	repo Repository
+	hd   *hashid.Service
+}
+
+func NewService(repo Repository, hd *hashid.Service) Service {
+	return &service{
+		repo: repo,
+		hd:   hd,
+	}
+}
+
+func (s *service) CreateEntry(sourceId int64, entry *pb.BlocklistEntry) (*pb.BlocklistEntry, error) {
+	if entry == nil {
+		return nil, status.Error(codes.InvalidArgument, "entry is required")
+	}
+
+	entry.SourceId = sourceId
+
+	value, err := normalize(entry.GetType(), entry.GetValue())
+	if err != nil {
+		return nil, err
+	}
+	entry.Value = value
+
+	if err := validate(entry); err != nil {
+		return nil, err
+	}
+
+	if err := validateExpiry(entry.GetExpiresAt()); err != nil {
+		return nil, err
+	}
+
+	_, err = s.repo.InsertEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("Blocklisted", TypeName(entry.Type), entry.Value, ReasonName(entry.Reason))
+
+	return entry, nil
+}
+
+func (s *service) ListEntries(req *pb.ListBlocklistEntriesRequest) ([]*pb.BlocklistEntry, error) {
+	return s.repo.SelectEntries(req.GetSourceId(), req.GetType(), req.GetIncludeExpired(), req.GetLimit(), req.GetOffset())
+}
+
+// UpdateEntry copies the fields named in paths from update to the entry. The
+// type and value of an entry cannot be changed.
+func (s *service) UpdateEntry(sourceId int64, entryId string, update *pb.BlocklistEntry, paths []string) (*pb.BlocklistEntry, error) {
+	entry, err := s.getEntry(sourceId, entryId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		paths = []string{"reason", "notes", "expires_at"}
+	}
+
+	for _, path := range paths {
+		switch path {
+		case "reason":
+			entry.Reason = update.GetReason()
+		case "notes":
+			entry.Notes = update.GetNotes()
+		case "expires_at":
+			if err := validateExpiry(update.GetExpiresAt()); err != nil {
+				return nil, err
+			}
+			entry.ExpiresAt = update.GetExpiresAt()
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "field %q cannot be updated", path)
+		}
+	}
+
+	if err := validate(entry); err != nil {
+		return nil, err
+	}
+
+	err = s.repo.UpdateEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (s *service) DeleteEntry(sourceId int64, entryId string) error {
+	entry, err := s.getEntry(sourceId, entryId)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.DeleteEntry(entry)
+}
+
+func (s *service) getEntry(sourceId int64, entryId string) (*pb.BlocklistEntry, error) {
+	id, err := s.hd.DecodeId(entryId, metadata.HDBlocklistEntryId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid blocklist entry id")
+	}
+
+	return s.repo.SelectEntry(sourceId, id)
+}
+
+func (s *service) Check(subject *Subject) error {
+	entry, err := s.repo.SelectMatchingEntry(subject.SourceId, keys(subject), time.Now())
+	if err != nil {
+		return err
+	}
+
+	if entry == nil {
+		return nil
+	}
+
+	log.Println("Blocked by blocklist entry", entry.Id, TypeName(entry.Type), entry.Value)
+
+	return status.Errorf(codes.PermissionDenied, "%s is blocked: %s", subjects[entry.Type], ReasonName(entry.Reason))
+}
+
+// keys lists the blocklist values a subject is looked up by.
+func keys(subject *Subject) []Key {
+	var keys []Key
+
+	if subject.AccountId != 0 {
+		keys = append(keys, Key{pb.BlocklistType_BLOCKLIST_TYPE_ACCOUNT, strconv.FormatInt(subject.AccountId, 10)})
+	}
+
+	if i := strings.LastIndex(subject.Email, "@"); i >= 0 && i < len(subject.Email)-1 {
+		keys = append(keys, Key{pb.BlocklistType_BLOCKLIST_TYPE_EMAIL_DOMAIN, strings.ToLower(subject.Email[i+1:])})
+	}
+
+	if subject.CustomerExtId != "" {
+		keys = append(keys, Key{pb.BlocklistType_BLOCKLIST_TYPE_GATEWAY_CUSTOMER, subject.CustomerExtId})
+	}
+
+	if subject.Fingerprint != "" {
+		keys = append(keys, Key{pb.BlocklistType_BLOCKLIST_TYPE_CARD_FINGERPRINT, subject.Fingerprint})
+	}
+
+	return keys
+}
+
+// normalize returns value in the form Check looks it up by.
+func normalize(t pb.BlocklistType, value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	switch t {
+	case pb.BlocklistType_BLOCKLIST_TYPE_ACCOUNT:
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			return "", status.Error(codes.InvalidArgument, "account entries take an account id")
+		}
+		return strconv.FormatInt(id, 10), nil
+	case pb.BlocklistType_BLOCKLIST_TYPE_EMAIL_DOMAIN:
+		value = strings.ToLower(strings.TrimPrefix(value, "@"))
+		if strings.Contains(value, "@") {
+			return "", status.Error(codes.InvalidArgument, "email domain entries take a domain, not an address")
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+}
+
+func validate(entry *pb.BlocklistEntry) error {
+	if _, ok := subjects[entry.GetType()]; !ok {
+		return status.Error(codes.InvalidArgument, "type is required")
+	}
+
+	if entry.GetValue() == "" {
+		return status.Error(codes.InvalidArgument, "value is required")
+	}
+
+	if entry.GetReason() == pb.BlocklistReason_BLOCKLIST_REASON_UNSPECIFIED {
+		return status.Error(codes.InvalidArgument, "reason is required")
+	}
+
+	return nil
+}
+
+func validateExpiry(expiresAt *timestamppb.Timestamp) error {
+	if expiresAt != nil && !expiresAt.AsTime().After(time.Now()) {
+		return status.Error(codes.InvalidArgument, "expires_at must be in the future")
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package blocklist
+
+import (
+	"github.com/robertkohut/go-payments/internal/config"
+	"github.com/robertkohut/go-payments/internal/services/hashid"
+	"github.com/robertkohut/go-payments/pkg/metadata"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"testing"
+	"time"
+)
+
+type memoryRepository struct {
+	Repository
+	entries []*pb.BlocklistEntry
+	keys    []Key
+}
+
+func (r *memoryRepository) InsertEntry(entry *pb.BlocklistEntry) (int64, error) {
+	entry.Id = int64(len(r.entries) + 1)
+	r.entries = append(r.entries, entry)
+	return entry.Id, nil
+}
+
+func (r *memoryRepository) SelectEntry(sourceId, entryId int64) (*pb.BlocklistEntry, error) {
+	for _, e := range r.entries {
+		if e.Id == entryId && e.SourceId == sourceId {
+			return e, nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, "blocklist entry not found")
+}
+
+func (r *memoryRepository) UpdateEntry(entry *pb.BlocklistEntry) error {
+	return nil
+}
+
+func (r *memoryRepository) SelectMatchingEntry(sourceId int64, keys []Key, now time.Time) (*pb.BlocklistEntry, error) {
+	r.keys = keys
+	for _, e := range r.entries {
+		if e.SourceId != sourceId || (e.ExpiresAt != nil && !e.ExpiresAt.AsTime().After(now)) {
+			continue
+		}
+		for _, k := range keys {
+			if e.Type == k.Type && e.Value == k.Value {
+				return e, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func newTestService(t *testing.T, repo Repository) *service {
+	hd, err := hashid.New(&config.HashIdConfig{Salt: "test", MinLength: 8})
+	if err != nil {
+		t.Fatalf("Could not create hashid service: %v", err)
+	}
+	return NewService(repo, hd).(*service)
+}
+
+func TestCheck(t *testing.T) {
+	repo := &memoryRepository{}
+	s := newTestService(t, repo)
+
+	_, err := s.CreateEntry(1, &pb.BlocklistEntry{
+		Type:   pb.BlocklistType_BLOCKLIST_TYPE_EMAIL_DOMAIN,
+		Value:  "@Example.COM",
+		Reason: pb.BlocklistReason_BLOCKLIST_REASON_FRAUD,
+	})
+	if err != nil {
+		t.Fatalf("Could not create entry: %v", err)
+	}
+
+	if repo.entries[0].Value != "example.com" {
+		t.Errorf("Expected a normalized domain, got %q", repo.entries[0].Value)
+	}
+
+	subject := &Subject{SourceId: 1, AccountId: 7, Email: "Jane@EXAMPLE.com", Fingerprint: "fp_1"}
+
+	err = s.Check(subject)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expected PermissionDenied, got %v", err)
+	}
+
+	if want := "email domain is blocked: fraud"; status.Convert(err).Message() != want {
+		t.Errorf("Expected %q, got %q", want, status.Convert(err).Message())
+	}
+
+	if len(repo.keys) != 3 {
+		t.Errorf("Expected account, email domain and fingerprint keys, got %v", repo.keys)
+	}
+
+	subject.SourceId = 2
+	if err := s.Check(subject); err != nil {
+		t.Errorf("Expected entries of another source to be ignored, got %v", err)
+	}
+
+	if err := s.Check(&Subject{SourceId: 1}); err != nil {
+		t.Errorf("Expected an empty subject to pass, got %v", err)
+	}
+}
+
+func TestCreateEntryValidation(t *testing.T) {
+	s := newTestService(t, &memoryRepository{})
+
+	tests := []*pb.BlocklistEntry{
+		{Type: pb.BlocklistType_BLOCKLIST_TYPE_ACCOUNT, Value: "abc", Reason: pb.BlocklistReason_BLOCKLIST_REASON_ABUSE},
+		{Type: pb.BlocklistType_BLOCKLIST_TYPE_EMAIL_DOMAIN, Value: "jane@example.com", Reason: pb.BlocklistReason_BLOCKLIST_REASON_ABUSE},
+		{Type: pb.BlocklistType_BLOCKLIST_TYPE_CARD_FINGERPRINT, Value: " ", Reason: pb.BlocklistReason_BLOCKLIST_REASON_ABUSE},
+		{Type: pb.BlocklistType_BLOCKLIST_TYPE_CARD_FINGERPRINT, Value: "fp_1"},
+		{Value: "fp_1", Reason: pb.BlocklistReason_BLOCKLIST_REASON_ABUSE},
+		{
+			Type:      pb.BlocklistType_BLOCKLIST_TYPE_CARD_FINGERPRINT,
+			Value:     "fp_1",
+			Reason:    pb.BlocklistReason_BLOCKLIST_REASON_ABUSE,
+			ExpiresAt: timestamppb.New(time.Now().Add(-time.Hour)),
+		},
+	}
+
+	for _, entry := range tests {
+		if _, err := s.CreateEntry(1, entry); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%v: expected InvalidArgument, got %v", entry, err)
+		}
+	}
+}
+
+func TestUpdateEntry(t *testing.T) {
+	repo := &memoryRepository{}
+	s := newTestService(t, repo)
+
+	entry, err := s.CreateEntry(1, &pb.BlocklistEntry{
+		Type:      pb.BlocklistType_BLOCKLIST_TYPE_ACCOUNT,
+		Value:     "42",
+		Reason:    pb.BlocklistReason_BLOCKLIST_REASON_DISPUTES,
+		ExpiresAt: timestamppb.New(time.Now().Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatalf("Could not create entry: %v", err)
+	}
+
+	id, _ := s.hd.Encode([]int64{entry.Id, metadata.HDBlocklistEntryId})
+
+	// An expired entry can still have its notes edited.
+	entry.ExpiresAt = timestamppb.New(time.Now().Add(-time.Hour))
+
+	updated, err := s.UpdateEntry(1, id, &pb.BlocklistEntry{Notes: "Chargebacks"}, []string{"notes"})
+	if err != nil {
+		t.Fatalf("Could not update notes: %v", err)
+	}
+
+	if updated.Notes != "Chargebacks" || updated.Reason != pb.BlocklistReason_BLOCKLIST_REASON_DISPUTES {
+		t.Errorf("Expected only notes to change, got %v", updated)
+	}
+
+	_, err = s.UpdateEntry(1, id, &pb.BlocklistEntry{ExpiresAt: timestamppb.New(time.Now().Add(-time.Minute))}, []string{"expires_at"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected a past expiry to be rejected, got %v", err)
+	}
+
+	_, err = s.UpdateEntry(1, id, &pb.BlocklistEntry{Value: "43"}, []string{"value"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected the value to be immutable, got %v", err)
+	}
+
+	_, err = s.UpdateEntry(2, id, &pb.BlocklistEntry{Notes: "x"}, []string{"notes"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected an entry of another source to be not found, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package charges
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/robertkohut/go-payments/pkg/payments"
+	pb "github.com/robertkohut/go-payments/proto"
+	"strings"
+)
+
+const declineReasonPrefix = "DECLINE_REASON_"
+
+// DeclineReasonName returns the lowercase name stored in the charges table,
+// e.g. "insufficient_funds".
+func DeclineReasonName(reason pb.DeclineReason) string {
+	if reason == pb.DeclineReason_DECLINE_REASON_UNSPECIFIED {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimPrefix(reason.String(), declineReasonPrefix))
+}
+
+// ParseDeclineReason converts a name stored by DeclineReasonName back into a
+// DeclineReason.
+func ParseDeclineReason(name string) (pb.DeclineReason, error) {
+	reason, ok := pb.DeclineReason_value[declineReasonPrefix+strings.ToUpper(name)]
+	if !ok {
+		return pb.DeclineReason_DECLINE_REASON_UNSPECIFIED, fmt.Errorf("unknown decline reason %q", name)
+	}
+
+	return pb.DeclineReason(reason), nil
+}
+
+// declineColumns returns the values of the decline_reason, decline_code and
+// decline_gateway_code columns, all NULL if the charge was not declined.
+func declineColumns(decline *pb.ChargeDecline) (reason, declineCode, gatewayCode sql.NullString) {
+	if decline == nil {
+		return
+	}
+
+	reason = sql.NullString{String: DeclineReasonName(decline.GetReason()), Valid: true}
+	declineCode = sql.NullString{String: decline.GetDeclineCode(), Valid: true}
+	gatewayCode = sql.NullString{String: decline.GetCode(), Valid: true}
+
+	return
+}
+
+// scanDecline rebuilds a decline from its stored columns. The message and
+// whether it is retryable follow from the reason.
+func scanDecline(reason, declineCode, gatewayCode sql.NullString) (*pb.ChargeDecline, error) {
+	if !reason.Valid {
+		return nil, nil
+	}
+
+	r, err := ParseDeclineReason(reason.String)
+	if err != nil {
+		return nil, err
+	}
+
+	return payments.NewDecline(r, gatewayCode.String, declineCode.String), nil
+}
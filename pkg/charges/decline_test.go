@@ -0,0 +1,41 @@
+package charges
+
+import (
+	pb "github.com/robertkohut/go-payments/proto"
+	"testing"
+)
+
+func TestDeclineColumns(t *testing.T) {
+	reason, declineCode, gatewayCode := declineColumns(nil)
+	if reason.Valid || declineCode.Valid || gatewayCode.Valid {
+		t.Fatalf("Expected NULL columns without a decline")
+	}
+
+	decline := &pb.ChargeDecline{
+		Reason:      pb.DeclineReason_DECLINE_REASON_INSUFFICIENT_FUNDS,
+		Code:        "card_declined",
+		DeclineCode: "insufficient_funds",
+	}
+
+	reason, declineCode, gatewayCode = declineColumns(decline)
+	if reason.String != "insufficient_funds" {
+		t.Errorf("Expected the lowercase reason name, got %q", reason.String)
+	}
+
+	scanned, err := scanDecline(reason, declineCode, gatewayCode)
+	if err != nil {
+		t.Fatalf("Could not scan decline: %v", err)
+	}
+
+	if scanned.Reason != decline.Reason || scanned.Code != decline.Code || scanned.DeclineCode != decline.DeclineCode {
+		t.Errorf("Expected %v, got %v", decline, scanned)
+	}
+
+	if scanned.Message == "" || !scanned.Retryable {
+		t.Errorf("Expected the message and retryability to follow from the reason, got %v", scanned)
+	}
+
+	if _, err := ParseDeclineReason("nope"); err == nil {
+		t.Errorf("Expected an error for an unknown reason")
+	}
+}
@@ -0,0 +1,82 @@
+package charges
+
+import (
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/protobuf/proto"
+	"sync"
+)
+
+const subscriptionBuffer = 32
+
+// Subscription receives every change to a customer's charges. C is closed
+// when the subscription is cancelled or falls too far behind; in the latter
+// case Lagged reports true and the subscriber should resume from the last
+// update it saw.
+type Subscription struct {
+	C <-chan *pb.Charge
+
+	c      chan *pb.Charge
+	lagged bool
+}
+
+func (s *Subscription) Lagged() bool {
+	return s.lagged
+}
+
+// Hub fans charge updates out to in-process subscribers.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[int64]map[*Subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[int64]map[*Subscription]struct{})}
+}
+
+// Subscribe returns a subscription to a customer's charges and a function
+// that cancels it.
+func (h *Hub) Subscribe(customerId int64) (*Subscription, func()) {
+	c := make(chan *pb.Charge, subscriptionBuffer)
+	sub := &Subscription{C: c, c: c}
+
+	h.mu.Lock()
+	if h.subs[customerId] == nil {
+		h.subs[customerId] = make(map[*Subscription]struct{})
+	}
+	h.subs[customerId][sub] = struct{}{}
+	h.mu.Unlock()
+
+	return sub, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(customerId, sub)
+	}
+}
+
+func (h *Hub) Publish(charge *pb.Charge) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs[charge.GetCustomerId()] {
+		select {
+		case sub.c <- proto.Clone(charge).(*pb.Charge):
+		default:
+			sub.lagged = true
+			h.remove(charge.GetCustomerId(), sub)
+		}
+	}
+}
+
+// remove must be called with h.mu held.
+func (h *Hub) remove(customerId int64, sub *Subscription) {
+	if _, ok := h.subs[customerId][sub]; !ok {
+		return
+	}
+
+	delete(h.subs[customerId], sub)
+	if len(h.subs[customerId]) == 0 {
+		delete(h.subs, customerId)
+	}
+
+	close(sub.c)
+}
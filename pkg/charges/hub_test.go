@@ -0,0 +1,60 @@
+package charges
+
+import (
+	pb "github.com/robertkohut/go-payments/proto"
+	"testing"
+)
+
+func TestHubSubscribe(t *testing.T) {
+	hub := NewHub()
+
+	sub, cancel := hub.Subscribe(1)
+	other, cancelOther := hub.Subscribe(2)
+	defer cancelOther()
+
+	hub.Publish(&pb.Charge{Id: 10, CustomerId: 1})
+
+	if charge := <-sub.C; charge.Id != 10 {
+		t.Errorf("Expected charge 10, got %v", charge)
+	}
+
+	select {
+	case charge := <-other.C:
+		t.Errorf("Expected no charge for another customer, got %v", charge)
+	default:
+	}
+
+	cancel()
+	cancel()
+
+	if _, ok := <-sub.C; ok || sub.Lagged() {
+		t.Errorf("Expected a cancelled subscription to be closed without lagging")
+	}
+
+	// Publishing after the last subscriber left must not block or panic.
+	hub.Publish(&pb.Charge{Id: 11, CustomerId: 1})
+
+	if len(hub.subs[1]) != 0 {
+		t.Errorf("Expected no subscribers left for customer 1, got %d", len(hub.subs[1]))
+	}
+}
+
+func TestHubDropsSlowSubscriber(t *testing.T) {
+	hub := NewHub()
+
+	sub, cancel := hub.Subscribe(1)
+	defer cancel()
+
+	for i := 0; i <= subscriptionBuffer; i++ {
+		hub.Publish(&pb.Charge{Id: int64(i), CustomerId: 1})
+	}
+
+	var received int
+	for range sub.C {
+		received++
+	}
+
+	if received != subscriptionBuffer || !sub.Lagged() {
+		t.Errorf("Expected %d buffered charges and a lagged subscription, got %d, lagged %v", subscriptionBuffer, received, sub.Lagged())
+	}
+}
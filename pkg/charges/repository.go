@@ -1,24 +1,71 @@
 package charges
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
 	structpb "github.com/golang/protobuf/ptypes/struct"
 	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/jmoiron/sqlx"
 	"github.com/robertkohut/go-payments/internal/services/hashid"
+	"github.com/robertkohut/go-payments/pkg/events"
 	"github.com/robertkohut/go-payments/pkg/metadata"
 	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 	"time"
 )
 
 type Repository interface {
 	SelectCharges(filter *pb.Filters) ([]*pb.Charge, error)
 	InsertCharge(charge *pb.Charge) (int64, error)
-	UpdateCharge(charge *pb.Charge) error
+	UpdateCharge(charge *pb.Charge, from pb.ChargeStatus) error
+	UpdateChargeDetails(charge *pb.Charge) error
+	UpdateChargeRouting(charge *pb.Charge) error
+	SelectUpdatedCharges(customerId, chargeId int64, since time.Time) ([]*pb.Charge, error)
+	SelectPendingCharges(before time.Time) ([]*pb.Charge, error)
+	SelectOrganizationCharges(org *pb.Organization, limit, offset int64) ([]*pb.Charge, error)
+	SelectChargeVelocity(customerId, pmId, currencyId int64, since time.Time) (int64, int64, error)
+	CountSucceededCardCharges(pmId int64) (int64, error)
+	SelectReviews(sourceId int64, livemode bool, st pb.ReviewStatus, limit, offset int64) ([]*pb.Charge, error)
+	SelectExpiredReviews(before time.Time) ([]*pb.Charge, error)
 
 	SelectCurrencyIdByCode(code string) (int64, error)
 }
 
+// selectChargesStmt lists the columns read by scanCharges.
+const selectChargesStmt = `SELECT c.id,
+                    c.gateway_id,
+                    c.ext_id,
+                    c.customer_id,
+                    c.account_id,
+                    (SELECT cu.source_id FROM customers cu WHERE cu.id = c.customer_id) AS source_id,
+                    c.description,
+                    c.pm_type,
+                    c.pm_id,
+                    c.amount,
+                    currencies.code AS currency,
+                    c.status,
+                    c.idempotency_key,
+                    c.metadata,
+                    c.livemode,
+                    c.routing,
+                    c.decline_reason,
+                    c.decline_code,
+                    c.decline_gateway_code,
+                    c.risk_verdict,
+                    c.risk_rules,
+                    c.review_status,
+                    c.reviewer,
+                    c.review_notes,
+                    c.review_expires_at,
+                    c.reviewed_at,
+                    c.created_at,
+                    c.updated_at
+            FROM charges c
+            INNER JOIN currencies ON currencies.id = c.currency_id`
+
 type repository struct {
 	db *sqlx.DB
 	hd *hashid.Service
@@ -33,55 +80,325 @@ func (r *repository) InsertCharge(charge *pb.Charge) (int64, error) {
                      gateway_id,
                      ext_id,
                      customer_id,
+                     account_id,
                      pm_type, 
                      pm_id, 
                      amount, 
                      currency_id, 
                      description,
-                     status)
-    		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+                     status,
+                     idempotency_key,
+                     metadata,
+                     livemode,
+                     routing,
+                     risk_verdict,
+                     risk_rules,
+                     review_status,
+                     review_expires_at)
+    		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	err := ValidateTransition(pb.ChargeStatus_CHARGE_STATUS_UNSPECIFIED, charge.GetStatus())
+	if err != nil {
+		return 0, err
+	}
 
-	result, err := r.db.Exec(
+	chargeMetadata, err := json.Marshal(charge.GetMetadata())
+	if err != nil {
+		return 0, err
+	}
+
+	chargeRouting, err := marshalRouting(charge.GetRouting())
+	if err != nil {
+		return 0, err
+	}
+
+	riskVerdict, riskRules, err := riskColumns(charge.GetRisk())
+	if err != nil {
+		return 0, err
+	}
+
+	review := reviewColumns(charge.GetReview())
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	charge.LegacyStatus = StatusName(charge.GetStatus())
+
+	result, err := tx.Exec(
 		stmt,
 		charge.GetGatewayId(),
 		charge.GetExtId(),
 		charge.GetCustomerId(),
+		charge.GetAccountId(),
 		charge.GetPmType(),
 		charge.GetPmId(),
 		charge.GetAmount(),
 		charge.GetCurrencyId(),
 		charge.GetDescription(),
-		charge.GetStatus(),
+		StatusName(charge.GetStatus()),
+		charge.GetIdempotencyKey(),
+		chargeMetadata,
+		charge.GetLivemode(),
+		chargeRouting,
+		riskVerdict,
+		riskRules,
+		review.status,
+		review.expiresAt,
 	)
 	if err != nil {
 		return 0, err
 	}
 
-	charge.Id, _ = result.LastInsertId()
+	charge.Id, err = result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	charge.IdStr, err = r.hd.Encode([]int64{charge.Id, metadata.HDChargeId})
+	if err != nil {
+		return 0, err
+	}
+
+	if charge.PmId != 0 {
+		charge.PmIdStr, _ = r.hd.Encode([]int64{charge.PmId, metadata.HDCardId})
+	}
+
+	charge.CustomerIdStr, _ = r.hd.Encode([]int64{charge.CustomerId, metadata.HDCustomerId})
+
+	charge.CreatedAt = timeToTimestamp(time.Now())
+	charge.UpdatedAt = charge.CreatedAt
 
-	return result.LastInsertId()
+	err = insertStatusHistory(tx, charge.Id, pb.ChargeStatus_CHARGE_STATUS_UNSPECIFIED, charge.GetStatus())
+	if err != nil {
+		return 0, err
+	}
+
+	return charge.Id, tx.Commit()
 }
 
-func (r *repository) UpdateCharge(charge *pb.Charge) error {
+// UpdateCharge moves a charge from the given status to charge.Status. The
+// transition is validated and only applied if the stored status still
+// matches from, so concurrent updates cannot skip a state.
+func (r *repository) UpdateCharge(charge *pb.Charge, from pb.ChargeStatus) error {
 	stmt := `UPDATE charges
 			 SET status = ?,
 			     ext_id = ?,
+			     decline_reason = ?,
+			     decline_code = ?,
+			     decline_gateway_code = ?,
+			     review_status = ?,
+			     reviewer = ?,
+			     review_notes = ?,
+			     review_expires_at = ?,
+			     reviewed_at = ?,
 			     updated_at = CURRENT_TIMESTAMP
-			 WHERE id = ?`
+			 WHERE id = ?
+			   AND status = ?`
+
+	err := ValidateTransition(from, charge.GetStatus())
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	declineReason, declineCode, gatewayCode := declineColumns(charge.GetDecline())
+	review := reviewColumns(charge.GetReview())
 
-	_, err := r.db.Exec(
+	charge.LegacyStatus = StatusName(charge.GetStatus())
+
+	result, err := tx.Exec(
 		stmt,
-		charge.GetStatus(),
+		StatusName(charge.GetStatus()),
 		charge.GetExtId(),
+		declineReason,
+		declineCode,
+		gatewayCode,
+		review.status,
+		review.reviewer,
+		review.notes,
+		review.expiresAt,
+		review.reviewedAt,
 		charge.GetId(),
+		StatusName(from),
 	)
 	if err != nil {
 		return err
 	}
 
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 && from != charge.GetStatus() {
+		return status.Errorf(codes.Aborted, "charge %d is no longer %s", charge.GetId(), StatusName(from))
+	}
+
+	if from != charge.GetStatus() {
+		err = insertStatusHistory(tx, charge.GetId(), from, charge.GetStatus())
+		if err != nil {
+			return err
+		}
+
+		err = r.insertChargeEvent(tx, charge)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	charge.UpdatedAt = timeToTimestamp(time.Now())
+
+	return nil
+}
+
+func (r *repository) UpdateChargeDetails(charge *pb.Charge) error {
+	stmt := `UPDATE charges
+			 SET description = ?,
+			     metadata = ?,
+			     updated_at = CURRENT_TIMESTAMP
+			 WHERE id = ?`
+
+	chargeMetadata, err := json.Marshal(charge.GetMetadata())
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(stmt, charge.GetDescription(), chargeMetadata, charge.GetId())
+	if err != nil {
+		return err
+	}
+
+	charge.UpdatedAt = timeToTimestamp(time.Now())
+
+	return nil
+}
+
+// UpdateChargeRouting moves a pending charge to another gateway, recording
+// why. It is stored before the charge is sent there, so recovery asks the
+// right gateway.
+func (r *repository) UpdateChargeRouting(charge *pb.Charge) error {
+	stmt := `UPDATE charges
+			 SET gateway_id = ?,
+			     routing = ?,
+			     updated_at = CURRENT_TIMESTAMP
+			 WHERE id = ?
+			   AND status = ?`
+
+	chargeRouting, err := marshalRouting(charge.GetRouting())
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(stmt, charge.GetGatewayId(), chargeRouting, charge.GetId(), StatusName(pb.ChargeStatus_CHARGE_STATUS_PENDING))
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return status.Errorf(codes.Aborted, "charge %d is no longer pending", charge.GetId())
+	}
+
 	return nil
 }
 
+// SelectChargeVelocity counts a customer's charges since a time, on one card
+// if pmId is set. The amount only adds up charges in the currency that did
+// not fail.
+func (r *repository) SelectChargeVelocity(customerId, pmId, currencyId int64, since time.Time) (int64, int64, error) {
+	stmt := `SELECT COUNT(*),
+                    COALESCE(SUM(CASE WHEN currency_id = ? AND status <> ? THEN amount END), 0)
+             FROM charges
+             WHERE customer_id = ?
+               AND created_at >= ?`
+
+	args := []interface{}{currencyId, StatusName(pb.ChargeStatus_CHARGE_STATUS_FAILED), customerId, since}
+
+	if pmId != 0 {
+		stmt += ` AND pm_id = ?`
+		args = append(args, pmId)
+	}
+
+	var count, amount int64
+
+	err := r.db.QueryRow(stmt, args...).Scan(&count, &amount)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return count, amount, nil
+}
+
+func (r *repository) CountSucceededCardCharges(pmId int64) (int64, error) {
+	stmt := `SELECT COUNT(*) FROM charges WHERE pm_id = ? AND status = ?`
+
+	var count int64
+
+	err := r.db.QueryRow(stmt, pmId, StatusName(pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED)).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func marshalRouting(routing *pb.ChargeRouting) ([]byte, error) {
+	if routing == nil {
+		return nil, nil
+	}
+
+	return protojson.Marshal(routing)
+}
+
+// insertChargeEvent writes the outbox event for the status a charge just moved to, if any.
+func (r *repository) insertChargeEvent(tx *sqlx.Tx, charge *pb.Charge) error {
+	var eventType string
+
+	switch charge.GetStatus() {
+	case pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED:
+		eventType = events.ChargeSucceeded
+	case pb.ChargeStatus_CHARGE_STATUS_FAILED:
+		eventType = events.ChargeFailed
+	case pb.ChargeStatus_CHARGE_STATUS_HELD_FOR_REVIEW:
+		eventType = events.ChargeHeld
+	case pb.ChargeStatus_CHARGE_STATUS_CANCELED:
+		eventType = events.ChargeCanceled
+	case pb.ChargeStatus_CHARGE_STATUS_PARTIALLY_REFUNDED, pb.ChargeStatus_CHARGE_STATUS_REFUNDED:
+		eventType = events.RefundCreated
+	default:
+		return nil
+	}
+
+	return events.Insert(tx, eventType, charge.GetCustomerId(), charge)
+}
+
+func insertStatusHistory(tx *sqlx.Tx, chargeId int64, from, to pb.ChargeStatus) error {
+	stmt := `INSERT INTO charge_status_history (charge_id, from_status, to_status) VALUES (?, ?, ?)`
+
+	_, err := tx.Exec(stmt, chargeId, StatusName(from), StatusName(to))
+
+	return err
+}
+
 func (r *repository) SelectCurrencyIdByCode(code string) (int64, error) {
 	stmt := `SELECT id FROM currencies WHERE code = ?`
 
@@ -102,19 +419,7 @@ func (r *repository) SelectCharges(filter *pb.Filters) ([]*pb.Charge, error) {
 		return nil, errors.New("missing filter")
 	}
 
-	stmt := `SELECT c.id,
-                    c.ext_id,
-                    c.customer_id,
-                    c.description,
-                    c.pm_type,
-                    c.pm_id,
-                    c.amount,
-                    currencies.code AS currency,
-                    c.status,
-                    c.created_at,
-                    c.updated_at
-            FROM charges c
-            INNER JOIN currencies ON currencies.id = c.currency_id`
+	stmt := selectChargesStmt
 
 	query, filterArgs := buildFilterQuery(filter)
 
@@ -143,23 +448,181 @@ func (r *repository) SelectCharges(filter *pb.Filters) ([]*pb.Charge, error) {
 	return charges, nil
 }
 
+// SelectUpdatedCharges returns the customer's charges updated at or after
+// since, or only the one with chargeId if it is not 0. A zero since matches
+// every charge.
+func (r *repository) SelectUpdatedCharges(customerId, chargeId int64, since time.Time) ([]*pb.Charge, error) {
+	stmt := selectChargesStmt + `
+            WHERE c.customer_id = ?`
+
+	args := []interface{}{customerId}
+
+	if chargeId != 0 {
+		stmt += ` AND c.id = ?`
+		args = append(args, chargeId)
+	}
+
+	if !since.IsZero() {
+		stmt += ` AND c.updated_at >= ?`
+		args = append(args, since.UTC())
+	}
+
+	stmt += ` ORDER BY c.created_at DESC`
+
+	rows, err := r.db.Queryx(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return r.scanCharges(rows)
+}
+
+// SelectPendingCharges returns the charges created before a time that are
+// still pending or waiting for the cardholder to authenticate, oldest first.
+func (r *repository) SelectPendingCharges(before time.Time) ([]*pb.Charge, error) {
+	stmt := selectChargesStmt + `
+            WHERE c.status IN (?, ?)
+              AND c.created_at < ?
+            ORDER BY c.created_at ASC`
+
+	rows, err := r.db.Queryx(stmt,
+		StatusName(pb.ChargeStatus_CHARGE_STATUS_PENDING),
+		StatusName(pb.ChargeStatus_CHARGE_STATUS_REQUIRES_ACTION),
+		before,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return r.scanCharges(rows)
+}
+
+// SelectReviews returns the charges of a source whose review is in a status,
+// soonest to expire first.
+func (r *repository) SelectReviews(sourceId int64, livemode bool, st pb.ReviewStatus, limit, offset int64) ([]*pb.Charge, error) {
+	stmt := selectChargesStmt + `
+            WHERE c.review_status = ?
+              AND c.livemode = ?
+              AND c.customer_id IN (SELECT cu.id FROM customers cu WHERE cu.source_id = ?)
+            ORDER BY c.review_expires_at ASC, c.id ASC`
+
+	args := []interface{}{ReviewStatusName(st), livemode, sourceId}
+
+	if limit > 0 {
+		stmt += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, offset)
+	}
+
+	rows, err := r.db.Queryx(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return r.scanCharges(rows)
+}
+
+// SelectExpiredReviews returns the charges still held for review whose hold
+// expired before a time.
+func (r *repository) SelectExpiredReviews(before time.Time) ([]*pb.Charge, error) {
+	stmt := selectChargesStmt + `
+            WHERE c.status = ?
+              AND c.review_expires_at < ?
+            ORDER BY c.review_expires_at ASC`
+
+	rows, err := r.db.Queryx(stmt, StatusName(pb.ChargeStatus_CHARGE_STATUS_HELD_FOR_REVIEW), before)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return r.scanCharges(rows)
+}
+
+// SelectOrganizationCharges returns the charges billed to an organization
+// along with those of the customers of its member accounts, newest first.
+func (r *repository) SelectOrganizationCharges(org *pb.Organization, limit, offset int64) ([]*pb.Charge, error) {
+	stmt := selectChargesStmt + `
+            WHERE c.customer_id = ?
+               OR c.customer_id IN (
+                   SELECT cu.id FROM customers cu
+                   INNER JOIN organization_accounts oa
+                           ON oa.source_id = cu.source_id
+                          AND oa.account_id = cu.account_id
+                   WHERE oa.organization_id = ?
+                     AND cu.livemode = ?
+                     AND (oa.flags & ?) = ?)
+            ORDER BY c.created_at DESC`
+
+	args := []interface{}{
+		org.GetCustomer().GetId(),
+		org.Id,
+		org.Livemode,
+		metadata.FlagsOrganizationAccountActive,
+		metadata.FlagsOrganizationAccountActive,
+	}
+
+	if limit > 0 {
+		stmt += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, offset)
+	}
+
+	rows, err := r.db.Queryx(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return r.scanCharges(rows)
+}
+
 func (r *repository) scanCharges(rows *sqlx.Rows) ([]*pb.Charge, error) {
 	var charges []*pb.Charge
 
 	for rows.Next() {
 		var charge pb.Charge
+		var chargeStatus string
+		var chargeMetadata, chargeRouting []byte
+		var declineReason, declineCode, gatewayCode sql.NullString
+		var riskVerdict sql.NullString
+		var riskRules []byte
+		var review reviewRow
 		var createdAt, updatedAt time.Time
 
 		err := rows.Scan(
 			&charge.Id,
+			&charge.GatewayId,
 			&charge.ExtId,
 			&charge.CustomerId,
+			&charge.AccountId,
+			&charge.SourceId,
 			&charge.Description,
 			&charge.PmType,
 			&charge.PmId,
 			&charge.Amount,
 			&charge.Currency,
-			&charge.Status,
+			&chargeStatus,
+			&charge.IdempotencyKey,
+			&chargeMetadata,
+			&charge.Livemode,
+			&chargeRouting,
+			&declineReason,
+			&declineCode,
+			&gatewayCode,
+			&riskVerdict,
+			&riskRules,
+			&review.status,
+			&review.reviewer,
+			&review.notes,
+			&review.expiresAt,
+			&review.reviewedAt,
 			&createdAt,
 			&updatedAt,
 		)
@@ -171,11 +634,51 @@ func (r *repository) scanCharges(rows *sqlx.Rows) ([]*pb.Charge, error) {
 			return nil, err
 		}
 
+		charge.Status, err = ParseStatus(chargeStatus)
+		if err != nil {
+			return nil, err
+		}
+		charge.LegacyStatus = chargeStatus
+
+		if len(chargeMetadata) > 0 {
+			if err := json.Unmarshal(chargeMetadata, &charge.Metadata); err != nil {
+				return nil, err
+			}
+		}
+
+		charge.Decline, err = scanDecline(declineReason, declineCode, gatewayCode)
+		if err != nil {
+			return nil, err
+		}
+
+		charge.Risk, err = scanRisk(riskVerdict, riskRules)
+		if err != nil {
+			return nil, err
+		}
+
+		charge.Review, err = scanReview(review)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(chargeRouting) > 0 {
+			charge.Routing = &pb.ChargeRouting{}
+			if err := protojson.Unmarshal(chargeRouting, charge.Routing); err != nil {
+				return nil, err
+			}
+		}
+
 		charge.IdStr, err = r.hd.Encode([]int64{charge.Id, metadata.HDChargeId})
 		if err != nil {
 			return nil, err
 		}
 
+		if charge.PmId != 0 {
+			charge.PmIdStr, _ = r.hd.Encode([]int64{charge.PmId, metadata.HDCardId})
+		}
+
+		charge.CustomerIdStr, _ = r.hd.Encode([]int64{charge.CustomerId, metadata.HDCustomerId})
+
 		charges = append(charges, &charge)
 	}
 
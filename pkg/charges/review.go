@@ -0,0 +1,91 @@
+package charges
+
+import (
+	"database/sql"
+	"fmt"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"strings"
+)
+
+const reviewStatusPrefix = "REVIEW_STATUS_"
+
+// ReviewStatusName returns the lowercase name stored in the charges table,
+// e.g. "open".
+func ReviewStatusName(st pb.ReviewStatus) string {
+	if st == pb.ReviewStatus_REVIEW_STATUS_UNSPECIFIED {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimPrefix(st.String(), reviewStatusPrefix))
+}
+
+// ParseReviewStatus converts a name stored by ReviewStatusName back into a
+// ReviewStatus.
+func ParseReviewStatus(name string) (pb.ReviewStatus, error) {
+	st, ok := pb.ReviewStatus_value[reviewStatusPrefix+strings.ToUpper(name)]
+	if !ok {
+		return pb.ReviewStatus_REVIEW_STATUS_UNSPECIFIED, fmt.Errorf("unknown review status %q", name)
+	}
+
+	return pb.ReviewStatus(st), nil
+}
+
+// reviewRow holds the review_* columns of a charge, all NULL for charges that
+// were never held for review.
+type reviewRow struct {
+	status     sql.NullString
+	reviewer   sql.NullString
+	notes      sql.NullString
+	expiresAt  sql.NullTime
+	reviewedAt sql.NullTime
+}
+
+func reviewColumns(review *pb.ChargeReview) reviewRow {
+	var row reviewRow
+
+	if review == nil {
+		return row
+	}
+
+	row.status = sql.NullString{String: ReviewStatusName(review.GetStatus()), Valid: true}
+	row.reviewer = sql.NullString{String: review.GetReviewer(), Valid: review.GetReviewer() != ""}
+	row.notes = sql.NullString{String: review.GetNotes(), Valid: review.GetNotes() != ""}
+
+	if review.GetExpiresAt() != nil {
+		row.expiresAt = sql.NullTime{Time: review.GetExpiresAt().AsTime(), Valid: true}
+	}
+
+	if review.GetReviewedAt() != nil {
+		row.reviewedAt = sql.NullTime{Time: review.GetReviewedAt().AsTime(), Valid: true}
+	}
+
+	return row
+}
+
+func scanReview(row reviewRow) (*pb.ChargeReview, error) {
+	if !row.status.Valid {
+		return nil, nil
+	}
+
+	st, err := ParseReviewStatus(row.status.String)
+	if err != nil {
+		return nil, err
+	}
+
+	review := &pb.ChargeReview{
+		Status:   st,
+		Reviewer: row.reviewer.String,
+		Notes:    row.notes.String,
+	}
+
+	if row.expiresAt.Valid {
+		review.ExpiresAt = timestamppb.New(row.expiresAt.Time)
+	}
+
+	if row.reviewedAt.Valid {
+		review.ReviewedAt = timestamppb.New(row.reviewedAt.Time)
+	}
+
+	return review, nil
+}
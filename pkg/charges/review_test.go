@@ -0,0 +1,77 @@
+package charges
+
+import (
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"testing"
+	"time"
+)
+
+func TestReviewColumns(t *testing.T) {
+	row := reviewColumns(nil)
+	if row.status.Valid || row.expiresAt.Valid {
+		t.Fatalf("Expected NULL columns without a review")
+	}
+
+	if review, _ := scanReview(row); review != nil {
+		t.Errorf("Expected no review, got %v", review)
+	}
+
+	now := time.Now().Truncate(time.Second)
+
+	review := &pb.ChargeReview{
+		Status:     pb.ReviewStatus_REVIEW_STATUS_APPROVED,
+		Reviewer:   "ops@example.com",
+		Notes:      "Known customer",
+		ExpiresAt:  timestamppb.New(now.Add(time.Hour)),
+		ReviewedAt: timestamppb.New(now),
+	}
+
+	row = reviewColumns(review)
+	if row.status.String != "approved" {
+		t.Errorf("Expected the lowercase status name, got %q", row.status.String)
+	}
+
+	scanned, err := scanReview(row)
+	if err != nil {
+		t.Fatalf("Could not scan review: %v", err)
+	}
+
+	if !proto.Equal(scanned, review) {
+		t.Errorf("Expected %v, got %v", review, scanned)
+	}
+
+	if _, err := ParseReviewStatus("nope"); err == nil {
+		t.Errorf("Expected an error for an unknown status")
+	}
+}
+
+func TestSetStatus(t *testing.T) {
+	tests := []struct {
+		gateway pb.ChargeStatus
+		want    pb.ChargeStatus
+		review  bool
+	}{
+		{pb.ChargeStatus_CHARGE_STATUS_AUTHORIZED, pb.ChargeStatus_CHARGE_STATUS_HELD_FOR_REVIEW, true},
+		{pb.ChargeStatus_CHARGE_STATUS_REQUIRES_ACTION, pb.ChargeStatus_CHARGE_STATUS_REQUIRES_ACTION, true},
+		{pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED, pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED, false},
+		{pb.ChargeStatus_CHARGE_STATUS_FAILED, pb.ChargeStatus_CHARGE_STATUS_FAILED, false},
+	}
+
+	for _, tt := range tests {
+		charge := &pb.Charge{Review: &pb.ChargeReview{Status: pb.ReviewStatus_REVIEW_STATUS_OPEN}}
+
+		setStatus(charge, tt.gateway)
+		if charge.Status != tt.want || (charge.Review != nil) != tt.review {
+			t.Errorf("%s: expected %s with review %v, got %s with %v", tt.gateway, tt.want, tt.review, charge.Status, charge.Review)
+		}
+	}
+
+	charge := &pb.Charge{}
+
+	setStatus(charge, pb.ChargeStatus_CHARGE_STATUS_AUTHORIZED)
+	if charge.Status != pb.ChargeStatus_CHARGE_STATUS_AUTHORIZED {
+		t.Errorf("Expected a charge without review to stay authorized, got %s", charge.Status)
+	}
+}
@@ -0,0 +1,68 @@
+package charges
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	pb "github.com/robertkohut/go-payments/proto"
+	"strings"
+)
+
+const riskVerdictPrefix = "RISK_VERDICT_"
+
+// RiskVerdictName returns the lowercase name stored in the charges table,
+// e.g. "review".
+func RiskVerdictName(verdict pb.RiskVerdict) string {
+	if verdict == pb.RiskVerdict_RISK_VERDICT_UNSPECIFIED {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimPrefix(verdict.String(), riskVerdictPrefix))
+}
+
+// ParseRiskVerdict converts a name stored by RiskVerdictName back into a
+// RiskVerdict.
+func ParseRiskVerdict(name string) (pb.RiskVerdict, error) {
+	verdict, ok := pb.RiskVerdict_value[riskVerdictPrefix+strings.ToUpper(name)]
+	if !ok {
+		return pb.RiskVerdict_RISK_VERDICT_UNSPECIFIED, fmt.Errorf("unknown risk verdict %q", name)
+	}
+
+	return pb.RiskVerdict(verdict), nil
+}
+
+// riskColumns returns the values of the risk_verdict and risk_rules columns,
+// NULL for charges made before risk rules were run.
+func riskColumns(risk *pb.RiskAssessment) (sql.NullString, []byte, error) {
+	if risk == nil {
+		return sql.NullString{}, nil, nil
+	}
+
+	rules, err := json.Marshal(risk.GetMatchedRules())
+	if err != nil {
+		return sql.NullString{}, nil, err
+	}
+
+	return sql.NullString{String: RiskVerdictName(risk.GetVerdict()), Valid: true}, rules, nil
+}
+
+func scanRisk(verdict sql.NullString, rules []byte) (*pb.RiskAssessment, error) {
+	if !verdict.Valid {
+		return nil, nil
+	}
+
+	v, err := ParseRiskVerdict(verdict.String)
+	if err != nil {
+		return nil, err
+	}
+
+	risk := &pb.RiskAssessment{Verdict: v}
+
+	if len(rules) > 0 {
+		if err := json.Unmarshal(rules, &risk.MatchedRules); err != nil {
+			return nil, err
+		}
+	}
+
+	return risk, nil
+}
@@ -1,30 +1,62 @@
 package charges
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/robertkohut/go-payments/internal/config"
 	"github.com/robertkohut/go-payments/internal/services/hashid"
+	"github.com/robertkohut/go-payments/pkg/blocklist"
 	"github.com/robertkohut/go-payments/pkg/metadata"
 	"github.com/robertkohut/go-payments/pkg/payments"
+	"github.com/robertkohut/go-payments/pkg/risk"
+	"github.com/robertkohut/go-payments/pkg/routing"
 	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"log"
+	"time"
 )
 
 type Service interface {
 	ChargeCustomerPaymentMethod(customer *pb.Customer, card *pb.Card, charge *pb.Charge) (*pb.Charge, error)
 	GetCustomerCharges(customer *pb.Customer, filter *pb.Filters) ([]*pb.Charge, error)
+	GetCustomerCharge(customer *pb.Customer, chargeId int64, extId string) (*pb.Charge, error)
+	GetUpdatedCharges(customer *pb.Customer, chargeId int64, since time.Time) ([]*pb.Charge, error)
+	GetOrganizationCharges(org *pb.Organization, limit, offset int64) ([]*pb.Charge, error)
+	UpdateChargeDetails(charge *pb.Charge, update *pb.Charge, paths []string) (*pb.Charge, error)
+	RecoverPendingCharges(olderThan time.Duration) error
+	WatchCharges(customer *pb.Customer) (*Subscription, func())
+	ListReviews(sourceId int64, livemode bool, st pb.ReviewStatus, limit, offset int64) ([]*pb.Charge, error)
+	ApproveReview(sourceId int64, livemode bool, chargeId int64, reviewer, notes string) (*pb.Charge, error)
+	RejectReview(sourceId int64, livemode bool, chargeId int64, reviewer, notes string) (*pb.Charge, error)
+	ExpireReviews() error
 }
 
 type service struct {
-	paymentSvc payments.PaymentService
-	repo       Repository
-	hd         *hashid.Service
+	gateways  payments.Registry
+	router    routing.Engine
+	rules     risk.Engine
+	blocklist blocklist.Service
+	repo      Repository
+	hd        *hashid.Service
+	hub       *Hub
+	cfg       *config.ChargesConfig
 }
 
-func NewService(payments payments.PaymentService, repo Repository, hd *hashid.Service) Service {
+func NewService(gateways payments.Registry, router routing.Engine, rules risk.Engine, blocked blocklist.Service, repo Repository, hd *hashid.Service, cfg *config.ChargesConfig) Service {
 	return &service{
-		paymentSvc: payments,
-		repo:       repo,
-		hd:         hd,
+		gateways:  gateways,
+		router:    router,
+		rules:     rules,
+		blocklist: blocked,
+		repo:      repo,
+		hd:        hd,
+		hub:       NewHub(),
+		cfg:       cfg,
 	}
 }
 
@@ -38,30 +70,99 @@ func (s *service) getCurrencyIdByCode(code string) int64 {
 }
 
 func (s *service) ChargeCustomerPaymentMethod(customer *pb.Customer, card *pb.Card, charge *pb.Charge) (*pb.Charge, error) {
-	charge.GatewayId = customer.GatewayId
+	if err := metadata.Validate(charge.GetMetadata()); err != nil {
+		return nil, err
+	}
+
+	charge.SourceId = customer.SourceId
+	charge.Livemode = customer.Livemode
 	charge.CustomerId = customer.Id
+	if charge.AccountId == 0 {
+		charge.AccountId = customer.AccountId
+	}
+
+	err := s.blocklist.Check(&blocklist.Subject{
+		SourceId:      customer.SourceId,
+		AccountId:     charge.AccountId,
+		Email:         customer.Email,
+		CustomerExtId: customer.ExtId,
+		Fingerprint:   card.GetFingerprint(),
+	})
+	if err != nil {
+		return nil, err
+	}
 	charge.CurrencyId = s.getCurrencyIdByCode(charge.Currency)
+	charge.IdempotencyKey = newIdempotencyKey()
+
+	paymentSvc, failoverId, err := s.route(customer, card, charge)
+	if err != nil {
+		return nil, err
+	}
+
+	charge.Risk, err = s.rules.Evaluate(&risk.Input{Customer: customer, Card: card, Charge: charge})
+	if err != nil {
+		return nil, err
+	}
+
+	// Charges to review are only authorized, and captured once approved.
+	if charge.Risk.GetVerdict() == pb.RiskVerdict_RISK_VERDICT_REVIEW {
+		charge.Review = &pb.ChargeReview{
+			Status:    pb.ReviewStatus_REVIEW_STATUS_OPEN,
+			ExpiresAt: timestamppb.New(time.Now().Add(s.cfg.ReviewExpiry)),
+		}
+	}
+
+	// Persist the charge as pending with its idempotency key before calling the
+	// gateway, so RecoverPendingCharges can resolve it if we never hear back.
+	charge.Status = pb.ChargeStatus_CHARGE_STATUS_PENDING
 
 	chargeId, err := s.repo.InsertCharge(charge)
 	if err != nil {
 		return nil, err
 	}
 
+	s.hub.Publish(charge)
+
+	// Blocked charges are kept as failed, so they show up in reports and
+	// count towards velocity rules.
+	if charge.Risk.GetVerdict() == pb.RiskVerdict_RISK_VERDICT_BLOCK {
+		log.Println("Charge blocked by risk rules", chargeId, charge.Risk.GetMatchedRules())
+
+		charge.Status = pb.ChargeStatus_CHARGE_STATUS_FAILED
+		_ = s.updateCharge(charge, pb.ChargeStatus_CHARGE_STATUS_PENDING)
+		return nil, status.Errorf(codes.FailedPrecondition, "charge %s was blocked", charge.IdStr)
+	}
+
 	hdInvoiceId, _ := s.hd.Encode([]int64{chargeId, metadata.HDChargeId})
 	if charge.Description == "" {
 		charge.Description = "Invoice " + hdInvoiceId
 	}
 
-	extId, err := s.paymentSvc.CreateCharge(customer, card, charge)
+	result, err := createCharge(paymentSvc, customer, card, charge)
+	if errors.Is(err, payments.ErrUnavailable) && failoverId != 0 {
+		result, err = s.failover(customer, card, charge, failoverId, err)
+	}
+	if errors.Is(err, payments.ErrTimeout) || errors.Is(err, payments.ErrTransient) {
+		// The gateway may have charged the card. The charge stays pending
+		// until RecoverPendingCharges finds out.
+		log.Println("Charge outcome unknown", chargeId, err)
+		return nil, status.Errorf(codes.DeadlineExceeded, "charge %s is pending: %v", charge.IdStr, err)
+	}
 	if err != nil {
-		charge.Status = "failed"
-		_ = s.repo.UpdateCharge(charge)
+		var declineErr *payments.DeclineError
+		if errors.As(err, &declineErr) {
+			charge.Decline = declineErr.Decline
+		}
+
+		setStatus(charge, pb.ChargeStatus_CHARGE_STATUS_FAILED)
+		_ = s.updateCharge(charge, pb.ChargeStatus_CHARGE_STATUS_PENDING)
 		return nil, err
 	}
 
-	charge.ExtId = *extId
+	charge.ExtId = result.ExtId
+	setStatus(charge, result.Status)
 
-	err = s.repo.UpdateCharge(charge)
+	err = s.updateCharge(charge, pb.ChargeStatus_CHARGE_STATUS_PENDING)
 	if err != nil {
 		return nil, err
 	}
@@ -71,6 +172,104 @@ func (s *service) ChargeCustomerPaymentMethod(customer *pb.Customer, card *pb.Ca
 	return charge, nil
 }
 
+// route picks the gateway of a charge and records the decision on it. A rule
+// can only send a charge away from the customer's gateway if the card can be
+// charged there by its network token. It also returns the gateway to fail
+// over to, or 0.
+func (s *service) route(customer *pb.Customer, card *pb.Card, charge *pb.Charge) (payments.PaymentService, int64, error) {
+	charge.GatewayId = customer.GatewayId
+	charge.Routing = &pb.ChargeRouting{Reason: "customer gateway"}
+
+	var failoverId int64
+
+	decision := s.router.Route(&routing.Request{
+		SourceId: customer.SourceId,
+		Currency: charge.GetCurrency(),
+		Brand:    card.GetBrand(),
+		Amount:   charge.GetAmount(),
+		Key:      charge.GetIdempotencyKey(),
+	})
+
+	if decision != nil {
+		charge.Routing.Rule = decision.Rule
+		failoverId = decision.FailoverId
+
+		if decision.GatewayId == customer.GatewayId {
+			charge.Routing.Reason = "rule"
+		} else if _, ok := s.chargeableOn(customer, card, decision.GatewayId); ok {
+			charge.GatewayId = decision.GatewayId
+			charge.Routing.Reason = "rule"
+		} else {
+			charge.Routing.Reason = fmt.Sprintf("card cannot be charged on gateway %d", decision.GatewayId)
+		}
+	}
+
+	charge.Routing.GatewayId = charge.GatewayId
+
+	paymentSvc, err := s.gateways.Service(customer.SourceId, charge.GatewayId, customer.Livemode)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return paymentSvc, failoverId, nil
+}
+
+// chargeableOn returns the service of a gateway if the card can be charged
+// there: the customer's own gateway, or one that accepts the card's network
+// token.
+func (s *service) chargeableOn(customer *pb.Customer, card *pb.Card, gatewayId int64) (payments.PaymentService, bool) {
+	paymentSvc, err := s.gateways.Service(customer.SourceId, gatewayId, customer.Livemode)
+	if err != nil {
+		return nil, false
+	}
+
+	if gatewayId == customer.GatewayId {
+		return paymentSvc, true
+	}
+
+	if _, ok := paymentSvc.(payments.NetworkTokenService); !ok || card.GetNetworkToken() == "" {
+		return nil, false
+	}
+
+	return paymentSvc, true
+}
+
+// failover retries a charge the gateway did not process on the failover
+// gateway. The move is stored first, so recovery looks the charge up there.
+func (s *service) failover(customer *pb.Customer, card *pb.Card, charge *pb.Charge, gatewayId int64, cause error) (*pb.Charge, error) {
+	if gatewayId == charge.GatewayId {
+		return nil, cause
+	}
+
+	paymentSvc, ok := s.chargeableOn(customer, card, gatewayId)
+	if !ok {
+		return nil, cause
+	}
+
+	log.Println("Failing over charge", charge.Id, "from gateway", charge.GatewayId, "to", gatewayId, cause)
+
+	charge.Routing.FailedOverFrom = charge.GatewayId
+	charge.Routing.GatewayId = gatewayId
+	charge.Routing.Reason = "failover: " + cause.Error()
+	charge.GatewayId = gatewayId
+
+	if err := s.repo.UpdateChargeRouting(charge); err != nil {
+		return nil, err
+	}
+
+	return createCharge(paymentSvc, customer, card, charge)
+}
+
+// createCharge sends a charge to paymentSvc, by the card's network token if
+// the charge is not on the customer's gateway.
+func createCharge(paymentSvc payments.PaymentService, customer *pb.Customer, card *pb.Card, charge *pb.Charge) (*pb.Charge, error) {
+	if charge.GatewayId == customer.GatewayId {
+		return paymentSvc.CreateCharge(customer, card, charge)
+	}
+
+	return paymentSvc.(payments.NetworkTokenService).CreateNetworkTokenCharge(card, charge)
+}
+
 func (s *service) GetCustomerCharges(customer *pb.Customer, filter *pb.Filters) ([]*pb.Charge, error) {
 	if filter == nil {
 		filter = &pb.Filters{}
@@ -84,3 +283,311 @@ func (s *service) GetCustomerCharges(customer *pb.Customer, filter *pb.Filters)
 
 	return s.repo.SelectCharges(filter)
 }
+
+// GetUpdatedCharges lists the customer's charges updated since a time, or
+// just the one with chargeId if it is not 0. A zero since lists them all.
+func (s *service) GetUpdatedCharges(customer *pb.Customer, chargeId int64, since time.Time) ([]*pb.Charge, error) {
+	return s.repo.SelectUpdatedCharges(customer.GetId(), chargeId, since)
+}
+
+// GetOrganizationCharges lists the charges made across an organization: those
+// billed to it and those of its member accounts.
+func (s *service) GetOrganizationCharges(org *pb.Organization, limit, offset int64) ([]*pb.Charge, error) {
+	return s.repo.SelectOrganizationCharges(org, limit, offset)
+}
+
+// GetCustomerCharge looks up one of the customer's charges by internal id or,
+// if chargeId is 0, by the gateway's id.
+func (s *service) GetCustomerCharge(customer *pb.Customer, chargeId int64, extId string) (*pb.Charge, error) {
+	filter := &pb.Filters{Limit: 1}
+
+	switch {
+	case chargeId != 0:
+		filter.Filters = append(filter.Filters, &pb.Filter{
+			Column:   "c.id",
+			Operator: "=",
+			Value:    structpb.NewNumberValue(float64(chargeId)),
+		})
+	case extId != "":
+		filter.Filters = append(filter.Filters, &pb.Filter{
+			Column:   "c.ext_id",
+			Operator: "=",
+			Value:    structpb.NewStringValue(extId),
+		})
+	default:
+		return nil, status.Error(codes.InvalidArgument, "charge id or ext id is required")
+	}
+
+	charges, err := s.GetCustomerCharges(customer, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(charges) == 0 {
+		return nil, status.Error(codes.NotFound, "charge not found")
+	}
+
+	return charges[0], nil
+}
+
+// UpdateChargeDetails copies the fields named in paths from update to charge.
+// Only the description and metadata can be changed.
+func (s *service) UpdateChargeDetails(charge *pb.Charge, update *pb.Charge, paths []string) (*pb.Charge, error) {
+	if len(paths) == 0 {
+		paths = []string{"description", "metadata"}
+	}
+
+	for _, path := range paths {
+		switch path {
+		case "description":
+			charge.Description = update.GetDescription()
+		case "metadata":
+			if err := metadata.Validate(update.GetMetadata()); err != nil {
+				return nil, err
+			}
+			charge.Metadata = update.GetMetadata()
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "field %q cannot be updated", path)
+		}
+	}
+
+	err := s.repo.UpdateChargeDetails(charge)
+	if err != nil {
+		return nil, err
+	}
+
+	s.hub.Publish(charge)
+
+	return charge, nil
+}
+
+// RecoverPendingCharges resolves charges left pending, for which the outcome
+// was never recorded, and those left waiting for the cardholder to
+// authenticate. A charge the cardholder did not authenticate within the
+// action expiry is canceled at the gateway.
+func (s *service) RecoverPendingCharges(olderThan time.Duration) error {
+	pending, err := s.repo.SelectPendingCharges(time.Now().Add(-olderThan))
+	if err != nil {
+		return err
+	}
+
+	for _, charge := range pending {
+		from := charge.Status
+
+		paymentSvc, err := s.gateways.Service(charge.SourceId, charge.GatewayId, charge.Livemode)
+		if err != nil {
+			log.Println("RecoverPendingCharges", charge.Id, err)
+			continue
+		}
+
+		found, err := paymentSvc.FindCharge(charge)
+		if errors.Is(err, payments.ErrNotVisible) && recoveryExpired(charge, olderThan, time.Now()) {
+			found, err = nil, nil
+		}
+
+		if err == nil && found.GetStatus() == pb.ChargeStatus_CHARGE_STATUS_REQUIRES_ACTION && actionExpired(charge, s.cfg.ActionExpiry, time.Now()) {
+			found, err = paymentSvc.VoidCharge(&pb.Charge{ExtId: found.ExtId, IdempotencyKey: charge.IdempotencyKey})
+		}
+
+		if err != nil {
+			log.Println("RecoverPendingCharges", charge.Id, err)
+			continue
+		}
+
+		// The gateway never saw the charge, so the card was not charged.
+		if found == nil {
+			setStatus(charge, pb.ChargeStatus_CHARGE_STATUS_FAILED)
+		} else {
+			if found.Status == pb.ChargeStatus_CHARGE_STATUS_PENDING || found.Status == from {
+				continue
+			}
+
+			charge.ExtId = found.ExtId
+			setStatus(charge, found.Status)
+			charge.Decline = found.Decline
+		}
+
+		err = s.updateCharge(charge, from)
+		if err != nil {
+			log.Println("RecoverPendingCharges", charge.Id, err)
+			continue
+		}
+
+		log.Println("Recovered charge", charge.Id, StatusName(charge.Status))
+	}
+
+	return nil
+}
+
+// recoveryExpired reports whether a pending charge the gateway does not list
+// yet has had another recovery age, after the one it waited to be recovered,
+// to show up. It is then taken as never seen.
+func recoveryExpired(charge *pb.Charge, olderThan time.Duration, now time.Time) bool {
+	return charge.GetCreatedAt().AsTime().Before(now.Add(-2 * olderThan))
+}
+
+// actionExpired reports whether a charge has waited longer than expiry for
+// the cardholder to authenticate. A non-positive expiry never expires.
+func actionExpired(charge *pb.Charge, expiry time.Duration, now time.Time) bool {
+	return expiry > 0 && charge.GetCreatedAt().AsTime().Before(now.Add(-expiry))
+}
+
+// setStatus sets the status of a charge the gateway reported in st. An
+// authorized charge under review is held for it. A charge that was settled
+// without being held has nothing left to review.
+func setStatus(charge *pb.Charge, st pb.ChargeStatus) {
+	charge.Status = st
+
+	if charge.GetReview() == nil {
+		return
+	}
+
+	switch st {
+	case pb.ChargeStatus_CHARGE_STATUS_AUTHORIZED:
+		charge.Status = pb.ChargeStatus_CHARGE_STATUS_HELD_FOR_REVIEW
+	case pb.ChargeStatus_CHARGE_STATUS_PENDING, pb.ChargeStatus_CHARGE_STATUS_REQUIRES_ACTION:
+		// Not authorized yet, the review stays open.
+	default:
+		charge.Review = nil
+	}
+}
+
+// ListReviews lists the charges of a source whose review is in a status, open
+// reviews if st is unspecified.
+func (s *service) ListReviews(sourceId int64, livemode bool, st pb.ReviewStatus, limit, offset int64) ([]*pb.Charge, error) {
+	if st == pb.ReviewStatus_REVIEW_STATUS_UNSPECIFIED {
+		st = pb.ReviewStatus_REVIEW_STATUS_OPEN
+	}
+
+	return s.repo.SelectReviews(sourceId, livemode, st, limit, offset)
+}
+
+// ApproveReview captures a charge held for review.
+func (s *service) ApproveReview(sourceId int64, livemode bool, chargeId int64, reviewer, notes string) (*pb.Charge, error) {
+	return s.closeReview(sourceId, livemode, chargeId, reviewer, notes, pb.ReviewStatus_REVIEW_STATUS_APPROVED)
+}
+
+// RejectReview voids a charge held for review, releasing the hold on the card.
+func (s *service) RejectReview(sourceId int64, livemode bool, chargeId int64, reviewer, notes string) (*pb.Charge, error) {
+	return s.closeReview(sourceId, livemode, chargeId, reviewer, notes, pb.ReviewStatus_REVIEW_STATUS_REJECTED)
+}
+
+func (s *service) closeReview(sourceId int64, livemode bool, chargeId int64, reviewer, notes string, st pb.ReviewStatus) (*pb.Charge, error) {
+	if reviewer == "" {
+		return nil, status.Error(codes.InvalidArgument, "reviewer is required")
+	}
+
+	charges, err := s.repo.SelectCharges(&pb.Filters{
+		Limit: 1,
+		Filters: []*pb.Filter{{
+			Column:   "c.id",
+			Operator: "=",
+			Value:    structpb.NewNumberValue(float64(chargeId)),
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(charges) == 0 || charges[0].SourceId != sourceId || charges[0].Livemode != livemode {
+		return nil, status.Error(codes.NotFound, "charge not found")
+	}
+
+	charge := charges[0]
+
+	if charge.Status != pb.ChargeStatus_CHARGE_STATUS_HELD_FOR_REVIEW {
+		return nil, status.Errorf(codes.FailedPrecondition, "charge %s is not held for review", charge.IdStr)
+	}
+
+	err = s.settleReview(charge, st, reviewer, notes)
+	if err != nil {
+		return nil, err
+	}
+
+	return charge, nil
+}
+
+// ExpireReviews voids the charges nobody reviewed in time, before their
+// authorizations lapse at the gateway.
+func (s *service) ExpireReviews() error {
+	expired, err := s.repo.SelectExpiredReviews(time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, charge := range expired {
+		err := s.settleReview(charge, pb.ReviewStatus_REVIEW_STATUS_EXPIRED, "", "")
+		if err != nil {
+			log.Println("ExpireReviews", charge.Id, err)
+			continue
+		}
+
+		log.Println("Expired review of charge", charge.Id, StatusName(charge.Status))
+	}
+
+	return nil
+}
+
+// settleReview captures an approved charge or voids any other, and closes its
+// review. A capture the gateway declines fails the charge.
+func (s *service) settleReview(charge *pb.Charge, st pb.ReviewStatus, reviewer, notes string) error {
+	paymentSvc, err := s.gateways.Service(charge.SourceId, charge.GatewayId, charge.Livemode)
+	if err != nil {
+		return err
+	}
+
+	var result *pb.Charge
+	if st == pb.ReviewStatus_REVIEW_STATUS_APPROVED {
+		result, err = paymentSvc.CaptureCharge(charge)
+	} else {
+		result, err = paymentSvc.VoidCharge(charge)
+	}
+
+	var declineErr *payments.DeclineError
+	if errors.As(err, &declineErr) {
+		result = &pb.Charge{Status: pb.ChargeStatus_CHARGE_STATUS_FAILED, Decline: declineErr.Decline}
+	} else if err != nil {
+		return err
+	}
+
+	charge.Status = result.Status
+	charge.Decline = result.Decline
+	charge.Review.Status = st
+	charge.Review.Reviewer = reviewer
+	charge.Review.Notes = notes
+	charge.Review.ReviewedAt = timestamppb.Now()
+
+	err = s.updateCharge(charge, pb.ChargeStatus_CHARGE_STATUS_HELD_FOR_REVIEW)
+	if err != nil {
+		return err
+	}
+
+	if declineErr != nil {
+		return declineErr
+	}
+
+	return nil
+}
+
+func (s *service) WatchCharges(customer *pb.Customer) (*Subscription, func()) {
+	return s.hub.Subscribe(customer.Id)
+}
+
+// updateCharge stores a status change and notifies watchers.
+func (s *service) updateCharge(charge *pb.Charge, from pb.ChargeStatus) error {
+	err := s.repo.UpdateCharge(charge, from)
+	if err != nil {
+		return err
+	}
+
+	s.hub.Publish(charge)
+
+	return nil
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
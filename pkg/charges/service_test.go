@@ -0,0 +1,250 @@
+package charges
+
+import (
+	"fmt"
+	"github.com/robertkohut/go-payments/internal/config"
+	"github.com/robertkohut/go-payments/pkg/payments"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"testing"
+	"time"
+)
+
+func TestRecoveryExpired(t *testing.T) {
+	now := time.Now()
+	age := 10 * time.Minute
+
+	tests := []struct {
+		created time.Time
+		expired bool
+	}{
+		{now.Add(-11 * time.Minute), false},
+		{now.Add(-19 * time.Minute), false},
+		{now.Add(-21 * time.Minute), true},
+	}
+
+	for _, tt := range tests {
+		charge := &pb.Charge{CreatedAt: timestamppb.New(tt.created)}
+		if got := recoveryExpired(charge, age, now); got != tt.expired {
+			t.Errorf("created %v ago: got %v, want %v", now.Sub(tt.created), got, tt.expired)
+		}
+	}
+}
+
+// chargeRepository holds charges in memory and answers the equality filters
+// GetCustomerCharge builds.
+type chargeRepository struct {
+	Repository
+	charges []*pb.Charge
+	updated []*pb.Charge
+}
+
+func (r *chargeRepository) SelectCharges(filter *pb.Filters) ([]*pb.Charge, error) {
+	var found []*pb.Charge
+
+	for _, c := range r.charges {
+		match := true
+		for _, f := range filter.GetFilters() {
+			switch f.Column {
+			case "customer_id":
+				match = match && c.CustomerId == int64(f.Value.GetNumberValue())
+			case "c.id":
+				match = match && c.Id == int64(f.Value.GetNumberValue())
+			case "c.ext_id":
+				match = match && c.ExtId == f.Value.GetStringValue()
+			default:
+				return nil, fmt.Errorf("unexpected filter on %s", f.Column)
+			}
+		}
+		if match {
+			found = append(found, proto.Clone(c).(*pb.Charge))
+		}
+	}
+
+	return found, nil
+}
+
+func (r *chargeRepository) UpdateChargeDetails(charge *pb.Charge) error {
+	r.updated = append(r.updated, charge)
+	return nil
+}
+
+func TestGetCustomerCharge(t *testing.T) {
+	repo := &chargeRepository{charges: []*pb.Charge{
+		{Id: 1, CustomerId: 1, ExtId: "pi_1"},
+		{Id: 2, CustomerId: 2, ExtId: "pi_2"},
+	}}
+	s := &service{repo: repo, hub: NewHub()}
+	customer := &pb.Customer{Id: 1}
+
+	charge, err := s.GetCustomerCharge(customer, 1, "")
+	if err != nil || charge.Id != 1 {
+		t.Errorf("Expected charge 1, got %v, %v", charge, err)
+	}
+
+	charge, err = s.GetCustomerCharge(customer, 0, "pi_1")
+	if err != nil || charge.Id != 1 {
+		t.Errorf("Expected charge 1 by its ext id, got %v, %v", charge, err)
+	}
+
+	// Another customer's charge is not found, by id or by ext id.
+	if _, err := s.GetCustomerCharge(customer, 2, ""); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for another customer's charge, got %v", err)
+	}
+
+	if _, err := s.GetCustomerCharge(customer, 0, "pi_2"); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for another customer's ext id, got %v", err)
+	}
+
+	if _, err := s.GetCustomerCharge(customer, 0, ""); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument without an id, got %v", err)
+	}
+}
+
+func TestUpdateChargeDetails(t *testing.T) {
+	update := &pb.Charge{Description: "New", Metadata: map[string]string{"order": "42"}, Amount: 1}
+
+	tests := []struct {
+		name  string
+		paths []string
+		code  codes.Code
+		want  *pb.Charge
+	}{
+		{"all", nil, codes.OK, &pb.Charge{Id: 1, Amount: 100, Description: "New", Metadata: map[string]string{"order": "42"}}},
+		{"description", []string{"description"}, codes.OK, &pb.Charge{Id: 1, Amount: 100, Description: "New", Metadata: map[string]string{"a": "b"}}},
+		{"metadata", []string{"metadata"}, codes.OK, &pb.Charge{Id: 1, Amount: 100, Description: "Old", Metadata: map[string]string{"order": "42"}}},
+		{"forbidden", []string{"description", "amount"}, codes.InvalidArgument, nil},
+		{"status", []string{"status"}, codes.InvalidArgument, nil},
+		{"unknown", []string{"nope"}, codes.InvalidArgument, nil},
+	}
+
+	for _, tt := range tests {
+		repo := &chargeRepository{}
+		s := &service{repo: repo, hub: NewHub()}
+		charge := &pb.Charge{Id: 1, Amount: 100, Description: "Old", Metadata: map[string]string{"a": "b"}}
+
+		got, err := s.UpdateChargeDetails(charge, update, tt.paths)
+		if status.Code(err) != tt.code {
+			t.Errorf("%s: got %v, want %s", tt.name, err, tt.code)
+			continue
+		}
+
+		if tt.want == nil {
+			if len(repo.updated) != 0 {
+				t.Errorf("%s: expected nothing to be saved, got %v", tt.name, repo.updated)
+			}
+			continue
+		}
+
+		if !proto.Equal(got, tt.want) || len(repo.updated) != 1 {
+			t.Errorf("%s: got %v, want %v saved once", tt.name, got, tt.want)
+		}
+	}
+
+	s := &service{repo: &chargeRepository{}, hub: NewHub()}
+	invalid := &pb.Charge{Metadata: map[string]string{"": "empty key"}}
+
+	if _, err := s.UpdateChargeDetails(&pb.Charge{Id: 1}, invalid, []string{"metadata"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for invalid metadata, got %v", err)
+	}
+}
+
+func (r *chargeRepository) SelectPendingCharges(before time.Time) ([]*pb.Charge, error) {
+	return r.charges, nil
+}
+
+func (r *chargeRepository) UpdateCharge(charge *pb.Charge, from pb.ChargeStatus) error {
+	if err := ValidateTransition(from, charge.Status); err != nil {
+		return err
+	}
+	r.updated = append(r.updated, proto.Clone(charge).(*pb.Charge))
+	return nil
+}
+
+// recoveryGateway reports charges in the statuses it holds by idempotency
+// key and records voided charges.
+type recoveryGateway struct {
+	payments.PaymentService
+	statuses map[string]pb.ChargeStatus
+	voided   []string
+}
+
+func (g *recoveryGateway) FindCharge(charge *pb.Charge) (*pb.Charge, error) {
+	st, ok := g.statuses[charge.IdempotencyKey]
+	if !ok {
+		return nil, nil
+	}
+	return &pb.Charge{ExtId: "pi_" + charge.IdempotencyKey, Status: st}, nil
+}
+
+func (g *recoveryGateway) VoidCharge(charge *pb.Charge) (*pb.Charge, error) {
+	g.voided = append(g.voided, charge.ExtId)
+	return &pb.Charge{ExtId: charge.ExtId, Status: pb.ChargeStatus_CHARGE_STATUS_CANCELED}, nil
+}
+
+func TestRecoverPendingCharges(t *testing.T) {
+	now := time.Now()
+	fresh := timestamppb.New(now.Add(-time.Hour))
+	stale := timestamppb.New(now.Add(-48 * time.Hour))
+
+	pending := pb.ChargeStatus_CHARGE_STATUS_PENDING
+	action := pb.ChargeStatus_CHARGE_STATUS_REQUIRES_ACTION
+
+	repo := &chargeRepository{charges: []*pb.Charge{
+		{Id: 1, IdempotencyKey: "succeeded", Status: pending, CreatedAt: fresh},
+		{Id: 2, IdempotencyKey: "waiting", Status: action, CreatedAt: fresh},
+		{Id: 3, IdempotencyKey: "abandoned", Status: action, CreatedAt: stale},
+		{Id: 4, IdempotencyKey: "authenticated", Status: action, CreatedAt: stale},
+		{Id: 5, IdempotencyKey: "challenged", Status: pending, CreatedAt: fresh},
+		{Id: 6, IdempotencyKey: "unseen", Status: pending, CreatedAt: fresh},
+	}}
+
+	gateway := &recoveryGateway{statuses: map[string]pb.ChargeStatus{
+		"succeeded":     pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED,
+		"waiting":       action,
+		"abandoned":     action,
+		"authenticated": pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED,
+		"challenged":    action,
+	}}
+
+	s := &service{
+		gateways: payments.NewStaticRegistry(gateway),
+		repo:     repo,
+		hub:      NewHub(),
+		cfg:      &config.ChargesConfig{ActionExpiry: 24 * time.Hour},
+	}
+
+	if err := s.RecoverPendingCharges(10 * time.Minute); err != nil {
+		t.Fatalf("Could not recover charges: %v", err)
+	}
+
+	want := map[int64]pb.ChargeStatus{
+		1: pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED,
+		3: pb.ChargeStatus_CHARGE_STATUS_CANCELED,
+		4: pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED,
+		5: action,
+		6: pb.ChargeStatus_CHARGE_STATUS_FAILED,
+	}
+
+	got := map[int64]pb.ChargeStatus{}
+	for _, c := range repo.updated {
+		got[c.Id] = c.Status
+	}
+
+	for id, st := range want {
+		if got[id] != st {
+			t.Errorf("charge %d: got %s, want %s", id, StatusName(got[id]), StatusName(st))
+		}
+	}
+
+	if len(got) != len(want) {
+		t.Errorf("Expected charge 2 to be left waiting, got updates %v", got)
+	}
+
+	if len(gateway.voided) != 1 || gateway.voided[0] != "pi_abandoned" {
+		t.Errorf("Expected only the abandoned charge to be voided, got %v", gateway.voided)
+	}
+}
@@ -0,0 +1,103 @@
+package charges
+
+import (
+	"fmt"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+const statusPrefix = "CHARGE_STATUS_"
+
+// transitions lists the statuses a charge may move to from each status.
+// Statuses without an entry are final.
+var transitions = map[pb.ChargeStatus][]pb.ChargeStatus{
+	pb.ChargeStatus_CHARGE_STATUS_UNSPECIFIED: {
+		pb.ChargeStatus_CHARGE_STATUS_PENDING,
+	},
+	pb.ChargeStatus_CHARGE_STATUS_PENDING: {
+		pb.ChargeStatus_CHARGE_STATUS_REQUIRES_ACTION,
+		pb.ChargeStatus_CHARGE_STATUS_AUTHORIZED,
+		pb.ChargeStatus_CHARGE_STATUS_HELD_FOR_REVIEW,
+		pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED,
+		pb.ChargeStatus_CHARGE_STATUS_FAILED,
+		pb.ChargeStatus_CHARGE_STATUS_CANCELED,
+	},
+	pb.ChargeStatus_CHARGE_STATUS_REQUIRES_ACTION: {
+		pb.ChargeStatus_CHARGE_STATUS_PENDING,
+		pb.ChargeStatus_CHARGE_STATUS_AUTHORIZED,
+		pb.ChargeStatus_CHARGE_STATUS_HELD_FOR_REVIEW,
+		pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED,
+		pb.ChargeStatus_CHARGE_STATUS_FAILED,
+		pb.ChargeStatus_CHARGE_STATUS_CANCELED,
+	},
+	pb.ChargeStatus_CHARGE_STATUS_AUTHORIZED: {
+		pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED,
+		pb.ChargeStatus_CHARGE_STATUS_FAILED,
+		pb.ChargeStatus_CHARGE_STATUS_CANCELED,
+	},
+	pb.ChargeStatus_CHARGE_STATUS_HELD_FOR_REVIEW: {
+		pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED,
+		pb.ChargeStatus_CHARGE_STATUS_FAILED,
+		pb.ChargeStatus_CHARGE_STATUS_CANCELED,
+	},
+	pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED: {
+		pb.ChargeStatus_CHARGE_STATUS_REFUNDED,
+		pb.ChargeStatus_CHARGE_STATUS_PARTIALLY_REFUNDED,
+		pb.ChargeStatus_CHARGE_STATUS_DISPUTED,
+	},
+	pb.ChargeStatus_CHARGE_STATUS_PARTIALLY_REFUNDED: {
+		pb.ChargeStatus_CHARGE_STATUS_PARTIALLY_REFUNDED,
+		pb.ChargeStatus_CHARGE_STATUS_REFUNDED,
+		pb.ChargeStatus_CHARGE_STATUS_DISPUTED,
+	},
+	pb.ChargeStatus_CHARGE_STATUS_DISPUTED: {
+		pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED,
+		pb.ChargeStatus_CHARGE_STATUS_REFUNDED,
+	},
+}
+
+// ValidateTransition reports whether a charge may move from one status to
+// another. Keeping the same status is always allowed.
+func ValidateTransition(from, to pb.ChargeStatus) error {
+	if from == to {
+		return nil
+	}
+
+	for _, next := range transitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+
+	return status.Errorf(codes.FailedPrecondition, "invalid charge status transition: %s -> %s", StatusName(from), StatusName(to))
+}
+
+// IsFinal reports whether no further transitions are possible from a status.
+func IsFinal(st pb.ChargeStatus) bool {
+	return len(transitions[st]) == 0
+}
+
+// StatusName returns the lowercase name stored in the charges table, e.g. "succeeded".
+func StatusName(st pb.ChargeStatus) string {
+	if st == pb.ChargeStatus_CHARGE_STATUS_UNSPECIFIED {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimPrefix(st.String(), statusPrefix))
+}
+
+// ParseStatus converts a name stored by StatusName back into a ChargeStatus.
+func ParseStatus(name string) (pb.ChargeStatus, error) {
+	if name == "" {
+		return pb.ChargeStatus_CHARGE_STATUS_UNSPECIFIED, nil
+	}
+
+	st, ok := pb.ChargeStatus_value[statusPrefix+strings.ToUpper(name)]
+	if !ok {
+		return pb.ChargeStatus_CHARGE_STATUS_UNSPECIFIED, fmt.Errorf("unknown charge status %q", name)
+	}
+
+	return pb.ChargeStatus(st), nil
+}
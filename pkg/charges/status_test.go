@@ -0,0 +1,53 @@
+package charges
+
+import (
+	pb "github.com/robertkohut/go-payments/proto"
+	"testing"
+)
+
+func TestValidateTransition(t *testing.T) {
+	tests := []struct {
+		from, to pb.ChargeStatus
+		valid    bool
+	}{
+		{pb.ChargeStatus_CHARGE_STATUS_UNSPECIFIED, pb.ChargeStatus_CHARGE_STATUS_PENDING, true},
+		{pb.ChargeStatus_CHARGE_STATUS_PENDING, pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED, true},
+		{pb.ChargeStatus_CHARGE_STATUS_PENDING, pb.ChargeStatus_CHARGE_STATUS_PENDING, true},
+		{pb.ChargeStatus_CHARGE_STATUS_AUTHORIZED, pb.ChargeStatus_CHARGE_STATUS_CANCELED, true},
+		{pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED, pb.ChargeStatus_CHARGE_STATUS_PARTIALLY_REFUNDED, true},
+		{pb.ChargeStatus_CHARGE_STATUS_PENDING, pb.ChargeStatus_CHARGE_STATUS_HELD_FOR_REVIEW, true},
+		{pb.ChargeStatus_CHARGE_STATUS_HELD_FOR_REVIEW, pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED, true},
+		{pb.ChargeStatus_CHARGE_STATUS_HELD_FOR_REVIEW, pb.ChargeStatus_CHARGE_STATUS_CANCELED, true},
+		{pb.ChargeStatus_CHARGE_STATUS_HELD_FOR_REVIEW, pb.ChargeStatus_CHARGE_STATUS_PENDING, false},
+		{pb.ChargeStatus_CHARGE_STATUS_FAILED, pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED, false},
+		{pb.ChargeStatus_CHARGE_STATUS_REFUNDED, pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED, false},
+		{pb.ChargeStatus_CHARGE_STATUS_PENDING, pb.ChargeStatus_CHARGE_STATUS_REFUNDED, false},
+		{pb.ChargeStatus_CHARGE_STATUS_UNSPECIFIED, pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED, false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateTransition(tt.from, tt.to)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s -> %s: got err %v, want valid %v", tt.from, tt.to, err, tt.valid)
+		}
+	}
+}
+
+func TestStatusNameRoundTrip(t *testing.T) {
+	for value := range pb.ChargeStatus_name {
+		st := pb.ChargeStatus(value)
+
+		parsed, err := ParseStatus(StatusName(st))
+		if err != nil {
+			t.Fatalf("Could not parse status %s: %v", st, err)
+		}
+
+		if parsed != st {
+			t.Errorf("got %s, want %s", parsed, st)
+		}
+	}
+
+	if StatusName(pb.ChargeStatus_CHARGE_STATUS_PARTIALLY_REFUNDED) != "partially_refunded" {
+		t.Errorf("unexpected status name %q", StatusName(pb.ChargeStatus_CHARGE_STATUS_PARTIALLY_REFUNDED))
+	}
+}
@@ -0,0 +1,125 @@
+package customers
+
+import (
+	"fmt"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/protobuf/proto"
+	"strings"
+)
+
+const (
+	fundingPrefix   = "CARD_FUNDING_"
+	walletPrefix    = "CARD_WALLET_"
+	cardCheckPrefix = "CARD_CHECK_"
+)
+
+// FundingName returns the lowercase name stored in the cards table, e.g.
+// "debit", or "" if the gateway did not report it.
+func FundingName(funding pb.CardFunding) string {
+	return enumName(funding.String(), fundingPrefix, funding == pb.CardFunding_CARD_FUNDING_UNSPECIFIED)
+}
+
+// ParseFunding converts a name stored by FundingName back into a CardFunding.
+func ParseFunding(name string) (pb.CardFunding, error) {
+	v, err := parseEnum(name, fundingPrefix, pb.CardFunding_value)
+	return pb.CardFunding(v), err
+}
+
+// WalletName returns the lowercase name stored in the cards table, e.g.
+// "apple_pay", or "" if the card was not added from a wallet.
+func WalletName(wallet pb.CardWallet) string {
+	return enumName(wallet.String(), walletPrefix, wallet == pb.CardWallet_CARD_WALLET_UNSPECIFIED)
+}
+
+// ParseWallet converts a name stored by WalletName back into a CardWallet.
+func ParseWallet(name string) (pb.CardWallet, error) {
+	v, err := parseEnum(name, walletPrefix, pb.CardWallet_value)
+	return pb.CardWallet(v), err
+}
+
+// CardCheckName returns the lowercase name stored in the cards table, e.g.
+// "pass", or "" if nothing was checked.
+func CardCheckName(check pb.CardCheck) string {
+	return enumName(check.String(), cardCheckPrefix, check == pb.CardCheck_CARD_CHECK_UNSPECIFIED)
+}
+
+// ParseCardCheck converts a name stored by CardCheckName back into a
+// CardCheck.
+func ParseCardCheck(name string) (pb.CardCheck, error) {
+	v, err := parseEnum(name, cardCheckPrefix, pb.CardCheck_value)
+	return pb.CardCheck(v), err
+}
+
+func enumName(name, prefix string, unspecified bool) string {
+	if unspecified {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimPrefix(name, prefix))
+}
+
+// parseEnum looks up a stored name in the value map of a proto enum. The
+// empty name is the unspecified value.
+func parseEnum(name, prefix string, values map[string]int32) (int32, error) {
+	if name == "" {
+		return 0, nil
+	}
+
+	v, ok := values[prefix+strings.ToUpper(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown %s %q", strings.ToLower(strings.TrimSuffix(prefix, "_")), name)
+	}
+
+	return v, nil
+}
+
+// applyVaulted copies what the gateway reported about a card it vaulted onto
+// card, which otherwise only holds what the client sent.
+func applyVaulted(card, vaulted *pb.Card) {
+	// Some gateways vault the payment method under a new token.
+	if vaulted.GetExtId() != "" {
+		card.ExtId = vaulted.GetExtId()
+	}
+
+	card.Brand = vaulted.GetBrand()
+	card.Last4 = vaulted.GetLast4()
+	card.ExpMonth = vaulted.GetExpMonth()
+	card.ExpYear = vaulted.GetExpYear()
+	card.NetworkToken = vaulted.GetNetworkToken()
+	card.Bin = vaulted.GetBin()
+	card.Country = vaulted.GetCountry()
+	card.Fingerprint = vaulted.GetFingerprint()
+	card.Funding = vaulted.GetFunding()
+	card.Wallet = vaulted.GetWallet()
+	card.CvcCheck = vaulted.GetCvcCheck()
+	card.PostalCodeCheck = vaulted.GetPostalCodeCheck()
+	card.Mandate = vaulted.GetMandate()
+	card.SetupIntentId = vaulted.GetSetupIntentId()
+}
+
+// redactCard returns a copy of card without what it can be charged with, for
+// responses and event payloads. Only the charge path reads the network token
+// and mandate, through SelectCardCredentials.
+func redactCard(card *pb.Card) *pb.Card {
+	redacted := proto.Clone(card).(*pb.Card)
+	redacted.NetworkToken = ""
+	redacted.Mandate = ""
+
+	return redacted
+}
+
+// findDuplicate returns the card in cards with the same fingerprint as card,
+// or nil if there is none or the gateway reported no fingerprint.
+func findDuplicate(cards []*pb.Card, card *pb.Card) *pb.Card {
+	if card.GetFingerprint() == "" {
+		return nil
+	}
+
+	for _, c := range cards {
+		if c.GetFingerprint() == card.GetFingerprint() {
+			return c
+		}
+	}
+
+	return nil
+}
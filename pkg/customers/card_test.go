@@ -0,0 +1,70 @@
+package customers
+
+import (
+	pb "github.com/robertkohut/go-payments/proto"
+	"testing"
+)
+
+func TestCardDetailNames(t *testing.T) {
+	if name := FundingName(pb.CardFunding_CARD_FUNDING_DEBIT); name != "debit" {
+		t.Errorf("Expected the lowercase funding name, got %q", name)
+	}
+
+	if name := WalletName(pb.CardWallet_CARD_WALLET_UNSPECIFIED); name != "" {
+		t.Errorf("Expected no wallet to be stored as empty, got %q", name)
+	}
+
+	wallet, err := ParseWallet(WalletName(pb.CardWallet_CARD_WALLET_AMEX_EXPRESS_CHECKOUT))
+	if err != nil || wallet != pb.CardWallet_CARD_WALLET_AMEX_EXPRESS_CHECKOUT {
+		t.Errorf("Expected the wallet to round trip, got %s, %v", wallet, err)
+	}
+
+	check, err := ParseCardCheck("")
+	if err != nil || check != pb.CardCheck_CARD_CHECK_UNSPECIFIED {
+		t.Errorf("Expected an empty check to be unspecified, got %s, %v", check, err)
+	}
+
+	if _, err := ParseFunding("charge"); err == nil {
+		t.Errorf("Expected an error for an unknown funding type")
+	}
+}
+
+func TestApplyVaultedAndFindDuplicate(t *testing.T) {
+	card := &pb.Card{ExtId: "pm_1"}
+
+	applyVaulted(card, &pb.Card{
+		Brand:       "visa",
+		Last4:       "4242",
+		ExpMonth:    4,
+		ExpYear:     2031,
+		Fingerprint: "fp_1",
+		Funding:     pb.CardFunding_CARD_FUNDING_CREDIT,
+	})
+
+	if card.ExtId != "pm_1" || card.ExpYear != 2031 || card.Funding != pb.CardFunding_CARD_FUNDING_CREDIT {
+		t.Errorf("Expected the gateway's details on the card, got %v", card)
+	}
+
+	cards := []*pb.Card{{Id: 1, Fingerprint: "fp_2"}, {Id: 2, Fingerprint: "fp_1"}}
+
+	if dup := findDuplicate(cards, card); dup == nil || dup.Id != 2 {
+		t.Errorf("Expected card 2 as the duplicate, got %v", dup)
+	}
+
+	if dup := findDuplicate([]*pb.Card{{Id: 3}}, &pb.Card{}); dup != nil {
+		t.Errorf("Expected cards without a fingerprint never to be duplicates, got %v", dup)
+	}
+}
+
+func TestRedactCard(t *testing.T) {
+	card := &pb.Card{Id: 1, Last4: "4242", NetworkToken: "ntok_1", Mandate: "mandate_1"}
+
+	redacted := redactCard(card)
+	if redacted.NetworkToken != "" || redacted.Mandate != "" || redacted.Id != 1 || redacted.Last4 != "4242" {
+		t.Errorf("Expected only the network token and mandate to be cleared, got %v", redacted)
+	}
+
+	if card.NetworkToken != "ntok_1" {
+		t.Errorf("Expected the card to be left as is, got %v", card)
+	}
+}
@@ -0,0 +1,186 @@
+package customers
+
+import (
+	"github.com/robertkohut/go-payments/pkg/payments"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"testing"
+)
+
+// updatingRepository records saved customers.
+type updatingRepository struct {
+	Repository
+	saved []*pb.Customer
+}
+
+func (r *updatingRepository) UpdateCustomer(customer *pb.Customer) error {
+	r.saved = append(r.saved, proto.Clone(customer).(*pb.Customer))
+	return nil
+}
+
+// updatingGateway records customers synced to the gateway.
+type updatingGateway struct {
+	payments.PaymentService
+	synced []*pb.Customer
+}
+
+func (g *updatingGateway) UpdateCustomer(customer *pb.Customer) error {
+	g.synced = append(g.synced, proto.Clone(customer).(*pb.Customer))
+	return nil
+}
+
+func TestUpdateCustomer(t *testing.T) {
+	update := &pb.Customer{
+		Name:     "New",
+		Email:    "new@example.com",
+		Phone:    "+1 555 010 0000",
+		Address:  &pb.Address{Line1: "1 Main St", Country: "US"},
+		Metadata: map[string]string{"plan": "pro"},
+		SourceId: 99,
+	}
+
+	tests := []struct {
+		name  string
+		paths []string
+		code  codes.Code
+		check func(c *pb.Customer) bool
+	}{
+		{"all", nil, codes.OK, func(c *pb.Customer) bool {
+			return c.Name == "New" && c.Email == "new@example.com" && c.Phone == "+1 555 010 0000" &&
+				c.Address.GetLine1() == "1 Main St" && c.Metadata["plan"] == "pro" && c.SourceId == 1
+		}},
+		{"email", []string{"email"}, codes.OK, func(c *pb.Customer) bool {
+			return c.Email == "new@example.com" && c.Name == "Old" && c.Phone == ""
+		}},
+		{"name and phone", []string{"name", "phone"}, codes.OK, func(c *pb.Customer) bool {
+			return c.Name == "New" && c.Phone == "+1 555 010 0000" && c.Email == "old@example.com"
+		}},
+		{"address", []string{"address"}, codes.OK, func(c *pb.Customer) bool {
+			return c.Address.GetCountry() == "US" && c.Metadata == nil
+		}},
+		{"source", []string{"source_id"}, codes.InvalidArgument, nil},
+		{"unknown", []string{"name", "nope"}, codes.InvalidArgument, nil},
+	}
+
+	for _, tt := range tests {
+		repo := &updatingRepository{}
+		gateway := &updatingGateway{}
+		s := &service{gateways: payments.NewStaticRegistry(gateway), repo: repo}
+		customer := &pb.Customer{Id: 1, SourceId: 1, Name: "Old", Email: "old@example.com"}
+
+		got, err := s.UpdateCustomer(customer, update, tt.paths)
+		if status.Code(err) != tt.code {
+			t.Errorf("%s: got %v, want %s", tt.name, err, tt.code)
+			continue
+		}
+
+		if tt.check == nil {
+			if len(repo.saved) != 0 || len(gateway.synced) != 0 {
+				t.Errorf("%s: expected nothing to be saved or synced", tt.name)
+			}
+			continue
+		}
+
+		if !tt.check(got) || len(repo.saved) != 1 || len(gateway.synced) != 1 {
+			t.Errorf("%s: got %v, saved %d times, synced %d times", tt.name, got, len(repo.saved), len(gateway.synced))
+		}
+	}
+}
+
+func TestValidateCustomer(t *testing.T) {
+	tests := []struct {
+		name     string
+		customer *pb.Customer
+		valid    bool
+	}{
+		{"empty", &pb.Customer{}, true},
+		{"email", &pb.Customer{Email: "Jane Doe <jane@example.com>"}, true},
+		{"bad email", &pb.Customer{Email: "jane"}, false},
+		{"bad email domain", &pb.Customer{Email: "jane@"}, false},
+		{"phone", &pb.Customer{Phone: "+44 (20) 7946-0000"}, true},
+		{"short phone", &pb.Customer{Phone: "12345"}, false},
+		{"long phone", &pb.Customer{Phone: "+1234567890123456"}, false},
+		{"letters in phone", &pb.Customer{Phone: "555-CALL-NOW"}, false},
+		{"plus inside phone", &pb.Customer{Phone: "555+0100000"}, false},
+		{"country", &pb.Customer{Address: &pb.Address{Country: "DE"}}, true},
+		{"long country", &pb.Customer{Address: &pb.Address{Country: "DEU"}}, false},
+		{"metadata", &pb.Customer{Metadata: map[string]string{"": "x"}}, false},
+	}
+
+	for _, tt := range tests {
+		err := validateCustomer(tt.customer)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: got err %v, want valid %v", tt.name, err, tt.valid)
+		}
+
+		if err != nil && status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: expected InvalidArgument, got %v", tt.name, err)
+		}
+	}
+}
+
+// searchingRepository records the page SearchCustomers asks for.
+type searchingRepository struct {
+	Repository
+	limit, offset int64
+}
+
+func (r *searchingRepository) SelectCustomers(_ *pb.CustomerFilter, _ bool, _, _ string, limit, offset int64) ([]*pb.Customer, int64, error) {
+	r.limit, r.offset = limit, offset
+	return nil, 0, nil
+}
+
+func (r *searchingRepository) SelectCustomerSummaries([]*pb.Customer) ([]*pb.CustomerSummary, error) {
+	return nil, nil
+}
+
+func TestSearchCustomersPaging(t *testing.T) {
+	tests := []struct {
+		limit, offset int64
+		wantLimit     int64
+		code          codes.Code
+	}{
+		{0, 0, defaultListLimit, codes.OK},
+		{-5, 10, defaultListLimit, codes.OK},
+		{20, 40, 20, codes.OK},
+		{maxListLimit + 1, 0, maxListLimit, codes.OK},
+		{10, -1, 0, codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		repo := &searchingRepository{}
+		s := &service{repo: repo}
+
+		_, _, err := s.SearchCustomers(nil, false, "", "", tt.limit, tt.offset)
+		if status.Code(err) != tt.code {
+			t.Errorf("limit %d, offset %d: got %v, want %s", tt.limit, tt.offset, err, tt.code)
+			continue
+		}
+
+		if err == nil && (repo.limit != tt.wantLimit || repo.offset != tt.offset) {
+			t.Errorf("limit %d, offset %d: got limit %d, offset %d", tt.limit, tt.offset, repo.limit, repo.offset)
+		}
+	}
+}
+
+func TestContainsPattern(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"jane", "%jane%"},
+		{"", "%%"},
+		{"100%", `%100\%%`},
+		{"j_ne", `%j\_ne%`},
+		{`a\b`, `%a\\b%`},
+		{`%_\`, `%\%\_\\%`},
+		{"' OR 1=1 --", "%' OR 1=1 --%"},
+	}
+
+	for _, tt := range tests {
+		if got := containsPattern(tt.in); got != tt.want {
+			t.Errorf("containsPattern(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
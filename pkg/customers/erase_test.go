@@ -0,0 +1,116 @@
+package customers
+
+import (
+	"fmt"
+	"github.com/robertkohut/go-payments/pkg/payments"
+	pb "github.com/robertkohut/go-payments/proto"
+	"strings"
+	"testing"
+)
+
+// erasingRepository records erased customers and cards left to detach.
+type erasingRepository struct {
+	Repository
+	erased  map[int64]bool
+	pending []*PendingDetach
+}
+
+func (r *erasingRepository) EraseCustomer(customer *pb.Customer, undetached []*pb.Card) error {
+	r.erased[customer.Id] = true
+	for _, c := range undetached {
+		r.pending = append(r.pending, &PendingDetach{Customer: customer, Card: c})
+	}
+	return nil
+}
+
+func (r *erasingRepository) SelectUndetachedCards(limit int) ([]*PendingDetach, error) {
+	return r.pending, nil
+}
+
+func (r *erasingRepository) MarkCardDetached(card *pb.Card) error {
+	var pending []*PendingDetach
+	for _, p := range r.pending {
+		if p.Card.Id != card.Id {
+			pending = append(pending, p)
+		}
+	}
+	r.pending = pending
+	return nil
+}
+
+// unreachableGateway cannot detach the cards in down.
+type unreachableGateway struct {
+	payments.PaymentService
+	down     map[int64]bool
+	detached []int64
+}
+
+func (g *unreachableGateway) RemoveCustomerPaymentMethod(_ *pb.Customer, card *pb.Card) error {
+	if g.down[card.Id] {
+		return fmt.Errorf("detach: %w", payments.ErrUnavailable)
+	}
+	g.detached = append(g.detached, card.Id)
+	return nil
+}
+
+func (g *unreachableGateway) DeleteCustomer(*pb.Customer) error {
+	return nil
+}
+
+func TestEraseCustomerRetriesDetach(t *testing.T) {
+	repo := &erasingRepository{erased: map[int64]bool{}}
+	gateway := &unreachableGateway{down: map[int64]bool{12: true}}
+
+	s := &service{gateways: payments.NewStaticRegistry(gateway), repo: repo}
+	customer := &pb.Customer{Id: 1, Cards: []*pb.Card{{Id: 11}, {Id: 12}}}
+
+	if err := s.EraseCustomer(customer); err != nil {
+		t.Fatalf("Expected the customer to be erased despite the failed detach, got %v", err)
+	}
+
+	if !repo.erased[1] || len(repo.pending) != 1 || repo.pending[0].Card.Id != 12 {
+		t.Fatalf("Expected card 12 to be left to detach, got %v", repo.pending)
+	}
+
+	if err := s.RetryCardDetaches(); err != nil {
+		t.Fatalf("Could not retry detaches: %v", err)
+	}
+
+	if len(repo.pending) != 1 {
+		t.Errorf("Expected card 12 to stay pending while the gateway is down")
+	}
+
+	gateway.down = nil
+
+	if err := s.RetryCardDetaches(); err != nil {
+		t.Fatalf("Could not retry detaches: %v", err)
+	}
+
+	if len(repo.pending) != 0 || len(gateway.detached) != 2 {
+		t.Errorf("Expected card 12 to be detached, got %v", gateway.detached)
+	}
+}
+
+func TestEraseCardsStmt(t *testing.T) {
+	stmt := eraseCardsStmt()
+
+	for _, column := range []string{"last_four", "fingerprint", "network_token", "bin", "country", "mandate", "setup_intent_id"} {
+		if !strings.Contains(stmt, column+" = ''") {
+			t.Errorf("Expected an erase to blank %s, got %s", column, stmt)
+		}
+	}
+
+	for _, column := range []string{"exp_month", "exp_year"} {
+		if !strings.Contains(stmt, column+" = 0") {
+			t.Errorf("Expected an erase to clear %s, got %s", column, stmt)
+		}
+	}
+
+	if !strings.Contains(stmt, "ext_id = IF((flags & ?) = ?, ext_id, '')") {
+		t.Errorf("Expected an erase to blank the tokens of detached cards, got %s", stmt)
+	}
+
+	if n := strings.Count(stmt, "?"); n != 4 {
+		t.Errorf("Expected 4 placeholders to match EraseCustomer's arguments, got %d", n)
+	}
+}
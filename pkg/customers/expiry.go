@@ -0,0 +1,148 @@
+package customers
+
+import (
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log"
+	"time"
+)
+
+// expiryMonth counts months so that a card expiring in month m of year y
+// expires at the start of month y*12+m, the month after its expiry month.
+func expiryMonth(t time.Time) int {
+	t = t.UTC()
+	return t.Year()*12 + int(t.Month()) - 1
+}
+
+// cardExpiresAt returns the end of a card's expiry month, the first moment
+// it can no longer be charged.
+func cardExpiresAt(card *pb.Card) time.Time {
+	return time.Date(int(card.GetExpYear()), time.Month(card.GetExpMonth())+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// cardExpired reports whether a card has expired at now. Cards with no known
+// expiry date never expire.
+func cardExpired(card *pb.Card, now time.Time) bool {
+	return card.GetExpYear() > 0 && !cardExpiresAt(card).After(now)
+}
+
+func (s *service) ListExpiringCards(sourceId int64, livemode bool, days int32, includeExpired bool, limit, offset int64) ([]*pb.ExpiringCard, error) {
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	if offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "offset must not be negative")
+	}
+
+	now := time.Now()
+
+	window := s.cfg.ExpiryWindow
+	if days > 0 {
+		window = time.Duration(days) * 24 * time.Hour
+	}
+
+	after := expiryMonth(now)
+	if includeExpired {
+		after = 0
+	}
+
+	cards, err := s.repo.SelectExpiringCards(sourceId, livemode, after, expiryMonth(now.Add(window)), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range cards {
+		setExpiry(c, now)
+	}
+
+	return cards, nil
+}
+
+// NotifyExpiringCards emits a card.expiring event for each customer with
+// cards expiring within the expiry window, once per card and expiry date.
+// Customers whose primary card has expired get the fallback card as their
+// primary card, announced in the same event.
+func (s *service) NotifyExpiringCards() error {
+	now := time.Now()
+
+	toNotify, err := s.repo.SelectCardsToNotify(expiryMonth(now.Add(s.cfg.ExpiryWindow)))
+	if err != nil {
+		return err
+	}
+
+	expiredPrimaries, err := s.repo.SelectExpiredPrimaryCards(expiryMonth(now))
+	if err != nil {
+		return err
+	}
+
+	var customerIds []int64
+	byCustomer := map[int64]*pb.ExpiringCards{}
+
+	add := func(c *pb.ExpiringCard) {
+		data, ok := byCustomer[c.CustomerId]
+		if !ok {
+			data = &pb.ExpiringCards{}
+			byCustomer[c.CustomerId] = data
+			customerIds = append(customerIds, c.CustomerId)
+		}
+
+		for _, added := range data.Cards {
+			if added.GetCard().GetId() == c.GetCard().GetId() {
+				return
+			}
+		}
+
+		setExpiry(c, now)
+		data.Cards = append(data.Cards, c)
+	}
+
+	for _, c := range toNotify {
+		add(c)
+	}
+
+	replacements := map[int64]*pb.Card{}
+
+	for _, c := range expiredPrimaries {
+		cards, err := s.repo.SelectCustomerCards(&pb.Customer{Id: c.CustomerId})
+		if err != nil {
+			return err
+		}
+
+		replacement := primaryFallback(cards, c.Card.Id, now)
+		if replacement == nil {
+			// Nothing to switch to; the customer is told once, when the card
+			// first comes up for notification.
+			continue
+		}
+
+		replacements[c.CustomerId] = replacement
+		add(c)
+	}
+
+	for _, customerId := range customerIds {
+		data := byCustomer[customerId]
+
+		replacement := replacements[customerId]
+		if replacement != nil {
+			data.PrimaryCardId = replacement.IdStr
+			log.Println("Replacing expired primary card of customer", customerId, "with", replacement.Id)
+		}
+
+		err := s.repo.InsertCardsExpiring(customerId, data, replacement)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setExpiry(c *pb.ExpiringCard, now time.Time) {
+	c.ExpiresAt = timestamppb.New(cardExpiresAt(c.Card))
+	c.Expired = cardExpired(c.Card, now)
+}
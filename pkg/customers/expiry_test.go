@@ -0,0 +1,154 @@
+package customers
+
+import (
+	"github.com/robertkohut/go-payments/internal/config"
+	pb "github.com/robertkohut/go-payments/proto"
+	"testing"
+	"time"
+)
+
+type memoryRepository struct {
+	Repository
+	cards    map[int64][]*pb.Card
+	primary  map[int64]int64
+	notified map[int64]bool
+	events   map[int64]*pb.ExpiringCards
+}
+
+func (r *memoryRepository) expiring(fn func(customerId int64, card *pb.Card) bool) []*pb.ExpiringCard {
+	var cards []*pb.ExpiringCard
+	for customerId, customerCards := range r.cards {
+		for _, c := range customerCards {
+			if c.ExpYear > 0 && fn(customerId, c) {
+				cards = append(cards, &pb.ExpiringCard{CustomerId: customerId, Card: c, Primary: r.primary[customerId] == c.Id})
+			}
+		}
+	}
+	return cards
+}
+
+func (r *memoryRepository) SelectCardsToNotify(through int) ([]*pb.ExpiringCard, error) {
+	return r.expiring(func(_ int64, c *pb.Card) bool {
+		return !r.notified[c.Id] && int(c.ExpYear)*12+int(c.ExpMonth) <= through
+	}), nil
+}
+
+func (r *memoryRepository) SelectExpiredPrimaryCards(through int) ([]*pb.ExpiringCard, error) {
+	return r.expiring(func(customerId int64, c *pb.Card) bool {
+		return r.primary[customerId] == c.Id && int(c.ExpYear)*12+int(c.ExpMonth) <= through
+	}), nil
+}
+
+func (r *memoryRepository) SelectCustomerCards(customer *pb.Customer) ([]*pb.Card, error) {
+	return r.cards[customer.Id], nil
+}
+
+func (r *memoryRepository) UpdateCustomerPrimaryCard(customer *pb.Customer, card *pb.Card) error {
+	r.primary[customer.Id] = card.Id
+	customer.PrimaryCardId = card.Id
+	return nil
+}
+
+func (r *memoryRepository) DeleteCustomerCard(customer *pb.Customer, card *pb.Card, replacement *pb.Card) error {
+	var cards []*pb.Card
+	for _, c := range r.cards[customer.Id] {
+		if c.Id != card.Id {
+			cards = append(cards, c)
+		}
+	}
+	r.cards[customer.Id] = cards
+
+	if r.primary[customer.Id] == card.Id {
+		r.primary[customer.Id] = replacement.GetId()
+		customer.PrimaryCardId = replacement.GetId()
+	}
+	return nil
+}
+
+func (r *memoryRepository) InsertCardsExpiring(customerId int64, data *pb.ExpiringCards, primary *pb.Card) error {
+	if primary != nil {
+		r.primary[customerId] = primary.Id
+	}
+	for _, c := range data.Cards {
+		r.notified[c.Card.Id] = true
+	}
+	r.events[customerId] = data
+	return nil
+}
+
+// expiring returns a card that expires at the end of the month months from
+// now, negative for cards that have expired.
+func expiring(id int64, months int) *pb.Card {
+	t := time.Now().UTC().AddDate(0, months, 0)
+	t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return &pb.Card{Id: id, IdStr: "card", ExpMonth: uint32(t.Month()), ExpYear: uint32(t.Year())}
+}
+
+func TestCardExpiry(t *testing.T) {
+	now := time.Date(2026, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+	card := &pb.Card{ExpMonth: 3, ExpYear: 2026}
+	if !cardExpiresAt(card).Equal(time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the card to expire at the end of March, got %v", cardExpiresAt(card))
+	}
+
+	if cardExpired(card, now) || !cardExpired(card, now.AddDate(0, 1, 0)) {
+		t.Errorf("Expected the card to be valid through March only")
+	}
+
+	if expiryMonth(now) != 2026*12+2 || expiryMonth(cardExpiresAt(card)) != 2026*12+3 {
+		t.Errorf("Expected the card's expiry month to follow its last valid month")
+	}
+
+	if cardExpired(&pb.Card{}, now) {
+		t.Errorf("Expected a card without an expiry date never to expire")
+	}
+}
+
+func TestNotifyExpiringCards(t *testing.T) {
+	repo := &memoryRepository{
+		cards: map[int64][]*pb.Card{
+			// The primary card has expired and is replaced by card 13, the newest.
+			1: {expiring(11, -1), expiring(12, 24), expiring(13, 12)},
+			// Card 21 expires within the window, card 22 does not.
+			2: {expiring(21, 0), expiring(22, 6)},
+			// The primary card has expired, but there is nothing to replace it with.
+			3: {expiring(31, -2)},
+		},
+		primary:  map[int64]int64{1: 11, 2: 22, 3: 31},
+		notified: map[int64]bool{11: true},
+		events:   map[int64]*pb.ExpiringCards{},
+	}
+
+	s := &service{repo: repo, cfg: &config.CardsConfig{ExpiryWindow: 45 * 24 * time.Hour}}
+
+	if err := s.NotifyExpiringCards(); err != nil {
+		t.Fatalf("Could not notify expiring cards: %v", err)
+	}
+
+	if repo.primary[1] != 13 {
+		t.Errorf("Expected card 13 as the new primary card, got %d", repo.primary[1])
+	}
+
+	if data := repo.events[1]; data == nil || len(data.Cards) != 1 || !data.Cards[0].Expired || data.PrimaryCardId == "" {
+		t.Errorf("Expected an event for the replaced primary card, got %v", data)
+	}
+
+	if data := repo.events[2]; data == nil || len(data.Cards) != 1 || data.Cards[0].Card.Id != 21 || data.Cards[0].Expired {
+		t.Errorf("Expected an event for card 21 only, got %v", data)
+	}
+
+	if data := repo.events[3]; data == nil || data.PrimaryCardId != "" || repo.primary[3] != 31 {
+		t.Errorf("Expected card 31 to be announced but kept as primary, got %v", data)
+	}
+
+	repo.events = map[int64]*pb.ExpiringCards{}
+
+	if err := s.NotifyExpiringCards(); err != nil {
+		t.Fatalf("Could not notify expiring cards: %v", err)
+	}
+
+	if len(repo.events) != 0 {
+		t.Errorf("Expected every card to be announced once, got %v", repo.events)
+	}
+}
@@ -0,0 +1,60 @@
+package customers
+
+import (
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+	"time"
+)
+
+// primaryFallback returns the card that becomes a customer's primary card
+// when it has none: the most recently added card that has not expired, other
+// than the card with id exclude. It returns nil if there is no such card.
+func primaryFallback(cards []*pb.Card, exclude int64, now time.Time) *pb.Card {
+	var newest *pb.Card
+
+	for _, c := range cards {
+		if c.GetId() == exclude || cardExpired(c, now) {
+			continue
+		}
+
+		if newest == nil || c.GetId() > newest.GetId() {
+			newest = c
+		}
+	}
+
+	return newest
+}
+
+// GetPrimaryPaymentMethod returns the card a customer is charged on when no
+// card is given. A customer without a primary card, or whose primary card has
+// expired, gets the fallback card as its primary card.
+func (s *service) GetPrimaryPaymentMethod(customer *pb.Customer) (*pb.Card, error) {
+	cards, err := s.repo.SelectCustomerCards(customer)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	for _, c := range cards {
+		if c.GetId() == customer.GetPrimaryCardId() && !cardExpired(c, now) {
+			return c, nil
+		}
+	}
+
+	card := primaryFallback(cards, 0, now)
+	if card == nil {
+		return nil, status.Error(codes.FailedPrecondition, "customer has no valid card")
+	}
+
+	log.Println("No primary card for customer", customer.Id, "using", card.Id)
+
+	err = s.repo.UpdateCustomerPrimaryCard(customer, card)
+	if err != nil {
+		return nil, err
+	}
+
+	return card, nil
+}
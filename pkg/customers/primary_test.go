@@ -0,0 +1,122 @@
+package customers
+
+import (
+	"github.com/robertkohut/go-payments/pkg/payments"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+// detachingGateway accepts every payment method removal.
+type detachingGateway struct {
+	payments.PaymentService
+}
+
+func (detachingGateway) RemoveCustomerPaymentMethod(*pb.Customer, *pb.Card) error {
+	return nil
+}
+
+func TestPrimaryFallback(t *testing.T) {
+	now := time.Date(2026, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+	cards := []*pb.Card{
+		{Id: 1, ExpMonth: 12, ExpYear: 2030},
+		{Id: 2},
+		{Id: 3, ExpMonth: 6, ExpYear: 2027},
+		{Id: 4, ExpMonth: 1, ExpYear: 2026},
+	}
+
+	if c := primaryFallback(cards, 0, now); c == nil || c.Id != 3 {
+		t.Errorf("Expected the newest valid card 3, got %v", c)
+	}
+
+	if c := primaryFallback(cards, 3, now); c == nil || c.Id != 2 {
+		t.Errorf("Expected card 2 once card 3 is excluded, got %v", c)
+	}
+
+	if c := primaryFallback(cards[3:], 0, now); c != nil {
+		t.Errorf("Expected no fallback for expired cards, got %v", c)
+	}
+}
+
+func TestGetPrimaryPaymentMethod(t *testing.T) {
+	repo := &memoryRepository{
+		cards:   map[int64][]*pb.Card{1: {expiring(11, 12), expiring(12, 6), expiring(13, -1)}},
+		primary: map[int64]int64{},
+	}
+
+	s := &service{repo: repo}
+	customer := &pb.Customer{Id: 1}
+
+	card, err := s.GetPrimaryPaymentMethod(customer)
+	if err != nil || card.Id != 12 {
+		t.Fatalf("Expected the newest valid card 12, got %v, %v", card, err)
+	}
+
+	if repo.primary[1] != 12 || customer.PrimaryCardId != 12 {
+		t.Errorf("Expected card 12 to become the primary card, got %d", repo.primary[1])
+	}
+
+	// A primary card is charged even if a newer card exists.
+	customer.PrimaryCardId = 11
+
+	card, err = s.GetPrimaryPaymentMethod(customer)
+	if err != nil || card.Id != 11 {
+		t.Errorf("Expected the primary card 11, got %v, %v", card, err)
+	}
+
+	// An expired primary card is replaced by the fallback card.
+	customer.PrimaryCardId = 13
+
+	card, err = s.GetPrimaryPaymentMethod(customer)
+	if err != nil || card.Id != 12 {
+		t.Errorf("Expected the fallback card 12 instead of the expired card 13, got %v, %v", card, err)
+	}
+
+	if repo.primary[1] != 12 {
+		t.Errorf("Expected card 12 to replace the expired primary card, got %d", repo.primary[1])
+	}
+
+	repo.cards[1] = []*pb.Card{expiring(13, -1)}
+	customer.PrimaryCardId = 13
+
+	_, err = s.GetPrimaryPaymentMethod(customer)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition when only the expired primary card is left, got %v", err)
+	}
+
+	customer.PrimaryCardId = 0
+
+	_, err = s.GetPrimaryPaymentMethod(customer)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition without a valid card, got %v", err)
+	}
+}
+
+func TestRemovePrimaryPaymentMethod(t *testing.T) {
+	repo := &memoryRepository{
+		cards:   map[int64][]*pb.Card{1: {expiring(11, 12), expiring(12, 6), expiring(13, -1)}},
+		primary: map[int64]int64{1: 11},
+	}
+
+	s := &service{gateways: payments.NewStaticRegistry(detachingGateway{}), repo: repo}
+	customer := &pb.Customer{Id: 1, PrimaryCardId: 11}
+
+	if err := s.RemoveCustomerPaymentMethod(customer, repo.cards[1][0]); err != nil {
+		t.Fatalf("Could not remove card: %v", err)
+	}
+
+	if repo.primary[1] != 12 || customer.PrimaryCardId != 12 {
+		t.Errorf("Expected card 12 to be promoted, got %d", repo.primary[1])
+	}
+
+	if err := s.RemoveCustomerPaymentMethod(customer, repo.cards[1][0]); err != nil {
+		t.Fatalf("Could not remove card: %v", err)
+	}
+
+	if repo.primary[1] != 0 {
+		t.Errorf("Expected no primary card with only an expired card left, got %d", repo.primary[1])
+	}
+}
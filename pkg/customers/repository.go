@@ -2,24 +2,85 @@ package customers
 
 import (
 	"database/sql"
+	"encoding/json"
 	"github.com/jmoiron/sqlx"
 	"github.com/robertkohut/go-payments/internal/services/hashid"
+	"github.com/robertkohut/go-payments/pkg/charges"
+	"github.com/robertkohut/go-payments/pkg/events"
 	"github.com/robertkohut/go-payments/pkg/metadata"
+	"github.com/robertkohut/go-payments/pkg/webhooks"
 	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"log"
+	"strings"
+	"time"
 )
 
+// capturedStatuses are the charge statuses whose amount was taken from the
+// customer, whatever happened to it afterwards.
+var capturedStatuses = []string{
+	charges.StatusName(pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED),
+	charges.StatusName(pb.ChargeStatus_CHARGE_STATUS_PARTIALLY_REFUNDED),
+	charges.StatusName(pb.ChargeStatus_CHARGE_STATUS_REFUNDED),
+	charges.StatusName(pb.ChargeStatus_CHARGE_STATUS_DISPUTED),
+}
+
 type Repository interface {
 	InsertCustomer(customer *pb.Customer) (int64, error)
-	SelectCustomerByAccountId(sourceId, accountId int64) (*pb.Customer, error)
+	SelectCustomerByAccountId(sourceId, accountId int64, livemode bool) (*pb.Customer, error)
+	SelectCustomerById(sourceId, customerId int64, livemode bool) (*pb.Customer, error)
+	// SelectErasableCustomer returns a customer that has not been erased,
+	// active or not, by id if customerId is set and by account otherwise.
+	SelectErasableCustomer(sourceId, accountId, customerId int64, livemode bool) (*pb.Customer, error)
+	UpdateCustomer(customer *pb.Customer) error
 	DeleteCustomer(customer *pb.Customer) error
+	// EraseCustomer scrubs a customer. The cards in undetached are kept for
+	// SelectUndetachedCards to retry.
+	EraseCustomer(customer *pb.Customer, undetached []*pb.Card) error
+	RestoreCustomer(sourceId, accountId int64, livemode bool) error
+	SelectCustomers(filter *pb.CustomerFilter, livemode bool, email, name string, limit, offset int64) ([]*pb.Customer, int64, error)
+	SelectCustomerSummaries(customers []*pb.Customer) ([]*pb.CustomerSummary, error)
 
 	AddCustomerCard(customer *pb.Customer, card *pb.Card) (int64, error)
+	// UpdateCustomerCard replaces the gateway token and details of a card.
+	UpdateCustomerCard(customer *pb.Customer, card *pb.Card) error
+	// SelectExpiringCards lists the active cards of a source expiring by the
+	// end of expiry month through, and after month after. Months are counted
+	// as by expiryMonth.
+	SelectExpiringCards(sourceId int64, livemode bool, after, through int, limit, offset int64) ([]*pb.ExpiringCard, error)
+	// SelectCardsToNotify lists the active cards of all customers expiring by
+	// the end of month through that no card.expiring event was emitted for.
+	SelectCardsToNotify(through int) ([]*pb.ExpiringCard, error)
+	// SelectExpiredPrimaryCards lists the primary cards that expired by the
+	// end of month through.
+	SelectExpiredPrimaryCards(through int) ([]*pb.ExpiringCard, error)
+	// InsertCardsExpiring emits a card.expiring event for a customer's cards
+	// and marks them notified. If primary is set it becomes the customer's
+	// primary card.
+	InsertCardsExpiring(customerId int64, data *pb.ExpiringCards, primary *pb.Card) error
 	SelectCustomerCards(customer *pb.Customer) ([]*pb.Card, error)
 	SelectCustomerCard(customer *pb.Customer, cardId int64) (*pb.Card, error)
+	// SelectCardCredentials fills in what a card is charged with but is not
+	// read with it, so it never reaches clients.
+	SelectCardCredentials(customer *pb.Customer, card *pb.Card) error
 	UpdateCustomerPrimaryCard(customer *pb.Customer, card *pb.Card) error
-	DeleteCustomerCard(customer *pb.Customer, card *pb.Card) error
+	// DeleteCustomerCard deactivates a card. If it was the customer's primary
+	// card, replacement becomes the primary card, or none if it is nil.
+	DeleteCustomerCard(customer *pb.Customer, card *pb.Card, replacement *pb.Card) error
+	// SelectUndetachedCards lists cards of erased customers still to be
+	// detached at the gateway, and MarkCardDetached clears them.
+	SelectUndetachedCards(limit int) ([]*PendingDetach, error)
+	MarkCardDetached(card *pb.Card) error
+}
+
+// PendingDetach is a card of an erased customer along with the customer's
+// gateway details.
+type PendingDetach struct {
+	Customer *pb.Customer
+	Card     *pb.Card
 }
 
 type repository struct {
@@ -35,86 +96,730 @@ func NewRepository(db *sqlx.DB, hd *hashid.Service) Repository {
 }
 
 func (r *repository) InsertCustomer(customer *pb.Customer) (int64, error) {
-	// TODO: Remove magic gateway_id
-	stmt := `INSERT INTO customers (gateway_id, source_id, account_id, ext_id, flags) VALUES (1, ?, ?, ?, ?)`
+	stmt := `INSERT INTO customers (
+                       gateway_id,
+                       source_id,
+                       org_id,
+                       account_id,
+                       ext_id,
+                       flags,
+                       name,
+                       email,
+                       phone,
+                       address_line1,
+                       address_line2,
+                       address_city,
+                       address_state,
+                       address_postal_code,
+                       address_country,
+                       metadata,
+                       livemode)
+             VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	customer.Flags = customer.Flags | metadata.FlagsCustomerActive
 
-	result, err := r.db.Exec(stmt, customer.SourceId, customer.AccountId, customer.ExtId, customer.Flags)
+	customerMetadata, err := json.Marshal(customer.GetMetadata())
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	address := customer.GetAddress()
+
+	result, err := tx.Exec(stmt,
+		customer.GatewayId,
+		customer.SourceId,
+		customer.OrgId,
+		customer.AccountId,
+		customer.ExtId,
+		customer.Flags,
+		customer.Name,
+		customer.Email,
+		customer.Phone,
+		address.GetLine1(),
+		address.GetLine2(),
+		address.GetCity(),
+		address.GetState(),
+		address.GetPostalCode(),
+		address.GetCountry(),
+		customerMetadata,
+		customer.Livemode,
+	)
+
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
 
+	customer.Id, err = result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	customer.IdStr, _ = r.hd.Encode([]int64{customer.Id, metadata.HDCustomerId})
+
+	err = events.Insert(tx, events.CustomerCreated, customer.Id, customer)
 	if err != nil {
 		log.Println(err)
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	return customer.Id, tx.Commit()
+}
+
+func (r *repository) UpdateCustomer(customer *pb.Customer) error {
+	stmt := `UPDATE customers
+             SET name = ?,
+                 email = ?,
+                 phone = ?,
+                 address_line1 = ?,
+                 address_line2 = ?,
+                 address_city = ?,
+                 address_state = ?,
+                 address_postal_code = ?,
+                 address_country = ?,
+                 metadata = ?
+             WHERE id = ?`
+
+	customerMetadata, err := json.Marshal(customer.GetMetadata())
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	address := customer.GetAddress()
+
+	_, err = tx.Exec(stmt,
+		customer.Name,
+		customer.Email,
+		customer.Phone,
+		address.GetLine1(),
+		address.GetLine2(),
+		address.GetCity(),
+		address.GetState(),
+		address.GetPostalCode(),
+		address.GetCountry(),
+		customerMetadata,
+		customer.Id,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	err = events.Insert(tx, events.CustomerUpdated, customer.Id, customer)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *repository) DeleteCustomer(customer *pb.Customer) error {
+	// Organization billing customers all have account_id 0, so customers
+	// are deactivated by id.
 	stmt := `UPDATE customers SET flags = flags &~ ? 
-                 WHERE account_id = ?
+                 WHERE id = ?
                  AND (flags & ?) = ?`
 
-	_, err := r.db.Exec(stmt, metadata.FlagsCustomerActive, customer.AccountId, metadata.FlagsCustomerActive, metadata.FlagsCustomerActive)
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec(stmt, metadata.FlagsCustomerActive, customer.Id, metadata.FlagsCustomerActive, metadata.FlagsCustomerActive)
 
 	if err != nil {
 		log.Println(err)
 		return err
 	}
 
-	return nil
+	err = events.Insert(tx, events.CustomerDeleted, customer.Id, customer)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (r *repository) SelectCustomerByAccountId(sourceId, accountId int64) (*pb.Customer, error) {
-	customer := &pb.Customer{}
+// erasedCardColumns are the text columns of cards that EraseCustomer blanks.
+// The gateway token, ext_id, is only blanked once the card was detached.
+var erasedCardColumns = []string{"last_four", "fingerprint", "network_token", "bin", "country", "mandate", "setup_intent_id"}
+
+// eraseCardsStmt deactivates a customer's cards and blanks their details,
+// and the gateway token of those not left to detach.
+func eraseCardsStmt() string {
+	stmt := `UPDATE cards
+		 SET ext_id = IF((flags & ?) = ?, ext_id, ''),
+		     flags = flags &~ ?,
+		     exp_month = 0,
+		     exp_year = 0`
+
+	for _, column := range erasedCardColumns {
+		stmt += `,
+		     ` + column + ` = ''`
+	}
+
+	return stmt + `
+		 WHERE customer_id = ?`
+}
+
+// EraseCustomer deactivates a customer for good and scrubs its personal
+// data: contact details, card details and credentials, charge descriptions
+// and metadata, and the payloads of events about it. Charge amounts and
+// statuses are kept for accounting. The gateway tokens of undetached cards
+// are kept so detaching them can be retried.
+func (r *repository) EraseCustomer(customer *pb.Customer, undetached []*pb.Card) error {
+	stmts := []string{
+		`UPDATE customers
+		 SET flags = (flags &~ ?) | ?,
+		     name = '',
+		     email = '',
+		     phone = '',
+		     address_line1 = '',
+		     address_line2 = '',
+		     address_city = '',
+		     address_state = '',
+		     address_postal_code = '',
+		     address_country = '',
+		     metadata = NULL
+		 WHERE id = ?`,
+		eraseCardsStmt(),
+		`UPDATE charges
+		 SET description = '',
+		     metadata = NULL
+		 WHERE customer_id = ?`,
+	}
+
+	args := [][]interface{}{
+		{metadata.FlagsCustomerActive, metadata.FlagsCustomerErased, customer.Id},
+		{metadata.FlagsCardDetachPending, metadata.FlagsCardDetachPending, metadata.FlagsCardActive, customer.Id},
+		{customer.Id},
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
 
-	stmt := `SELECT id, ext_id, primary_pm_id FROM customers 
+	defer tx.Rollback()
+
+	// Flag the undetached cards first, so the scrub keeps their tokens.
+	if len(undetached) > 0 {
+		var cardIds []int64
+		for _, c := range undetached {
+			cardIds = append(cardIds, c.Id)
+		}
+
+		stmt, args, err := sqlx.In(`UPDATE cards SET flags = flags | ? WHERE customer_id = ? AND id IN (?)`, metadata.FlagsCardDetachPending, customer.Id, cardIds)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(stmt, args...); err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+
+	for i, stmt := range stmts {
+		if _, err := tx.Exec(stmt, args[i]...); err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+
+	if err := events.EraseCustomerData(tx, customer.Id); err != nil {
+		return err
+	}
+
+	if err := webhooks.EraseCustomerData(tx, customer.Id); err != nil {
+		return err
+	}
+
+	erased := &pb.Customer{
+		IdStr:     customer.IdStr,
+		SourceId:  customer.SourceId,
+		AccountId: customer.AccountId,
+		Flags:     (customer.Flags &^ metadata.FlagsCustomerActive) | metadata.FlagsCustomerErased,
+	}
+
+	err = events.Insert(tx, events.CustomerDeleted, customer.Id, erased)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *repository) SelectUndetachedCards(limit int) ([]*PendingDetach, error) {
+	var pending []*PendingDetach
+
+	stmt := `SELECT cu.id, cu.gateway_id, cu.source_id, cu.ext_id, cu.livemode, c.id, c.ext_id
+			 FROM cards c
+			 INNER JOIN customers cu ON cu.id = c.customer_id
+			 WHERE (c.flags & ?) = ?
+			 ORDER BY c.id
+			 LIMIT ?`
+
+	rows, err := r.db.Query(stmt, metadata.FlagsCardDetachPending, metadata.FlagsCardDetachPending, limit)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		p := &PendingDetach{Customer: &pb.Customer{}, Card: &pb.Card{}}
+
+		err := rows.Scan(
+			&p.Customer.Id,
+			&p.Customer.GatewayId,
+			&p.Customer.SourceId,
+			&p.Customer.ExtId,
+			&p.Customer.Livemode,
+			&p.Card.Id,
+			&p.Card.ExtId,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		pending = append(pending, p)
+	}
+
+	return pending, rows.Err()
+}
+
+func (r *repository) MarkCardDetached(card *pb.Card) error {
+	stmt := `UPDATE cards SET flags = flags &~ ?, ext_id = '' WHERE id = ?`
+
+	_, err := r.db.Exec(stmt, metadata.FlagsCardDetachPending, card.Id)
+
+	return err
+}
+
+// RestoreCustomer reactivates the most recently deactivated customer of an
+// account. Erased customers cannot be restored.
+func (r *repository) RestoreCustomer(sourceId, accountId int64, livemode bool) error {
+	stmt := `UPDATE customers SET flags = flags | ?
+             WHERE source_id = ?
+               AND account_id = ?
+               AND livemode = ?
+               AND (flags & ?) = 0
+             ORDER BY id DESC
+             LIMIT 1`
+
+	result, err := r.db.Exec(stmt, metadata.FlagsCustomerActive, sourceId, accountId, livemode, metadata.FlagsCustomerActive|metadata.FlagsCustomerErased)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return status.Error(codes.NotFound, "no deactivated customer to restore")
+	}
+
+	return nil
+}
+
+func (r *repository) SelectCustomerByAccountId(sourceId, accountId int64, livemode bool) (*pb.Customer, error) {
+	stmt := selectCustomersStmt + `
              WHERE source_id = ?
                AND account_id = ?
+               AND livemode = ?
                AND (flags & ?) = ?`
 
-	row := r.db.QueryRow(stmt, sourceId, accountId, metadata.FlagsCustomerActive, metadata.FlagsCustomerActive)
+	row := r.db.QueryRow(stmt, sourceId, accountId, livemode, metadata.FlagsCustomerActive, metadata.FlagsCustomerActive)
+
+	return r.scanCustomer(row)
+}
+
+func (r *repository) SelectCustomerById(sourceId, customerId int64, livemode bool) (*pb.Customer, error) {
+	stmt := selectCustomersStmt + `
+             WHERE id = ?
+               AND source_id = ?
+               AND livemode = ?
+               AND (flags & ?) = ?`
+
+	row := r.db.QueryRow(stmt, customerId, sourceId, livemode, metadata.FlagsCustomerActive, metadata.FlagsCustomerActive)
+
+	return r.scanCustomer(row)
+}
+
+func (r *repository) SelectErasableCustomer(sourceId, accountId, customerId int64, livemode bool) (*pb.Customer, error) {
+	stmt := selectCustomersStmt + `
+             WHERE source_id = ?
+               AND livemode = ?
+               AND (flags & ?) = 0`
+	args := []interface{}{sourceId, livemode, metadata.FlagsCustomerErased}
+
+	if customerId != 0 {
+		stmt += ` AND id = ?`
+		args = append(args, customerId)
+	} else {
+		stmt += ` AND account_id = ?`
+		args = append(args, accountId)
+	}
+
+	// An account's active customer comes first, then its latest deactivated
+	// one.
+	stmt += ` ORDER BY (flags & ?) DESC, id DESC LIMIT 1`
+	args = append(args, metadata.FlagsCustomerActive)
+
+	row := r.db.QueryRow(stmt, args...)
+
+	return r.scanCustomer(row)
+}
+
+// selectCustomersStmt lists the columns read by scanCustomer.
+const selectCustomersStmt = `SELECT id,
+                    gateway_id,
+                    source_id,
+                    org_id,
+                    account_id,
+                    ext_id,
+                    primary_pm_id,
+                    flags,
+                    name,
+                    email,
+                    phone,
+                    address_line1,
+                    address_line2,
+                    address_city,
+                    address_state,
+                    address_postal_code,
+                    address_country,
+                    metadata,
+                    livemode,
+                    created_at
+            FROM customers`
+
+func (r *repository) scanCustomer(row interface{ Scan(...interface{}) error }) (*pb.Customer, error) {
+	customer := &pb.Customer{}
+	address := &pb.Address{}
+
+	var customerMetadata []byte
+	var createdAt time.Time
 
 	switch err := row.Scan(
 		&customer.Id,
+		&customer.GatewayId,
+		&customer.SourceId,
+		&customer.OrgId,
+		&customer.AccountId,
 		&customer.ExtId,
 		&customer.PrimaryCardId,
+		&customer.Flags,
+		&customer.Name,
+		&customer.Email,
+		&customer.Phone,
+		&address.Line1,
+		&address.Line2,
+		&address.City,
+		&address.State,
+		&address.PostalCode,
+		&address.Country,
+		&customerMetadata,
+		&customer.Livemode,
+		&createdAt,
 	); err {
 	case sql.ErrNoRows:
 		st := status.New(404, "customer not found")
 		return nil, st.Err()
 	case nil:
+		if proto.Size(address) > 0 {
+			customer.Address = address
+		}
+		if len(customerMetadata) > 0 {
+			if err := json.Unmarshal(customerMetadata, &customer.Metadata); err != nil {
+				return nil, err
+			}
+		}
+		customer.CreatedAt = timestamppb.New(createdAt)
+		customer.IdStr, _ = r.hd.Encode([]int64{customer.Id, metadata.HDCustomerId})
+		if customer.PrimaryCardId != 0 {
+			customer.PrimaryCardIdStr, _ = r.hd.Encode([]int64{customer.PrimaryCardId, metadata.HDCardId})
+		}
 		return customer, nil
 	default:
 		return nil, err
 	}
 }
 
-func (r *repository) AddCustomerCard(customer *pb.Customer, card *pb.Card) (int64, error) {
-	stmt := `INSERT INTO cards (ext_id, customer_id, brand, exp_month, exp_year, last_four)
-			 VALUES (?, ?, ?, ?, ?, ?)`
+// SelectCustomers returns a page of the customers matching filter, newest
+// first, along with the number of matches across all pages. email and name
+// are matched as substrings when set.
+func (r *repository) SelectCustomers(filter *pb.CustomerFilter, livemode bool, email, name string, limit, offset int64) ([]*pb.Customer, int64, error) {
+	var customers []*pb.Customer
 
-	knownCardBrands := map[string]bool{
-		"visa":       true,
-		"mastercard": true,
-		"amex":       true,
-		"discover":   true,
-		"jcb":        true,
-		"diners":     true,
+	conds := []string{`livemode = ?`}
+	args := []interface{}{livemode}
+
+	if filter.GetSourceId() != 0 {
+		conds = append(conds, `source_id = ?`)
+		args = append(args, filter.GetSourceId())
 	}
 
-	if _, ok := knownCardBrands[card.Brand]; !ok {
-		log.Println("Unknown card brand: ", card.Brand, " for card: ", card.ExtId)
-		card.Brand = "unknown"
+	if filter.GetGatewayId() != 0 {
+		conds = append(conds, `gateway_id = ?`)
+		args = append(args, filter.GetGatewayId())
+	}
+
+	if filter != nil && filter.Active != nil {
+		if filter.GetActive() {
+			conds = append(conds, `(flags & ?) = ?`)
+			args = append(args, metadata.FlagsCustomerActive, metadata.FlagsCustomerActive)
+		} else {
+			conds = append(conds, `(flags & ?) = 0`)
+			args = append(args, metadata.FlagsCustomerActive)
+		}
+	}
+
+	if filter.GetCreatedAfter() != nil {
+		conds = append(conds, `created_at >= ?`)
+		args = append(args, filter.GetCreatedAfter().AsTime())
+	}
+
+	if filter.GetCreatedBefore() != nil {
+		conds = append(conds, `created_at < ?`)
+		args = append(args, filter.GetCreatedBefore().AsTime())
+	}
+
+	if filter.GetExtId() != "" {
+		conds = append(conds, `ext_id = ?`)
+		args = append(args, filter.GetExtId())
+	}
+
+	if email != "" {
+		conds = append(conds, `email LIKE ?`)
+		args = append(args, containsPattern(email))
+	}
+
+	if name != "" {
+		conds = append(conds, `name LIKE ?`)
+		args = append(args, containsPattern(name))
+	}
+
+	where := ` WHERE ` + strings.Join(conds, ` AND `)
+
+	var total int64
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM customers`+where, args...).Scan(&total); err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	stmt := selectCustomersStmt + where + ` ORDER BY id DESC`
+
+	if limit > 0 {
+		stmt += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, offset)
+	}
+
+	rows, err := r.db.Query(stmt, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		customer, err := r.scanCustomer(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		customers = append(customers, customer)
+	}
+
+	return customers, total, rows.Err()
+}
+
+// SelectCustomerSummaries computes the card count, primary card and lifetime
+// charged amounts of each customer, in three queries for the whole list.
+func (r *repository) SelectCustomerSummaries(customers []*pb.Customer) ([]*pb.CustomerSummary, error) {
+	var summaries []*pb.CustomerSummary
+
+	if len(customers) == 0 {
+		return summaries, nil
+	}
+
+	byId := make(map[int64]*pb.CustomerSummary)
+	var customerIds, cardIds []int64
+
+	for _, customer := range customers {
+		summary := &pb.CustomerSummary{
+			Customer:        customer,
+			LifetimeCharged: make(map[string]int64),
+		}
+		summaries = append(summaries, summary)
+		byId[customer.Id] = summary
+		customerIds = append(customerIds, customer.Id)
+		if customer.PrimaryCardId != 0 {
+			cardIds = append(cardIds, customer.PrimaryCardId)
+		}
+	}
+
+	stmt, args, err := sqlx.In(`SELECT customer_id, COUNT(*) FROM cards
+             WHERE customer_id IN (?)
+               AND (flags & ?) = ?
+             GROUP BY customer_id`, customerIds, metadata.FlagsCardActive, metadata.FlagsCardActive)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.eachRow(stmt, args, func(rows *sql.Rows) error {
+		var customerId, count int64
+		if err := rows.Scan(&customerId, &count); err != nil {
+			return err
+		}
+		byId[customerId].CardCount = count
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cardIds) > 0 {
+		stmt, args, err = sqlx.In(`SELECT id, customer_id, brand, ext_id, exp_month, exp_year, last_four, livemode FROM cards
+                 WHERE id IN (?)
+                   AND (flags & ?) = ?`, cardIds, metadata.FlagsCardActive, metadata.FlagsCardActive)
+		if err != nil {
+			return nil, err
+		}
+
+		err = r.eachRow(stmt, args, func(rows *sql.Rows) error {
+			card := &pb.Card{}
+			var customerId int64
+			err := rows.Scan(
+				&card.Id,
+				&customerId,
+				&card.Brand,
+				&card.ExtId,
+				&card.ExpMonth,
+				&card.ExpYear,
+				&card.Last4,
+				&card.Livemode,
+			)
+			if err != nil {
+				return err
+			}
+			card.IdStr, _ = r.hd.Encode([]int64{card.Id, metadata.HDCardId})
+			byId[customerId].PrimaryCard = card
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stmt, args, err = sqlx.In(`SELECT c.customer_id, currencies.code, SUM(c.amount) FROM charges c
+             INNER JOIN currencies ON currencies.id = c.currency_id
+             WHERE c.customer_id IN (?)
+               AND c.status IN (?)
+             GROUP BY c.customer_id, currencies.code`, customerIds, capturedStatuses)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.eachRow(stmt, args, func(rows *sql.Rows) error {
+		var customerId, amount int64
+		var currency string
+		if err := rows.Scan(&customerId, &currency, &amount); err != nil {
+			return err
+		}
+		byId[customerId].LifetimeCharged[currency] = amount
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return summaries, nil
+}
+
+// eachRow runs a query and calls fn for every row.
+func (r *repository) eachRow(stmt string, args []interface{}, fn func(rows *sql.Rows) error) error {
+	rows, err := r.db.Query(r.db.Rebind(stmt), args...)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// containsPattern builds a LIKE pattern matching s anywhere, with LIKE
+// wildcards in s escaped.
+func containsPattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
+
+func (r *repository) AddCustomerCard(customer *pb.Customer, card *pb.Card) (int64, error) {
+	stmt := `INSERT INTO cards (ext_id, customer_id, brand, exp_month, exp_year, last_four, livemode, network_token, bin, country, fingerprint,
+			                    funding, wallet, cvc_check, postal_code_check, mandate, setup_intent_id)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	checkCardBrand(card)
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
 	}
 
-	result, err := r.db.Exec(stmt,
+	defer tx.Rollback()
+
+	result, err := tx.Exec(stmt,
 		card.ExtId,
 		customer.Id,
 		card.Brand,
 		card.ExpMonth,
 		card.ExpYear,
 		card.Last4,
+		customer.Livemode,
+		card.NetworkToken,
+		card.Bin,
+		card.Country,
+		card.Fingerprint,
+		FundingName(card.Funding),
+		WalletName(card.Wallet),
+		CardCheckName(card.CvcCheck),
+		CardCheckName(card.PostalCodeCheck),
+		card.Mandate,
+		card.SetupIntentId,
 	)
 
 	if err != nil {
@@ -122,42 +827,202 @@ func (r *repository) AddCustomerCard(customer *pb.Customer, card *pb.Card) (int6
 		return 0, err
 	}
 
-	return result.LastInsertId()
-}
+	card.Id, err = result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
 
-func (r *repository) SelectCustomerCard(customer *pb.Customer, cardId int64) (*pb.Card, error) {
-	card := &pb.Card{}
+	card.Livemode = customer.Livemode
+
+	card.IdStr, _ = r.hd.Encode([]int64{card.Id, metadata.HDCardId})
+
+	err = events.Insert(tx, events.CardAdded, customer.Id, redactCard(card))
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
 
-	stmt := `SELECT id, brand, ext_id, exp_month, exp_year, last_four FROM cards 
+	return card.Id, tx.Commit()
+}
+
+func (r *repository) UpdateCustomerCard(customer *pb.Customer, card *pb.Card) error {
+	stmt := `UPDATE cards
+			 SET ext_id = ?,
+			     brand = ?,
+			     exp_month = ?,
+			     exp_year = ?,
+			     last_four = ?,
+			     network_token = ?,
+			     bin = ?,
+			     country = ?,
+			     fingerprint = ?,
+			     funding = ?,
+			     wallet = ?,
+			     cvc_check = ?,
+			     postal_code_check = ?,
+			     mandate = ?,
+			     setup_intent_id = ?,
+			     expiry_notified_at = NULL
 			 WHERE id = ?
-			   AND customer_id = ?
-			   AND (flags & ?) = ?`
+			   AND customer_id = ?`
 
-	row := r.db.QueryRow(stmt, cardId, customer.Id, metadata.FlagsCardActive, metadata.FlagsCardActive)
+	checkCardBrand(card)
 
-	switch err := row.Scan(
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec(stmt,
+		card.ExtId,
+		card.Brand,
+		card.ExpMonth,
+		card.ExpYear,
+		card.Last4,
+		card.NetworkToken,
+		card.Bin,
+		card.Country,
+		card.Fingerprint,
+		FundingName(card.Funding),
+		WalletName(card.Wallet),
+		CardCheckName(card.CvcCheck),
+		CardCheckName(card.PostalCodeCheck),
+		card.Mandate,
+		card.SetupIntentId,
+		card.Id,
+		customer.Id,
+	)
+
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	err = events.Insert(tx, events.CardUpdated, customer.Id, redactCard(card))
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkCardBrand stores brands the rest of the system does not know as
+// "unknown".
+func checkCardBrand(card *pb.Card) {
+	knownCardBrands := map[string]bool{
+		"visa":       true,
+		"mastercard": true,
+		"amex":       true,
+		"discover":   true,
+		"jcb":        true,
+		"diners":     true,
+	}
+
+	if _, ok := knownCardBrands[card.Brand]; !ok {
+		log.Println("Unknown card brand: ", card.Brand, " for card: ", card.ExtId)
+		card.Brand = "unknown"
+	}
+}
+
+// cardColumns lists the columns read by scanCard. The network token and
+// mandate are left out, as cards are returned to clients; see
+// SelectCardCredentials.
+const cardColumns = `c.id, c.brand, c.ext_id, c.exp_month, c.exp_year, c.last_four, c.livemode, c.bin, c.country, c.fingerprint,
+			        c.funding, c.wallet, c.cvc_check, c.postal_code_check, c.setup_intent_id`
+
+const selectCardsStmt = `SELECT ` + cardColumns + `
+			 FROM cards c`
+
+// selectExpiringCardsStmt lists the columns read by scanExpiringCard.
+const selectExpiringCardsStmt = `SELECT cu.id, cu.account_id, cu.primary_pm_id = c.id, ` + cardColumns + `
+			 FROM cards c
+			 INNER JOIN customers cu ON cu.id = c.customer_id`
+
+func (r *repository) scanCard(row interface{ Scan(...interface{}) error }) (*pb.Card, error) {
+	card := &pb.Card{}
+
+	var funding, wallet, cvcCheck, postalCodeCheck string
+
+	err := row.Scan(
 		&card.Id,
 		&card.Brand,
 		&card.ExtId,
 		&card.ExpMonth,
 		&card.ExpYear,
 		&card.Last4,
-	); err {
-	case sql.ErrNoRows:
+		&card.Livemode,
+		&card.Bin,
+		&card.Country,
+		&card.Fingerprint,
+		&funding,
+		&wallet,
+		&cvcCheck,
+		&postalCodeCheck,
+		&card.SetupIntentId,
+	)
+	if err != nil {
 		return nil, err
-	case nil:
-		return card, nil
-	default:
+	}
+
+	if card.Funding, err = ParseFunding(funding); err != nil {
+		return nil, err
+	}
+
+	if card.Wallet, err = ParseWallet(wallet); err != nil {
 		return nil, err
 	}
+
+	if card.CvcCheck, err = ParseCardCheck(cvcCheck); err != nil {
+		return nil, err
+	}
+
+	if card.PostalCodeCheck, err = ParseCardCheck(postalCodeCheck); err != nil {
+		return nil, err
+	}
+
+	card.IdStr, _ = r.hd.Encode([]int64{card.Id, metadata.HDCardId})
+
+	return card, nil
+}
+
+func (r *repository) SelectCustomerCard(customer *pb.Customer, cardId int64) (*pb.Card, error) {
+	stmt := selectCardsStmt + `
+			 WHERE id = ?
+			   AND customer_id = ?
+			   AND (flags & ?) = ?`
+
+	row := r.db.QueryRow(stmt, cardId, customer.Id, metadata.FlagsCardActive, metadata.FlagsCardActive)
+
+	return r.scanCard(row)
+}
+
+// SelectCardCredentials reads the network token and mandate of a card about
+// to be charged, which scanCard leaves out.
+func (r *repository) SelectCardCredentials(customer *pb.Customer, card *pb.Card) error {
+	stmt := `SELECT network_token, mandate
+			 FROM cards
+			 WHERE id = ?
+			   AND customer_id = ?`
+
+	err := r.db.QueryRow(stmt, card.Id, customer.Id).Scan(&card.NetworkToken, &card.Mandate)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
 }
 
 func (r *repository) SelectCustomerCards(customer *pb.Customer) ([]*pb.Card, error) {
 	var cards []*pb.Card
 
-	stmt := `SELECT id, brand, ext_id, exp_month, exp_year, last_four FROM cards 
+	stmt := selectCardsStmt + `
 			 WHERE customer_id = ?
-			   AND (flags & ?) = ?`
+			   AND (flags & ?) = ?
+			 ORDER BY id`
 
 	rows, err := r.db.Query(stmt, customer.Id, metadata.FlagsCardActive, metadata.FlagsCardActive)
 
@@ -169,55 +1034,237 @@ func (r *repository) SelectCustomerCards(customer *pb.Customer) ([]*pb.Card, err
 	defer rows.Close()
 
 	for rows.Next() {
-		card := &pb.Card{}
-
-		err := rows.Scan(
-			&card.Id,
-			&card.Brand,
-			&card.ExtId,
-			&card.ExpMonth,
-			&card.ExpYear,
-			&card.Last4,
-		)
-
+		card, err := r.scanCard(rows)
 		if err != nil {
 			log.Println(err)
 			return nil, err
 		}
 
-		card.IdStr, _ = r.hd.Encode([]int64{card.Id, metadata.HDCardId})
-
 		cards = append(cards, card)
 	}
 
 	return cards, nil
 }
 
+func (r *repository) SelectExpiringCards(sourceId int64, livemode bool, after, through int, limit, offset int64) ([]*pb.ExpiringCard, error) {
+	stmt := selectExpiringCardsStmt + `
+			 WHERE cu.source_id = ?
+			   AND cu.livemode = ?
+			   AND (cu.flags & ?) = ?
+			   AND (c.flags & ?) = ?
+			   AND c.exp_year > 0
+			   AND c.exp_year * 12 + c.exp_month > ?
+			   AND c.exp_year * 12 + c.exp_month <= ?
+			 ORDER BY c.exp_year, c.exp_month, c.id
+			 LIMIT ? OFFSET ?`
+
+	return r.queryExpiringCards(stmt,
+		sourceId, livemode,
+		metadata.FlagsCustomerActive, metadata.FlagsCustomerActive,
+		metadata.FlagsCardActive, metadata.FlagsCardActive,
+		after, through, limit, offset)
+}
+
+func (r *repository) SelectCardsToNotify(through int) ([]*pb.ExpiringCard, error) {
+	stmt := selectExpiringCardsStmt + `
+			 WHERE (cu.flags & ?) = ?
+			   AND (c.flags & ?) = ?
+			   AND c.expiry_notified_at IS NULL
+			   AND c.exp_year > 0
+			   AND c.exp_year * 12 + c.exp_month <= ?
+			 ORDER BY cu.id, c.id`
+
+	return r.queryExpiringCards(stmt,
+		metadata.FlagsCustomerActive, metadata.FlagsCustomerActive,
+		metadata.FlagsCardActive, metadata.FlagsCardActive,
+		through)
+}
+
+func (r *repository) SelectExpiredPrimaryCards(through int) ([]*pb.ExpiringCard, error) {
+	stmt := selectExpiringCardsStmt + `
+			 WHERE cu.primary_pm_id = c.id
+			   AND (cu.flags & ?) = ?
+			   AND (c.flags & ?) = ?
+			   AND c.exp_year > 0
+			   AND c.exp_year * 12 + c.exp_month <= ?
+			 ORDER BY cu.id`
+
+	return r.queryExpiringCards(stmt,
+		metadata.FlagsCustomerActive, metadata.FlagsCustomerActive,
+		metadata.FlagsCardActive, metadata.FlagsCardActive,
+		through)
+}
+
+func (r *repository) queryExpiringCards(stmt string, args ...interface{}) ([]*pb.ExpiringCard, error) {
+	var cards []*pb.ExpiringCard
+
+	err := r.eachRow(stmt, args, func(rows *sql.Rows) error {
+		card, err := r.scanExpiringCard(rows)
+		if err != nil {
+			return err
+		}
+
+		cards = append(cards, card)
+
+		return nil
+	})
+
+	return cards, err
+}
+
+func (r *repository) scanExpiringCard(row interface{ Scan(...interface{}) error }) (*pb.ExpiringCard, error) {
+	expiring := &pb.ExpiringCard{}
+
+	card, err := r.scanCard(prefixScanner{row, []interface{}{&expiring.CustomerId, &expiring.AccountId, &expiring.Primary}})
+	if err != nil {
+		return nil, err
+	}
+
+	expiring.Card = card
+	expiring.CustomerIdStr, err = r.hd.Encode([]int64{expiring.CustomerId, metadata.HDCustomerId})
+
+	return expiring, err
+}
+
+// prefixScanner scans the leading columns of a row into dest and the rest
+// into what Scan is called with.
+type prefixScanner struct {
+	row  interface{ Scan(...interface{}) error }
+	dest []interface{}
+}
+
+func (p prefixScanner) Scan(dest ...interface{}) error {
+	return p.row.Scan(append(p.dest, dest...)...)
+}
+
+func (r *repository) InsertCardsExpiring(customerId int64, data *pb.ExpiringCards, primary *pb.Card) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if primary != nil {
+		err = setPrimaryCard(tx, customerId, primary.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	var cardIds []int64
+	for _, c := range data.Cards {
+		cardIds = append(cardIds, c.GetCard().GetId())
+	}
+
+	if len(cardIds) > 0 {
+		stmt, args, err := sqlx.In(`UPDATE cards SET expiry_notified_at = CURRENT_TIMESTAMP WHERE id IN (?)`, cardIds)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(stmt, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = events.Insert(tx, events.CardExpiring, customerId, data)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (r *repository) UpdateCustomerPrimaryCard(customer *pb.Customer, card *pb.Card) error {
-	stmt := `UPDATE customers SET primary_pm_id = ? 
-				 WHERE id = ?`
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
 
-	_, err := r.db.Exec(stmt, card.Id, customer.Id)
+	defer tx.Rollback()
 
+	err = setPrimaryCard(tx, customer.Id, card.Id)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	customer.PrimaryCardId = card.Id
+	customer.PrimaryCardIdStr = card.IdStr
+
 	return nil
 }
 
-func (r *repository) DeleteCustomerCard(customer *pb.Customer, card *pb.Card) error {
+// setPrimaryCard makes a card the customer's primary card within tx. The
+// primary card is recorded twice, in customers.primary_pm_id and as the
+// default flag of the card, and only ever changed here so the two agree. A
+// cardId of 0 leaves the customer without a primary card.
+func setPrimaryCard(tx *sqlx.Tx, customerId, cardId int64) error {
+	stmt := `UPDATE cards SET flags = IF(id = ?, flags | ?, flags &~ ?)
+			 WHERE customer_id = ?`
+
+	_, err := tx.Exec(stmt, cardId, metadata.FlagsCardDefault, metadata.FlagsCardDefault, customerId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE customers SET primary_pm_id = ? WHERE id = ?`, cardId, customerId)
+
+	return err
+}
+
+func (r *repository) DeleteCustomerCard(customer *pb.Customer, card *pb.Card, replacement *pb.Card) error {
 	stmt := `UPDATE cards SET flags = flags &~ ? 
 				 WHERE customer_id = ?
 				   AND id = ?`
 
-	_, err := r.db.Exec(stmt, metadata.FlagsCardActive, customer.Id, card.Id)
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec(stmt, metadata.FlagsCardActive, customer.Id, card.Id)
 
 	if err != nil {
 		log.Println(err)
 		return err
 	}
 
+	primary := customer.PrimaryCardId == card.Id
+	if primary {
+		err = setPrimaryCard(tx, customer.Id, replacement.GetId())
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+
+	card.IdStr, _ = r.hd.Encode([]int64{card.Id, metadata.HDCardId})
+
+	err = events.Insert(tx, events.CardRemoved, customer.Id, redactCard(card))
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if primary {
+		customer.PrimaryCardId = replacement.GetId()
+		customer.PrimaryCardIdStr = replacement.GetIdStr()
+	}
+
 	return nil
 }
@@ -1,42 +1,119 @@
 package customers
 
 import (
+	"errors"
+	"fmt"
+	"github.com/robertkohut/go-payments/internal/config"
+	"github.com/robertkohut/go-payments/pkg/blocklist"
+	"github.com/robertkohut/go-payments/pkg/metadata"
 	"github.com/robertkohut/go-payments/pkg/payments"
+	"github.com/robertkohut/go-payments/pkg/routing"
 	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"log"
+	"net/mail"
+	"strings"
+	"time"
 )
 
 type Service interface {
-	GetPublishableKey() (string, error)
+	GetPublishableKey(sourceId int64, livemode bool) (string, error)
 
 	AddCustomer(customer *pb.Customer) (*string, error)
-	GetCustomerById(sourceId, accountId int64) (*pb.Customer, error)
+	GetCustomerById(sourceId, accountId int64, livemode bool) (*pb.Customer, error)
+	GetCustomer(sourceId, customerId int64, livemode bool) (*pb.Customer, error)
+	UpdateCustomer(customer *pb.Customer, update *pb.Customer, paths []string) (*pb.Customer, error)
 	DeleteCustomer(customer *pb.Customer) error
+	// GetErasableCustomer finds a customer to erase, which may have been
+	// deactivated already.
+	GetErasableCustomer(sourceId, accountId, customerId int64, livemode bool) (*pb.Customer, error)
+	EraseCustomer(customer *pb.Customer) error
+	// RetryCardDetaches detaches the cards that could not be detached when
+	// their customer was erased.
+	RetryCardDetaches() error
+	RestoreCustomer(sourceId, accountId int64, livemode bool) (*pb.Customer, error)
+	ListCustomers(filter *pb.CustomerFilter, livemode bool, limit, offset int64) ([]*pb.CustomerSummary, int64, error)
+	SearchCustomers(filter *pb.CustomerFilter, livemode bool, email, name string, limit, offset int64) ([]*pb.CustomerSummary, int64, error)
 
 	AddCustomerPaymentMethod(customer *pb.Customer, card *pb.Card) (*pb.Card, error)
 	GetCustomerPaymentMethod(customer *pb.Customer, cardId int64) (*pb.Card, error)
+	// LoadCardCredentials fills in what a card is charged with, its network
+	// token and mandate. Cards are returned without them otherwise.
+	LoadCardCredentials(customer *pb.Customer, card *pb.Card) error
+	GetPrimaryPaymentMethod(customer *pb.Customer) (*pb.Card, error)
 	SetCustomerPrimaryPaymentMethod(customer *pb.Customer, card *pb.Card) error
 	RemoveCustomerPaymentMethod(customer *pb.Customer, card *pb.Card) error
+
+	// CreateSetupIntent starts saving a card for off-session charges. The
+	// client confirms it with the gateway and then calls CompleteSetupIntent,
+	// which saves the card once the setup succeeded.
+	CreateSetupIntent(customer *pb.Customer) (*pb.SetupIntent, error)
+	CompleteSetupIntent(customer *pb.Customer, setupIntentId string) (*pb.SetupIntent, error)
+
+	// ListExpiringCards lists the cards of a source expiring within days,
+	// the configured expiry window if days is 0.
+	ListExpiringCards(sourceId int64, livemode bool, days int32, includeExpired bool, limit, offset int64) ([]*pb.ExpiringCard, error)
+	NotifyExpiringCards() error
 }
 
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+	detachBatchSize  = 100
+)
+
 type service struct {
-	paymentSvc payments.PaymentService
-	repo       Repository
+	gateways  payments.Registry
+	router    routing.Engine
+	blocklist blocklist.Service
+	repo      Repository
+	cfg       *config.CardsConfig
 }
 
-func NewService(payments payments.PaymentService, repo Repository) Service {
+func NewService(gateways payments.Registry, router routing.Engine, blocked blocklist.Service, repo Repository, cfg *config.CardsConfig) Service {
 	return &service{
-		paymentSvc: payments,
-		repo:       repo,
+		gateways:  gateways,
+		router:    router,
+		blocklist: blocked,
+		repo:      repo,
+		cfg:       cfg,
 	}
 }
 
-func (s *service) GetPublishableKey() (string, error) {
-	return s.paymentSvc.GetPublishableKey()
+func (s *service) GetPublishableKey(sourceId int64, livemode bool) (string, error) {
+	paymentSvc, err := s.gateways.Service(sourceId, s.gateways.DefaultGateway(sourceId), livemode)
+	if err != nil {
+		return "", err
+	}
+
+	return paymentSvc.GetPublishableKey()
+}
+
+// GetCustomerById returns the customer of an account. Organization billing
+// customers have no account and are only reachable by id, so account id 0
+// is rejected rather than matching one of them.
+func (s *service) GetCustomerById(sourceId, accountId int64, livemode bool) (*pb.Customer, error) {
+	if accountId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "account id is required")
+	}
+
+	customer, err := s.repo.SelectCustomerByAccountId(sourceId, accountId, livemode)
+	if err != nil {
+		return nil, err
+	}
+
+	customer.Cards, err = s.repo.SelectCustomerCards(customer)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return customer, nil
 }
 
-func (s *service) GetCustomerById(sourceId, accountId int64) (*pb.Customer, error) {
-	customer, err := s.repo.SelectCustomerByAccountId(sourceId, accountId)
+func (s *service) GetCustomer(sourceId, customerId int64, livemode bool) (*pb.Customer, error) {
+	customer, err := s.repo.SelectCustomerById(sourceId, customerId, livemode)
 	if err != nil {
 		return nil, err
 	}
@@ -51,7 +128,37 @@ func (s *service) GetCustomerById(sourceId, accountId int64) (*pb.Customer, erro
 }
 
 func (s *service) AddCustomer(customer *pb.Customer) (*string, error) {
-	customerExtId, err := s.paymentSvc.CreateCustomer(customer)
+	if err := validateCustomer(customer); err != nil {
+		return nil, err
+	}
+
+	err := s.blocklist.Check(&blocklist.Subject{
+		SourceId:  customer.SourceId,
+		AccountId: customer.AccountId,
+		Email:     customer.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if customer.GatewayId == 0 {
+		customer.GatewayId = s.gateways.DefaultGateway(customer.SourceId)
+
+		decision := s.router.Route(&routing.Request{
+			SourceId: customer.SourceId,
+			Key:      fmt.Sprintf("%d:%d", customer.AccountId, customer.OrgId),
+		})
+		if decision != nil {
+			customer.GatewayId = decision.GatewayId
+		}
+	}
+
+	paymentSvc, err := s.gateways.Service(customer.SourceId, customer.GatewayId, customer.Livemode)
+	if err != nil {
+		return nil, err
+	}
+
+	customerExtId, err := paymentSvc.CreateCustomer(customer)
 	if err != nil {
 		return nil, err
 	}
@@ -60,13 +167,98 @@ func (s *service) AddCustomer(customer *pb.Customer) (*string, error) {
 
 	customer.Id, err = s.repo.InsertCustomer(customer)
 	if err != nil {
-		_ = s.paymentSvc.DeleteCustomer(customer)
+		_ = paymentSvc.DeleteCustomer(customer)
 		return nil, err
 	}
 
 	return &customerExtId, nil
 }
 
+// UpdateCustomer copies the fields named in paths from update to customer and
+// syncs the result to the gateway before storing it.
+func (s *service) UpdateCustomer(customer *pb.Customer, update *pb.Customer, paths []string) (*pb.Customer, error) {
+	if len(paths) == 0 {
+		paths = []string{"name", "email", "phone", "address", "metadata"}
+	}
+
+	for _, path := range paths {
+		switch path {
+		case "name":
+			customer.Name = update.GetName()
+		case "email":
+			customer.Email = update.GetEmail()
+		case "phone":
+			customer.Phone = update.GetPhone()
+		case "address":
+			customer.Address = update.GetAddress()
+		case "metadata":
+			customer.Metadata = update.GetMetadata()
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "field %q cannot be updated", path)
+		}
+	}
+
+	if err := validateCustomer(customer); err != nil {
+		return nil, err
+	}
+
+	paymentSvc, err := s.gateways.Service(customer.SourceId, customer.GatewayId, customer.Livemode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = paymentSvc.UpdateCustomer(customer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.repo.UpdateCustomer(customer)
+	if err != nil {
+		return nil, err
+	}
+
+	return customer, nil
+}
+
+func validateCustomer(customer *pb.Customer) error {
+	if customer.GetEmail() != "" {
+		if _, err := mail.ParseAddress(customer.GetEmail()); err != nil {
+			return status.Error(codes.InvalidArgument, "invalid email address")
+		}
+	}
+
+	if phone := customer.GetPhone(); phone != "" && !validPhone(phone) {
+		return status.Error(codes.InvalidArgument, "invalid phone number")
+	}
+
+	if country := customer.GetAddress().GetCountry(); country != "" && len(country) != 2 {
+		return status.Error(codes.InvalidArgument, "address country must be a two-letter ISO code")
+	}
+
+	return metadata.Validate(customer.GetMetadata())
+}
+
+// validPhone reports whether phone looks like a phone number: 7 to 15
+// digits, as in E.164, with an optional leading + and the usual separators.
+func validPhone(phone string) bool {
+	var digits int
+
+	for i, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' && i == 0:
+		case strings.ContainsRune(" -().", r):
+		default:
+			return false
+		}
+	}
+
+	return digits >= 7 && digits <= 15
+}
+
+// DeleteCustomer deactivates a customer. Its data is kept, so it can be
+// brought back with RestoreCustomer.
 func (s *service) DeleteCustomer(customer *pb.Customer) error {
 	err := s.repo.DeleteCustomer(customer)
 	if err != nil {
@@ -76,14 +268,235 @@ func (s *service) DeleteCustomer(customer *pb.Customer) error {
 	return nil
 }
 
+func (s *service) GetErasableCustomer(sourceId, accountId, customerId int64, livemode bool) (*pb.Customer, error) {
+	if customerId == 0 && accountId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "account id is required")
+	}
+
+	customer, err := s.repo.SelectErasableCustomer(sourceId, accountId, customerId, livemode)
+	if err != nil {
+		return nil, err
+	}
+
+	customer.Cards, err = s.repo.SelectCustomerCards(customer)
+	if err != nil {
+		return nil, err
+	}
+
+	return customer, nil
+}
+
+// EraseCustomer detaches the customer's cards and deletes it at the gateway,
+// then scrubs its personal data locally. Charges are kept, anonymized. Cards
+// the gateway could not detach are scrubbed all the same and detached later
+// by RetryCardDetaches.
+func (s *service) EraseCustomer(customer *pb.Customer) error {
+	paymentSvc, err := s.gateways.Service(customer.SourceId, customer.GatewayId, customer.Livemode)
+	if err != nil {
+		return err
+	}
+
+	var undetached []*pb.Card
+
+	for _, card := range customer.Cards {
+		err := paymentSvc.RemoveCustomerPaymentMethod(customer, card)
+		if err != nil {
+			log.Println("Could not detach card", card.Id, "of erased customer", customer.Id, err)
+			undetached = append(undetached, card)
+		}
+	}
+
+	err = paymentSvc.DeleteCustomer(customer)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.EraseCustomer(customer, undetached)
+}
+
+func (s *service) RetryCardDetaches() error {
+	pending, err := s.repo.SelectUndetachedCards(detachBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pending {
+		paymentSvc, err := s.gateways.Service(p.Customer.SourceId, p.Customer.GatewayId, p.Customer.Livemode)
+		if err != nil {
+			return err
+		}
+
+		err = paymentSvc.RemoveCustomerPaymentMethod(p.Customer, p.Card)
+		if gatewayFailure(err) {
+			log.Println("Could not detach card", p.Card.Id, "of erased customer", p.Customer.Id, err)
+			continue
+		}
+
+		// Any other error is the gateway's answer, such as the card having
+		// gone with the gateway customer, so there is nothing to retry.
+		if err != nil {
+			log.Println("Giving up detaching card", p.Card.Id, "of erased customer", p.Customer.Id, err)
+		}
+
+		err = s.repo.MarkCardDetached(p.Card)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// gatewayFailure reports whether err means the gateway could not be reached
+// or did not answer, as opposed to rejecting the request.
+func gatewayFailure(err error) bool {
+	return errors.Is(err, payments.ErrUnavailable) || errors.Is(err, payments.ErrTransient) || errors.Is(err, payments.ErrTimeout)
+}
+
+func (s *service) RestoreCustomer(sourceId, accountId int64, livemode bool) (*pb.Customer, error) {
+	if _, err := s.repo.SelectCustomerByAccountId(sourceId, accountId, livemode); err == nil {
+		return nil, status.Error(codes.AlreadyExists, "account already has an active customer")
+	}
+
+	err := s.repo.RestoreCustomer(sourceId, accountId, livemode)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetCustomerById(sourceId, accountId, livemode)
+}
+
+func (s *service) ListCustomers(filter *pb.CustomerFilter, livemode bool, limit, offset int64) ([]*pb.CustomerSummary, int64, error) {
+	return s.SearchCustomers(filter, livemode, "", "", limit, offset)
+}
+
+func (s *service) SearchCustomers(filter *pb.CustomerFilter, livemode bool, email, name string, limit, offset int64) ([]*pb.CustomerSummary, int64, error) {
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	if offset < 0 {
+		return nil, 0, status.Error(codes.InvalidArgument, "offset must not be negative")
+	}
+
+	customers, total, err := s.repo.SelectCustomers(filter, livemode, email, name, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	summaries, err := s.repo.SelectCustomerSummaries(customers)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return summaries, total, nil
+}
+
 func (s *service) AddCustomerPaymentMethod(customer *pb.Customer, card *pb.Card) (*pb.Card, error) {
 	log.Println("AddCustomerCard", card)
 
-	_, err := s.paymentSvc.AddCustomerPaymentMethod(customer, card)
+	paymentSvc, err := s.cardGateway(customer)
 	if err != nil {
 		return nil, err
 	}
 
+	vaulted, err := paymentSvc.AddCustomerPaymentMethod(customer, card)
+	if err != nil {
+		return nil, err
+	}
+
+	applyVaulted(card, vaulted)
+
+	card, err = s.saveCard(paymentSvc, customer, card)
+	if err != nil {
+		return nil, err
+	}
+
+	return redactCard(card), nil
+}
+
+func (s *service) CreateSetupIntent(customer *pb.Customer) (*pb.SetupIntent, error) {
+	paymentSvc, err := s.cardGateway(customer)
+	if err != nil {
+		return nil, err
+	}
+
+	return paymentSvc.CreateSetupIntent(customer)
+}
+
+func (s *service) CompleteSetupIntent(customer *pb.Customer, setupIntentId string) (*pb.SetupIntent, error) {
+	if setupIntentId == "" {
+		return nil, status.Error(codes.InvalidArgument, "setup_intent_id is required")
+	}
+
+	paymentSvc, err := s.cardGateway(customer)
+	if err != nil {
+		return nil, err
+	}
+
+	setup, err := paymentSvc.CompleteSetupIntent(customer, &pb.SetupIntent{ExtId: setupIntentId})
+	if err != nil {
+		return nil, err
+	}
+
+	// Until the cardholder has authenticated, nothing is saved.
+	if setup.Status != pb.SetupIntentStatus_SETUP_INTENT_STATUS_SUCCEEDED || setup.Card == nil {
+		setup.Card = nil
+		return setup, nil
+	}
+
+	log.Println("Setup intent succeeded", setup.ExtId, "for customer", customer.Id)
+
+	card := &pb.Card{}
+	applyVaulted(card, setup.Card)
+
+	card, err = s.saveCard(paymentSvc, customer, card)
+	if err != nil {
+		return nil, err
+	}
+
+	setup.Card = redactCard(card)
+
+	return setup, nil
+}
+
+// cardGateway checks that the customer may save cards and returns the
+// gateway they are saved on.
+func (s *service) cardGateway(customer *pb.Customer) (payments.PaymentService, error) {
+	err := s.blocklist.Check(&blocklist.Subject{
+		SourceId:      customer.SourceId,
+		AccountId:     customer.AccountId,
+		Email:         customer.Email,
+		CustomerExtId: customer.ExtId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.gateways.Service(customer.SourceId, customer.GatewayId, customer.Livemode)
+}
+
+// saveCard stores a card the gateway has saved for the customer.
+func (s *service) saveCard(paymentSvc payments.PaymentService, customer *pb.Customer, card *pb.Card) (*pb.Card, error) {
+	// The fingerprint is only known once the gateway has seen the card, so a
+	// blocked card is removed again.
+	err := s.blocklist.Check(&blocklist.Subject{SourceId: customer.SourceId, Fingerprint: card.Fingerprint})
+	if err != nil {
+		_ = paymentSvc.RemoveCustomerPaymentMethod(customer, card)
+		return nil, err
+	}
+
+	cards, err := s.repo.SelectCustomerCards(customer)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing := findDuplicate(cards, card); existing != nil {
+		return s.mergeCard(paymentSvc, customer, existing, card)
+	}
+
 	cardId, err := s.repo.AddCustomerCard(customer, card)
 	if err != nil {
 		return nil, err
@@ -91,6 +504,43 @@ func (s *service) AddCustomerPaymentMethod(customer *pb.Customer, card *pb.Card)
 
 	card.Id = cardId
 
+	// The first card, or one added while no card was usable, becomes the
+	// primary card.
+	if customer.PrimaryCardId == 0 {
+		err = s.repo.UpdateCustomerPrimaryCard(customer, card)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return card, nil
+}
+
+// mergeCard handles a card number the customer already has saved. The saved
+// card keeps its id, and with it its primary status, but takes over the new
+// gateway token and details, which may hold a new expiry date. The old token
+// is removed from the gateway.
+func (s *service) mergeCard(paymentSvc payments.PaymentService, customer *pb.Customer, existing, card *pb.Card) (*pb.Card, error) {
+	log.Println("Merging duplicate card", card.ExtId, "into", existing.Id)
+
+	old := existing.ExtId
+
+	card.Id = existing.Id
+	card.IdStr = existing.IdStr
+	card.Livemode = existing.Livemode
+
+	err := s.repo.UpdateCustomerCard(customer, card)
+	if err != nil {
+		return nil, err
+	}
+
+	if old != card.ExtId {
+		err = paymentSvc.RemoveCustomerPaymentMethod(customer, &pb.Card{ExtId: old})
+		if err != nil {
+			log.Println("Could not remove replaced payment method", old, err)
+		}
+	}
+
 	return card, nil
 }
 
@@ -105,6 +555,10 @@ func (s *service) GetCustomerPaymentMethod(customer *pb.Customer, cardId int64)
 	return card, nil
 }
 
+func (s *service) LoadCardCredentials(customer *pb.Customer, card *pb.Card) error {
+	return s.repo.SelectCardCredentials(customer, card)
+}
+
 func (s *service) SetCustomerPrimaryPaymentMethod(customer *pb.Customer, card *pb.Card) error {
 	log.Println("SetCustomerPrimaryPaymentMethod", card)
 
@@ -119,12 +573,27 @@ func (s *service) SetCustomerPrimaryPaymentMethod(customer *pb.Customer, card *p
 func (s *service) RemoveCustomerPaymentMethod(customer *pb.Customer, card *pb.Card) error {
 	log.Println("RemoveCustomerCard", card)
 
-	err := s.paymentSvc.RemoveCustomerPaymentMethod(customer, card)
+	paymentSvc, err := s.gateways.Service(customer.SourceId, customer.GatewayId, customer.Livemode)
+	if err != nil {
+		return err
+	}
+
+	err = paymentSvc.RemoveCustomerPaymentMethod(customer, card)
 	if err != nil {
 		return err
 	}
 
-	err = s.repo.DeleteCustomerCard(customer, card)
+	var replacement *pb.Card
+	if card.Id == customer.PrimaryCardId {
+		cards, err := s.repo.SelectCustomerCards(customer)
+		if err != nil {
+			return err
+		}
+
+		replacement = primaryFallback(cards, card.Id, time.Now())
+	}
+
+	err = s.repo.DeleteCustomerCard(customer, card, replacement)
 	if err != nil {
 		return err
 	}
@@ -3,8 +3,10 @@ package customers
 import (
 	"github.com/robertkohut/go-payments/internal/config"
 	db "github.com/robertkohut/go-payments/internal/services/repository"
+	"github.com/robertkohut/go-payments/pkg/blocklist"
 	"github.com/robertkohut/go-payments/pkg/metadata"
 	"github.com/robertkohut/go-payments/pkg/payments"
+	"github.com/robertkohut/go-payments/pkg/routing"
 	pb "github.com/robertkohut/go-payments/proto"
 	"testing"
 )
@@ -16,9 +18,17 @@ func setupServices() (Service, error) {
 		return nil, err
 	}
 
+	router, err := routing.NewEngine(conf.Routing)
+	if err != nil {
+		return nil, err
+	}
+
 	s := NewService(
-		payments.NewStripeService(conf.Stripe),
+		payments.NewStaticRegistry(payments.NewStripeService(conf.Stripe)),
+		router,
+		blocklist.NewService(blocklist.NewRepository(db, nil), nil),
 		NewRepository(db, nil),
+		conf.Cards,
 	)
 
 	return s, err
@@ -50,10 +60,9 @@ func TestDeleteCustomer(t *testing.T) {
 		t.Fatalf("Could not setup services: %v", err)
 	}
 
-	customer := &pb.Customer{
-		SourceId:  1,
-		AccountId: 55,
-		ExtId:     "cus_O0vtZdCIxvw98R",
+	customer, err := service.GetCustomerById(1, 55, false)
+	if err != nil {
+		t.Fatalf("Could not get customer: %v", err)
 	}
 
 	err = service.DeleteCustomer(customer)
@@ -0,0 +1,74 @@
+package customers
+
+import (
+	"github.com/robertkohut/go-payments/pkg/blocklist"
+	"github.com/robertkohut/go-payments/pkg/payments"
+	pb "github.com/robertkohut/go-payments/proto"
+	"testing"
+)
+
+// allowAll blocks nothing.
+type allowAll struct {
+	blocklist.Service
+}
+
+func (allowAll) Check(*blocklist.Subject) error {
+	return nil
+}
+
+// setupGateway completes setup intents with the status it is given.
+type setupGateway struct {
+	payments.PaymentService
+	status pb.SetupIntentStatus
+}
+
+func (g *setupGateway) CompleteSetupIntent(_ *pb.Customer, setup *pb.SetupIntent) (*pb.SetupIntent, error) {
+	result := &pb.SetupIntent{ExtId: setup.ExtId, Status: g.status}
+	if g.status == pb.SetupIntentStatus_SETUP_INTENT_STATUS_SUCCEEDED {
+		result.Card = &pb.Card{ExtId: "pm_1", Fingerprint: "fp_1", Mandate: "mandate_1", SetupIntentId: setup.ExtId}
+	}
+	return result, nil
+}
+
+func (r *memoryRepository) AddCustomerCard(customer *pb.Customer, card *pb.Card) (int64, error) {
+	card.Id = int64(len(r.cards[customer.Id]) + 1)
+	r.cards[customer.Id] = append(r.cards[customer.Id], card)
+	return card.Id, nil
+}
+
+func TestCompleteSetupIntent(t *testing.T) {
+	repo := &memoryRepository{cards: map[int64][]*pb.Card{}, primary: map[int64]int64{}}
+	gateway := &setupGateway{status: pb.SetupIntentStatus_SETUP_INTENT_STATUS_REQUIRES_ACTION}
+
+	s := &service{gateways: payments.NewStaticRegistry(gateway), blocklist: allowAll{}, repo: repo}
+	customer := &pb.Customer{Id: 1}
+
+	setup, err := s.CompleteSetupIntent(customer, "seti_1")
+	if err != nil {
+		t.Fatalf("Could not complete setup intent: %v", err)
+	}
+
+	if setup.Card != nil || len(repo.cards[1]) != 0 {
+		t.Errorf("Expected no card to be saved before the setup succeeded, got %v", repo.cards[1])
+	}
+
+	gateway.status = pb.SetupIntentStatus_SETUP_INTENT_STATUS_SUCCEEDED
+
+	setup, err = s.CompleteSetupIntent(customer, "seti_1")
+	if err != nil {
+		t.Fatalf("Could not complete setup intent: %v", err)
+	}
+
+	card := setup.Card
+	if card == nil || card.Id != 1 || card.Mandate != "" || card.SetupIntentId != "seti_1" {
+		t.Errorf("Expected the saved card without its mandate, got %v", card)
+	}
+
+	if saved := repo.cards[1]; len(saved) != 1 || saved[0].Mandate != "mandate_1" {
+		t.Errorf("Expected the card to be saved with its mandate, got %v", saved)
+	}
+
+	if repo.primary[1] != 1 {
+		t.Errorf("Expected the first card to become the primary card, got %d", repo.primary[1])
+	}
+}
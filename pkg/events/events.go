@@ -0,0 +1,80 @@
+package events
+
+import (
+	"github.com/robertkohut/go-payments/pkg/metadata"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	CustomerCreated = "customer.created"
+	CustomerUpdated = "customer.updated"
+	CustomerDeleted = "customer.deleted"
+	CardAdded       = "card.added"
+	CardUpdated     = "card.updated"
+	CardExpiring    = "card.expiring"
+	CardRemoved     = "card.removed"
+	ChargeSucceeded = "charge.succeeded"
+	ChargeFailed    = "charge.failed"
+	ChargeHeld      = "charge.held_for_review"
+	ChargeCanceled  = "charge.canceled"
+	RefundCreated   = "refund.created"
+)
+
+var types = []string{
+	CustomerCreated,
+	CustomerUpdated,
+	CustomerDeleted,
+	CardAdded,
+	CardUpdated,
+	CardExpiring,
+	CardRemoved,
+	ChargeSucceeded,
+	ChargeFailed,
+	ChargeHeld,
+	ChargeCanceled,
+	RefundCreated,
+}
+
+// IsType reports whether t is a known event type.
+func IsType(t string) bool {
+	for _, known := range types {
+		if known == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// New builds an event of the given type for a customer, carrying msg as its data.
+func New(eventType string, customerId int64, msg proto.Message) (*pb.Event, error) {
+	data, err := toStruct(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Event{
+		Type:       eventType,
+		CustomerId: customerId,
+		Data:       data,
+	}, nil
+}
+
+// toStruct converts msg to its JSON form without internal ids, so they never
+// leave the service.
+func toStruct(msg proto.Message) (*structpb.Struct, error) {
+	b, err := protojson.Marshal(metadata.HideInternalIds(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	data := &structpb.Struct{}
+	if err := protojson.Unmarshal(b, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
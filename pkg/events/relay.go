@@ -0,0 +1,66 @@
+package events
+
+import (
+	"log"
+)
+
+// Relay publishes outbox events to a sink. Events are delivered at least once
+// and in order per customer: once an event fails, later events for the same
+// customer wait until it has been published.
+type Relay struct {
+	repo      Repository
+	sink      Sink
+	batchSize int
+}
+
+func NewRelay(repo Repository, sink Sink, batchSize int) *Relay {
+	return &Relay{
+		repo:      repo,
+		sink:      sink,
+		batchSize: batchSize,
+	}
+}
+
+// Publish sends up to one batch of unpublished events and returns how many
+// were delivered. Customers whose events fail are skipped when selecting
+// more, so they cannot hold up everyone else's events.
+func (r *Relay) Publish() (int, error) {
+	blocked := make(map[int64]bool)
+	published := 0
+
+	for published < r.batchSize {
+		var exclude []int64
+		for customerId := range blocked {
+			exclude = append(exclude, customerId)
+		}
+
+		events, err := r.repo.SelectUnpublishedEvents(exclude, r.batchSize-published)
+		if err != nil {
+			return published, err
+		}
+
+		if len(events) == 0 {
+			return published, nil
+		}
+
+		for _, event := range events {
+			if blocked[event.CustomerId] {
+				continue
+			}
+
+			if err := r.sink.Publish(event); err != nil {
+				log.Println("Relay -> Publish():", event.Id, event.Type, err)
+				blocked[event.CustomerId] = true
+				continue
+			}
+
+			if err := r.repo.MarkEventPublished(event); err != nil {
+				return published, err
+			}
+
+			published++
+		}
+	}
+
+	return published, nil
+}
@@ -0,0 +1,110 @@
+package events
+
+import (
+	"errors"
+	pb "github.com/robertkohut/go-payments/proto"
+	"testing"
+)
+
+type memoryRepository struct {
+	events    []*pb.Event
+	published map[int64]bool
+}
+
+func (r *memoryRepository) SelectUnpublishedEvents(exclude []int64, limit int) ([]*pb.Event, error) {
+	skip := map[int64]bool{}
+	for _, customerId := range exclude {
+		skip[customerId] = true
+	}
+
+	var events []*pb.Event
+	for _, e := range r.events {
+		if !r.published[e.Id] && !skip[e.CustomerId] && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (r *memoryRepository) MarkEventPublished(event *pb.Event) error {
+	r.published[event.Id] = true
+	return nil
+}
+
+type failingSink struct {
+	fail      map[int64]bool
+	delivered []int64
+}
+
+func (s *failingSink) Publish(event *pb.Event) error {
+	if s.fail[event.Id] {
+		return errors.New("unavailable")
+	}
+	s.delivered = append(s.delivered, event.Id)
+	return nil
+}
+
+func TestRelayKeepsCustomerOrder(t *testing.T) {
+	repo := &memoryRepository{
+		events: []*pb.Event{
+			{Id: 1, CustomerId: 10},
+			{Id: 2, CustomerId: 20},
+			{Id: 3, CustomerId: 10},
+			{Id: 4, CustomerId: 20},
+		},
+		published: map[int64]bool{},
+	}
+	sink := &failingSink{fail: map[int64]bool{1: true}}
+
+	relay := NewRelay(repo, sink, 10)
+
+	n, err := relay.Publish()
+	if err != nil {
+		t.Fatalf("Could not publish events: %v", err)
+	}
+
+	if n != 2 || repo.published[3] {
+		t.Fatalf("expected only customer 20 to be published, got %v", sink.delivered)
+	}
+
+	sink.fail = nil
+
+	n, err = relay.Publish()
+	if err != nil {
+		t.Fatalf("Could not publish events: %v", err)
+	}
+
+	want := []int64{2, 4, 1, 3}
+	if n != 2 || len(sink.delivered) != len(want) {
+		t.Fatalf("got deliveries %v, want %v", sink.delivered, want)
+	}
+
+	for i := range want {
+		if sink.delivered[i] != want[i] {
+			t.Fatalf("got deliveries %v, want %v", sink.delivered, want)
+		}
+	}
+}
+
+func TestRelaySkipsPastFailingCustomer(t *testing.T) {
+	repo := &memoryRepository{published: map[int64]bool{}}
+	sink := &failingSink{fail: map[int64]bool{}}
+
+	// Customer 10's events fill more than a batch and keep failing.
+	for id := int64(1); id <= 5; id++ {
+		repo.events = append(repo.events, &pb.Event{Id: id, CustomerId: 10})
+		sink.fail[id] = true
+	}
+	repo.events = append(repo.events, &pb.Event{Id: 6, CustomerId: 20})
+
+	relay := NewRelay(repo, sink, 3)
+
+	n, err := relay.Publish()
+	if err != nil {
+		t.Fatalf("Could not publish events: %v", err)
+	}
+
+	if n != 1 || !repo.published[6] {
+		t.Fatalf("expected customer 20's event to be published, got %v", sink.delivered)
+	}
+}
@@ -0,0 +1,135 @@
+package events
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/robertkohut/go-payments/internal/services/hashid"
+	"github.com/robertkohut/go-payments/pkg/metadata"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+type Repository interface {
+	// SelectUnpublishedEvents returns the oldest unpublished events, skipping
+	// those of the customers in exclude.
+	SelectUnpublishedEvents(exclude []int64, limit int) ([]*pb.Event, error)
+	MarkEventPublished(event *pb.Event) error
+}
+
+type repository struct {
+	db *sqlx.DB
+	hd *hashid.Service
+}
+
+func NewRepository(db *sqlx.DB, hd *hashid.Service) Repository {
+	return &repository{db: db, hd: hd}
+}
+
+// Insert writes an event to the outbox within tx, so it is only published if
+// the state change it describes is committed. The source, account and mode
+// are copied from the customer row.
+func Insert(tx *sqlx.Tx, eventType string, customerId int64, msg proto.Message) error {
+	stmt := `INSERT INTO events (type, source_id, account_id, customer_id, livemode, data)
+			 SELECT ?, source_id, account_id, id, livemode, ? FROM customers WHERE id = ?`
+
+	event, err := New(eventType, customerId, msg)
+	if err != nil {
+		return err
+	}
+
+	data, err := protojson.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(stmt, event.Type, data, event.CustomerId)
+
+	return err
+}
+
+// EraseCustomerData blanks the data of every event about a customer within tx.
+func EraseCustomerData(tx *sqlx.Tx, customerId int64) error {
+	stmt := `UPDATE events SET data = JSON_OBJECT() WHERE customer_id = ?`
+
+	_, err := tx.Exec(stmt, customerId)
+
+	return err
+}
+
+func (r *repository) SelectUnpublishedEvents(exclude []int64, limit int) ([]*pb.Event, error) {
+	var events []*pb.Event
+
+	stmt := `SELECT id, type, source_id, account_id, customer_id, livemode, data, created_at FROM events
+			 WHERE published_at IS NULL`
+	var args []interface{}
+
+	if len(exclude) > 0 {
+		var err error
+		stmt, args, err = sqlx.In(stmt+` AND customer_id NOT IN (?)`, exclude)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stmt += ` ORDER BY id ASC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		event := &pb.Event{Data: &structpb.Struct{}}
+
+		var data []byte
+		var createdAt time.Time
+
+		err := rows.Scan(
+			&event.Id,
+			&event.Type,
+			&event.SourceId,
+			&event.AccountId,
+			&event.CustomerId,
+			&event.Livemode,
+			&data,
+			&createdAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := protojson.Unmarshal(data, event.Data); err != nil {
+			return nil, err
+		}
+
+		event.CreatedAt = timestamppb.New(createdAt)
+
+		event.IdStr, err = r.hd.Encode([]int64{event.Id, metadata.HDEventId})
+		if err != nil {
+			return nil, err
+		}
+
+		event.CustomerIdStr, err = r.hd.Encode([]int64{event.CustomerId, metadata.HDCustomerId})
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (r *repository) MarkEventPublished(event *pb.Event) error {
+	stmt := `UPDATE events SET published_at = CURRENT_TIMESTAMP WHERE id = ?`
+
+	_, err := r.db.Exec(stmt, event.Id)
+
+	return err
+}
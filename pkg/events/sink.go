@@ -0,0 +1,112 @@
+package events
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/robertkohut/go-payments/pkg/metadata"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+type Sink interface {
+	Publish(event *pb.Event) error
+}
+
+// NewSink returns the sink named by kind: "stdout", "file" or "http".
+func NewSink(kind, path, url string) (Sink, error) {
+	switch kind {
+	case "stdout":
+		return NewWriterSink(os.Stdout), nil
+	case "file":
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			return nil, err
+		}
+		return NewWriterSink(f), nil
+	case "http":
+		return NewHTTPSink(url), nil
+	default:
+		return nil, fmt.Errorf("unknown event sink %q", kind)
+	}
+}
+
+type multiSink []Sink
+
+// NewMultiSink publishes every event to each of sinks. An event counts as
+// published only once all of them have accepted it.
+func NewMultiSink(sinks ...Sink) Sink {
+	return multiSink(sinks)
+}
+
+func (m multiSink) Publish(event *pb.Event) error {
+	for _, sink := range m {
+		if err := sink.Publish(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink writes each event as a line of JSON.
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+func (s *writerSink) Publish(event *pb.Event) error {
+	b, err := protojson.Marshal(metadata.HideInternalIds(event))
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(append(b, '\n'))
+
+	return err
+}
+
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink POSTs each event as JSON to url. Any non-2xx response is a failure.
+func NewHTTPSink(url string) Sink {
+	return &httpSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *httpSink) Publish(event *pb.Event) error {
+	b, err := protojson.Marshal(metadata.HideInternalIds(event))
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("event sink returned %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package metadata
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// HideInternalIds returns a copy of msg without internal ids. An int64 field
+// is an internal id if the message has a string field of the same name with
+// an "_str" suffix, its hashid, as with id and id_str. msg is left as is.
+func HideInternalIds[T proto.Message](msg T) T {
+	hidden := proto.Clone(msg).(T)
+	hideIds(hidden.ProtoReflect())
+
+	return hidden
+}
+
+func hideIds(m protoreflect.Message) {
+	fields := m.Descriptor().Fields()
+
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+					hideIds(mv.Message())
+					return true
+				})
+			}
+		case fd.IsList():
+			if fd.Message() != nil {
+				for i := 0; i < v.List().Len(); i++ {
+					hideIds(v.List().Get(i).Message())
+				}
+			}
+		case fd.Message() != nil:
+			hideIds(v.Message())
+		case fd.Kind() == protoreflect.Int64Kind:
+			if str := fields.ByName(fd.Name() + "_str"); str != nil && str.Kind() == protoreflect.StringKind {
+				m.Clear(fd)
+			}
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,41 @@
+package metadata
+
+import (
+	pb "github.com/robertkohut/go-payments/proto"
+	"testing"
+)
+
+func TestHideInternalIds(t *testing.T) {
+	charge := &pb.Charge{
+		Id:            51,
+		IdStr:         "ch_x",
+		CustomerId:    7,
+		CustomerIdStr: "cus_x",
+		PmId:          12,
+		PmIdStr:       "card_x",
+		AccountId:     55,
+		Amount:        1234,
+	}
+
+	resp := &pb.ListExpiringCardsResponse{
+		Cards: []*pb.ExpiringCard{{CustomerId: 7, CustomerIdStr: "cus_x", Card: &pb.Card{Id: 12, IdStr: "card_x"}}},
+	}
+
+	hidden := HideInternalIds(charge)
+	if hidden.Id != 0 || hidden.CustomerId != 0 || hidden.PmId != 0 {
+		t.Errorf("Expected internal ids to be cleared, got %v", hidden)
+	}
+
+	if hidden.IdStr != "ch_x" || hidden.CustomerIdStr != "cus_x" || hidden.AccountId != 55 || hidden.Amount != 1234 {
+		t.Errorf("Expected hashids and other fields to be kept, got %v", hidden)
+	}
+
+	if charge.Id != 51 || charge.CustomerId != 7 {
+		t.Errorf("Expected the original message to be left as is, got %v", charge)
+	}
+
+	card := HideInternalIds(resp).Cards[0]
+	if card.CustomerId != 0 || card.Card.Id != 0 || card.Card.IdStr != "card_x" {
+		t.Errorf("Expected nested internal ids to be cleared, got %v", card)
+	}
+}
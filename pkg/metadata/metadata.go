@@ -1,21 +1,76 @@
 package metadata
 
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
 const (
 	PaymentSourceStripe = 1
 )
 
 const (
 	FlagsCardActive = 1 << iota
-	FagsCardDefault
+	FlagsCardDefault
+	// FlagsCardDetachPending marks cards of erased customers that could not
+	// be detached at the gateway yet.
+	FlagsCardDetachPending
 )
 
 const (
 	FlagsCustomerActive = 1 << iota
+	FlagsCustomerErased
+)
+
+const (
+	FlagsWebhookEndpointActive = 1 << iota
+)
+
+const (
+	FlagsOrganizationActive = 1 << iota
+)
+
+const (
+	FlagsOrganizationAccountActive = 1 << iota
+)
+
+const (
+	FlagsBlocklistEntryActive = 1 << iota
 )
 
 // HashId Service Constants
 const (
-	HDInvoiceId = 50
-	HDChargeId  = 51
-	HDCardId    = 52
+	HDInvoiceId         = 50
+	HDChargeId          = 51
+	HDCardId            = 52
+	HDEventId           = 53
+	HDWebhookEndpointId = 54
+	HDWebhookDeliveryId = 55
+	HDCustomerId        = 56
+	HDOrganizationId    = 57
+	HDBlocklistEntryId  = 58
+)
+
+const (
+	maxMetadataKeys        = 50
+	maxMetadataKeyLength   = 40
+	maxMetadataValueLength = 500
 )
+
+// Validate checks a metadata map against the key count and length limits.
+func Validate(m map[string]string) error {
+	if len(m) > maxMetadataKeys {
+		return status.Errorf(codes.InvalidArgument, "metadata can have at most %d keys", maxMetadataKeys)
+	}
+
+	for k, v := range m {
+		if k == "" || len(k) > maxMetadataKeyLength {
+			return status.Errorf(codes.InvalidArgument, "metadata keys must be 1 to %d characters", maxMetadataKeyLength)
+		}
+		if len(v) > maxMetadataValueLength {
+			return status.Errorf(codes.InvalidArgument, "metadata value for %q exceeds %d characters", k, maxMetadataValueLength)
+		}
+	}
+
+	return nil
+}
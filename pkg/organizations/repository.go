@@ -0,0 +1,183 @@
+package organizations
+
+import (
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/robertkohut/go-payments/internal/services/hashid"
+	"github.com/robertkohut/go-payments/pkg/metadata"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log"
+	"time"
+)
+
+type Repository interface {
+	InsertOrganization(org *pb.Organization) (int64, error)
+	SelectOrganization(sourceId, orgId int64, livemode bool) (*pb.Organization, error)
+	SelectAccountOrganization(sourceId, accountId int64, livemode bool) (*pb.Organization, error)
+
+	LinkAccount(org *pb.Organization, accountId int64) error
+	UnlinkAccount(org *pb.Organization, accountId int64) error
+}
+
+type repository struct {
+	db *sqlx.DB
+	hd *hashid.Service
+}
+
+func NewRepository(db *sqlx.DB, hd *hashid.Service) Repository {
+	return &repository{db: db, hd: hd}
+}
+
+// selectOrganizationsStmt lists the columns read by scanOrganization. The
+// billing customer is only referenced by id; the service loads it.
+const selectOrganizationsStmt = `SELECT o.id,
+                    o.source_id,
+                    o.org_id,
+                    o.customer_id,
+                    o.name,
+                    o.flags,
+                    o.livemode,
+                    o.created_at
+            FROM organizations o`
+
+func (r *repository) InsertOrganization(org *pb.Organization) (int64, error) {
+	stmt := `INSERT INTO organizations (source_id, org_id, customer_id, name, flags, livemode) VALUES (?, ?, ?, ?, ?, ?)`
+
+	org.Flags = org.Flags | metadata.FlagsOrganizationActive
+
+	result, err := r.db.Exec(stmt, org.SourceId, org.OrgId, org.GetCustomer().GetId(), org.Name, org.Flags, org.Livemode)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	org.Id, err = result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	org.IdStr, err = r.hd.Encode([]int64{org.Id, metadata.HDOrganizationId})
+	org.CreatedAt = timestamppb.Now()
+
+	return org.Id, err
+}
+
+func (r *repository) SelectOrganization(sourceId, orgId int64, livemode bool) (*pb.Organization, error) {
+	stmt := selectOrganizationsStmt + `
+             WHERE o.source_id = ?
+               AND o.org_id = ?
+               AND o.livemode = ?
+               AND (o.flags & ?) = ?`
+
+	row := r.db.QueryRow(stmt, sourceId, orgId, livemode, metadata.FlagsOrganizationActive, metadata.FlagsOrganizationActive)
+
+	return r.scanOrganization(row)
+}
+
+// SelectAccountOrganization returns the organization an account is linked to.
+func (r *repository) SelectAccountOrganization(sourceId, accountId int64, livemode bool) (*pb.Organization, error) {
+	stmt := selectOrganizationsStmt + `
+             INNER JOIN organization_accounts oa ON oa.organization_id = o.id
+             WHERE oa.source_id = ?
+               AND oa.account_id = ?
+               AND oa.livemode = ?
+               AND (oa.flags & ?) = ?
+               AND (o.flags & ?) = ?`
+
+	row := r.db.QueryRow(stmt,
+		sourceId,
+		accountId,
+		livemode,
+		metadata.FlagsOrganizationAccountActive,
+		metadata.FlagsOrganizationAccountActive,
+		metadata.FlagsOrganizationActive,
+		metadata.FlagsOrganizationActive,
+	)
+
+	return r.scanOrganization(row)
+}
+
+func (r *repository) scanOrganization(row *sql.Row) (*pb.Organization, error) {
+	org := &pb.Organization{Customer: &pb.Customer{}}
+
+	var createdAt time.Time
+
+	switch err := row.Scan(
+		&org.Id,
+		&org.SourceId,
+		&org.OrgId,
+		&org.Customer.Id,
+		&org.Name,
+		&org.Flags,
+		&org.Livemode,
+		&createdAt,
+	); err {
+	case sql.ErrNoRows:
+		return nil, status.Error(codes.NotFound, "organization not found")
+	case nil:
+	default:
+		return nil, err
+	}
+
+	org.CreatedAt = timestamppb.New(createdAt)
+	org.IdStr, _ = r.hd.Encode([]int64{org.Id, metadata.HDOrganizationId})
+
+	var err error
+	org.AccountIds, err = r.selectAccountIds(org)
+	if err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+func (r *repository) selectAccountIds(org *pb.Organization) ([]int64, error) {
+	var accountIds []int64
+
+	stmt := `SELECT account_id FROM organization_accounts
+             WHERE organization_id = ?
+               AND (flags & ?) = ?
+             ORDER BY account_id ASC`
+
+	err := r.db.Select(&accountIds, stmt, org.Id, metadata.FlagsOrganizationAccountActive, metadata.FlagsOrganizationAccountActive)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return accountIds, nil
+}
+
+// LinkAccount links an account to an organization. An account has a single
+// link row per source and mode, reused when it is linked again.
+func (r *repository) LinkAccount(org *pb.Organization, accountId int64) error {
+	stmt := `INSERT INTO organization_accounts (organization_id, source_id, account_id, livemode, flags)
+             VALUES (?, ?, ?, ?, ?)
+             ON DUPLICATE KEY UPDATE organization_id = VALUES(organization_id),
+                                     flags = flags | VALUES(flags)`
+
+	_, err := r.db.Exec(stmt, org.Id, org.SourceId, accountId, org.Livemode, metadata.FlagsOrganizationAccountActive)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) UnlinkAccount(org *pb.Organization, accountId int64) error {
+	stmt := `UPDATE organization_accounts SET flags = flags &~ ?
+             WHERE organization_id = ?
+               AND account_id = ?`
+
+	_, err := r.db.Exec(stmt, metadata.FlagsOrganizationAccountActive, org.Id, accountId)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
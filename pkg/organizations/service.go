@@ -0,0 +1,133 @@
+package organizations
+
+import (
+	"github.com/robertkohut/go-payments/pkg/customers"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+)
+
+type Service interface {
+	CreateOrganization(org *pb.Organization) (*pb.Organization, error)
+	GetOrganization(sourceId, orgId int64, livemode bool) (*pb.Organization, error)
+	GetAccountOrganization(sourceId, accountId int64, livemode bool) (*pb.Organization, error)
+
+	LinkAccount(org *pb.Organization, accountId int64) (*pb.Organization, error)
+	UnlinkAccount(org *pb.Organization, accountId int64) (*pb.Organization, error)
+}
+
+type service struct {
+	customerSvc customers.Service
+	repo        Repository
+}
+
+func NewService(customerSvc customers.Service, repo Repository) Service {
+	return &service{
+		customerSvc: customerSvc,
+		repo:        repo,
+	}
+}
+
+// CreateOrganization creates an organization along with its billing
+// customer, which is created at the gateway like any other customer but is
+// not tied to an account.
+func (s *service) CreateOrganization(org *pb.Organization) (*pb.Organization, error) {
+	if org.GetSourceId() == 0 || org.GetOrgId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "source id and org id are required")
+	}
+
+	_, err := s.repo.SelectOrganization(org.SourceId, org.OrgId, org.Livemode)
+	if err == nil {
+		return nil, status.Error(codes.AlreadyExists, "organization already exists")
+	}
+	if status.Code(err) != codes.NotFound {
+		return nil, err
+	}
+
+	billing := org.GetCustomer()
+	if billing == nil {
+		billing = &pb.Customer{}
+	}
+	billing.SourceId = org.SourceId
+	billing.OrgId = org.OrgId
+	billing.AccountId = 0
+	billing.Livemode = org.Livemode
+	if billing.Name == "" {
+		billing.Name = org.Name
+	}
+
+	if _, err := s.customerSvc.AddCustomer(billing); err != nil {
+		return nil, err
+	}
+
+	org.Customer = billing
+
+	if _, err := s.repo.InsertOrganization(org); err != nil {
+		if eraseErr := s.customerSvc.EraseCustomer(billing); eraseErr != nil {
+			log.Println("Could not erase billing customer", billing.Id, eraseErr)
+		}
+		return nil, err
+	}
+
+	return org, nil
+}
+
+func (s *service) GetOrganization(sourceId, orgId int64, livemode bool) (*pb.Organization, error) {
+	org, err := s.repo.SelectOrganization(sourceId, orgId, livemode)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.loadCustomer(org)
+}
+
+func (s *service) GetAccountOrganization(sourceId, accountId int64, livemode bool) (*pb.Organization, error) {
+	org, err := s.repo.SelectAccountOrganization(sourceId, accountId, livemode)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.loadCustomer(org)
+}
+
+// LinkAccount links an account to the organization. An account can only be
+// linked to one organization at a time.
+func (s *service) LinkAccount(org *pb.Organization, accountId int64) (*pb.Organization, error) {
+	if accountId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "account id is required")
+	}
+
+	current, err := s.repo.SelectAccountOrganization(org.SourceId, accountId, org.Livemode)
+	if err == nil && current.Id != org.Id {
+		return nil, status.Error(codes.FailedPrecondition, "account is linked to another organization")
+	}
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, err
+	}
+
+	if err := s.repo.LinkAccount(org, accountId); err != nil {
+		return nil, err
+	}
+
+	return s.GetOrganization(org.SourceId, org.OrgId, org.Livemode)
+}
+
+func (s *service) UnlinkAccount(org *pb.Organization, accountId int64) (*pb.Organization, error) {
+	if err := s.repo.UnlinkAccount(org, accountId); err != nil {
+		return nil, err
+	}
+
+	return s.GetOrganization(org.SourceId, org.OrgId, org.Livemode)
+}
+
+func (s *service) loadCustomer(org *pb.Organization) (*pb.Organization, error) {
+	customer, err := s.customerSvc.GetCustomer(org.SourceId, org.GetCustomer().GetId(), org.Livemode)
+	if err != nil {
+		return nil, err
+	}
+
+	org.Customer = customer
+
+	return org, nil
+}
@@ -0,0 +1,193 @@
+package organizations
+
+import (
+	"errors"
+	"github.com/robertkohut/go-payments/pkg/customers"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+// memoryRepository holds organizations and account links in memory.
+type memoryRepository struct {
+	orgs      []*pb.Organization
+	links     map[int64]int64 // account id to organization id
+	insertErr error
+}
+
+func (r *memoryRepository) InsertOrganization(org *pb.Organization) (int64, error) {
+	if r.insertErr != nil {
+		return 0, r.insertErr
+	}
+	org.Id = int64(len(r.orgs) + 1)
+	r.orgs = append(r.orgs, org)
+	return org.Id, nil
+}
+
+func (r *memoryRepository) SelectOrganization(sourceId, orgId int64, livemode bool) (*pb.Organization, error) {
+	for _, o := range r.orgs {
+		if o.SourceId == sourceId && o.OrgId == orgId && o.Livemode == livemode {
+			return r.withAccounts(o), nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, "organization not found")
+}
+
+func (r *memoryRepository) SelectAccountOrganization(sourceId, accountId int64, livemode bool) (*pb.Organization, error) {
+	for _, o := range r.orgs {
+		if o.Id == r.links[accountId] && o.SourceId == sourceId && o.Livemode == livemode {
+			return r.withAccounts(o), nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, "organization not found")
+}
+
+func (r *memoryRepository) withAccounts(org *pb.Organization) *pb.Organization {
+	org.AccountIds = nil
+	for accountId, orgId := range r.links {
+		if orgId == org.Id {
+			org.AccountIds = append(org.AccountIds, accountId)
+		}
+	}
+	return org
+}
+
+func (r *memoryRepository) LinkAccount(org *pb.Organization, accountId int64) error {
+	r.links[accountId] = org.Id
+	return nil
+}
+
+func (r *memoryRepository) UnlinkAccount(org *pb.Organization, accountId int64) error {
+	if r.links[accountId] == org.Id {
+		delete(r.links, accountId)
+	}
+	return nil
+}
+
+// billingCustomers creates and erases customers in memory.
+type billingCustomers struct {
+	customers.Service
+	created []*pb.Customer
+	erased  []*pb.Customer
+}
+
+func (c *billingCustomers) AddCustomer(customer *pb.Customer) (*string, error) {
+	customer.Id = int64(len(c.created) + 100)
+	extId := "cus_1"
+	customer.ExtId = extId
+	c.created = append(c.created, customer)
+	return &extId, nil
+}
+
+func (c *billingCustomers) GetCustomer(sourceId, customerId int64, livemode bool) (*pb.Customer, error) {
+	for _, customer := range c.created {
+		if customer.Id == customerId {
+			return customer, nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, "customer not found")
+}
+
+func (c *billingCustomers) EraseCustomer(customer *pb.Customer) error {
+	c.erased = append(c.erased, customer)
+	return nil
+}
+
+func newTestService() (*service, *memoryRepository, *billingCustomers) {
+	repo := &memoryRepository{links: map[int64]int64{}}
+	customerSvc := &billingCustomers{}
+	return &service{customerSvc: customerSvc, repo: repo}, repo, customerSvc
+}
+
+func TestCreateOrganization(t *testing.T) {
+	s, repo, customerSvc := newTestService()
+
+	if _, err := s.CreateOrganization(&pb.Organization{SourceId: 1}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument without an org id, got %v", err)
+	}
+
+	org, err := s.CreateOrganization(&pb.Organization{SourceId: 1, OrgId: 7, Name: "Acme", Customer: &pb.Customer{AccountId: 3}})
+	if err != nil {
+		t.Fatalf("Could not create organization: %v", err)
+	}
+
+	billing := org.GetCustomer()
+	if billing.GetId() == 0 || billing.AccountId != 0 || billing.OrgId != 7 || billing.Name != "Acme" {
+		t.Errorf("Expected a billing customer of the organization without an account, got %v", billing)
+	}
+
+	if _, err := s.CreateOrganization(&pb.Organization{SourceId: 1, OrgId: 7}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("Expected AlreadyExists for a second organization 7, got %v", err)
+	}
+
+	// A test mode organization is separate from the live one.
+	if _, err := s.CreateOrganization(&pb.Organization{SourceId: 1, OrgId: 7, Livemode: true}); err != nil {
+		t.Errorf("Could not create the live organization 7: %v", err)
+	}
+
+	// The billing customer is not left behind when the organization cannot
+	// be stored.
+	repo.insertErr = errors.New("db down")
+
+	if _, err := s.CreateOrganization(&pb.Organization{SourceId: 1, OrgId: 8}); err == nil {
+		t.Fatalf("Expected the failed insert to be returned")
+	}
+
+	if len(customerSvc.erased) != 1 || customerSvc.erased[0].OrgId != 8 {
+		t.Errorf("Expected the billing customer of organization 8 to be erased, got %v", customerSvc.erased)
+	}
+}
+
+func TestLinkAccount(t *testing.T) {
+	s, _, _ := newTestService()
+
+	acme, err := s.CreateOrganization(&pb.Organization{SourceId: 1, OrgId: 7})
+	if err != nil {
+		t.Fatalf("Could not create organization: %v", err)
+	}
+
+	other, err := s.CreateOrganization(&pb.Organization{SourceId: 1, OrgId: 8})
+	if err != nil {
+		t.Fatalf("Could not create organization: %v", err)
+	}
+
+	if _, err := s.LinkAccount(acme, 0); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument without an account, got %v", err)
+	}
+
+	org, err := s.LinkAccount(acme, 3)
+	if err != nil || len(org.AccountIds) != 1 || org.AccountIds[0] != 3 {
+		t.Fatalf("Expected account 3 to be linked, got %v, %v", org, err)
+	}
+
+	if org.GetCustomer().GetId() != acme.GetCustomer().GetId() {
+		t.Errorf("Expected the billing customer to be loaded, got %v", org.GetCustomer())
+	}
+
+	// Linking again to the same organization is allowed.
+	if _, err := s.LinkAccount(acme, 3); err != nil {
+		t.Errorf("Expected relinking to the same organization to succeed, got %v", err)
+	}
+
+	if _, err := s.LinkAccount(other, 3); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Expected FailedPrecondition for an account linked elsewhere, got %v", err)
+	}
+
+	found, err := s.GetAccountOrganization(1, 3, false)
+	if err != nil || found.OrgId != 7 {
+		t.Errorf("Expected account 3 to belong to organization 7, got %v, %v", found, err)
+	}
+
+	if _, err := s.UnlinkAccount(acme, 3); err != nil {
+		t.Fatalf("Could not unlink account: %v", err)
+	}
+
+	if _, err := s.GetAccountOrganization(1, 3, false); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound once unlinked, got %v", err)
+	}
+
+	if _, err := s.LinkAccount(other, 3); err != nil {
+		t.Errorf("Expected an unlinked account to join another organization, got %v", err)
+	}
+}
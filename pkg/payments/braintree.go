@@ -0,0 +1,570 @@
+package payments
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/robertkohut/go-payments/internal/config"
+	pb "github.com/robertkohut/go-payments/proto"
+	"golang.org/x/text/language"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GatewayBraintree is the gateway_id of customers and charges created on
+// Braintree.
+const GatewayBraintree = 2
+
+const braintreeTimeout = 30 * time.Second
+
+func init() {
+	Register(GatewayBraintree, "braintree", NewBraintreeService)
+}
+
+// braintreeService talks to Braintree's REST-style API. Requests are
+// authenticated with the public key (pk) and private key (sk) and scoped to
+// the merchant account.
+type braintreeService struct {
+	baseURL    string
+	merchantId string
+	publicKey  string
+	privateKey string
+	client     *http.Client
+}
+
+func NewBraintreeService(cfg *config.GatewayConfig) PaymentService {
+	return &braintreeService{
+		baseURL:    cfg.URL,
+		merchantId: cfg.MerchantId,
+		publicKey:  cfg.PublishableKey,
+		privateKey: cfg.SecretKey,
+		client:     &http.Client{Timeout: braintreeTimeout},
+	}
+}
+
+// braintreeError is returned for any non-2xx response.
+type braintreeError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *braintreeError) Error() string {
+	return fmt.Sprintf("braintree: %d %s", e.StatusCode, e.Message)
+}
+
+type braintreeCustomer struct {
+	Id           string            `json:"id,omitempty"`
+	FirstName    string            `json:"first_name,omitempty"`
+	Email        string            `json:"email,omitempty"`
+	Phone        string            `json:"phone,omitempty"`
+	CustomFields map[string]string `json:"custom_fields,omitempty"`
+}
+
+type braintreePaymentMethod struct {
+	Token              string `json:"token,omitempty"`
+	CustomerId         string `json:"customer_id,omitempty"`
+	PaymentMethodNonce string `json:"payment_method_nonce,omitempty"`
+	CardType           string `json:"card_type,omitempty"`
+	Last4              string `json:"last_4,omitempty"`
+	ExpirationMonth    string `json:"expiration_month,omitempty"`
+	ExpirationYear     string `json:"expiration_year,omitempty"`
+	NetworkToken       string `json:"network_token,omitempty"`
+	Bin                string `json:"bin,omitempty"`
+	// UniqueNumberIdentifier is the same for every vaulted copy of a card
+	// number.
+	UniqueNumberIdentifier string `json:"unique_number_identifier,omitempty"`
+	// CountryOfIssuance is an ISO 3166-1 alpha-3 code.
+	CountryOfIssuance string `json:"country_of_issuance,omitempty"`
+	// Debit and Prepaid are "Yes", "No" or "Unknown".
+	Debit                 string                 `json:"debit,omitempty"`
+	Prepaid               string                 `json:"prepaid,omitempty"`
+	PaymentInstrumentType string                 `json:"payment_instrument_type,omitempty"`
+	Verification          *braintreeVerification `json:"verification,omitempty"`
+	Options               map[string]bool        `json:"options,omitempty"`
+}
+
+// braintreeVerification holds the CVV and AVS response codes of the card's
+// latest verification.
+type braintreeVerification struct {
+	CvvResponseCode           string `json:"cvv_response_code,omitempty"`
+	AvsPostalCodeResponseCode string `json:"avs_postal_code_response_code,omitempty"`
+}
+
+type braintreeTransaction struct {
+	Id                     string            `json:"id,omitempty"`
+	Status                 string            `json:"status,omitempty"`
+	ProcessorResponseCode  string            `json:"processor_response_code,omitempty"`
+	ProcessorResponseText  string            `json:"processor_response_text,omitempty"`
+	GatewayRejectionReason string            `json:"gateway_rejection_reason,omitempty"`
+	Amount                 string            `json:"amount,omitempty"`
+	CurrencyIsoCode        string            `json:"currency_iso_code,omitempty"`
+	CustomerId             string            `json:"customer_id,omitempty"`
+	PaymentMethodToken     string            `json:"payment_method_token,omitempty"`
+	NetworkToken           string            `json:"network_token,omitempty"`
+	OrderId                string            `json:"order_id,omitempty"`
+	CustomFields           map[string]string `json:"custom_fields,omitempty"`
+	Options                map[string]bool   `json:"options,omitempty"`
+	// TransactionSource marks charges on a saved card made without the
+	// cardholder present.
+	TransactionSource string `json:"transaction_source,omitempty"`
+}
+
+func (s *braintreeService) GetPublishableKey() (string, error) {
+	var resp struct {
+		ClientToken string `json:"client_token"`
+	}
+
+	err := s.do(http.MethodPost, "/client_token", struct{}{}, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.ClientToken, nil
+}
+
+func (s *braintreeService) CreateCustomer(customer *pb.Customer) (string, error) {
+	var resp struct {
+		Customer braintreeCustomer `json:"customer"`
+	}
+
+	err := s.do(http.MethodPost, "/customers", map[string]braintreeCustomer{"customer": braintreeCustomerParams(customer)}, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Customer.Id, nil
+}
+
+func (s *braintreeService) UpdateCustomer(customer *pb.Customer) error {
+	return s.do(http.MethodPut, "/customers/"+url.PathEscape(customer.GetExtId()), map[string]braintreeCustomer{"customer": braintreeCustomerParams(customer)}, nil)
+}
+
+func braintreeCustomerParams(customer *pb.Customer) braintreeCustomer {
+	return braintreeCustomer{
+		FirstName:    customer.GetName(),
+		Email:        customer.GetEmail(),
+		Phone:        customer.GetPhone(),
+		CustomFields: customer.GetMetadata(),
+	}
+}
+
+func (s *braintreeService) DeleteCustomer(customer *pb.Customer) error {
+	err := s.do(http.MethodDelete, "/customers/"+url.PathEscape(customer.GetExtId()), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Deleted braintree customer: ", customer.GetExtId())
+
+	return nil
+}
+
+// AddCustomerPaymentMethod vaults the payment method nonce in card.ExtId. The
+// returned card's ExtId is the vaulted token.
+func (s *braintreeService) AddCustomerPaymentMethod(customer *pb.Customer, card *pb.Card) (*pb.Card, error) {
+	var resp struct {
+		PaymentMethod braintreePaymentMethod `json:"payment_method"`
+	}
+
+	params := braintreePaymentMethod{
+		CustomerId:         customer.GetExtId(),
+		PaymentMethodNonce: card.GetExtId(),
+	}
+
+	err := s.do(http.MethodPost, "/payment_methods", map[string]braintreePaymentMethod{"payment_method": params}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return braintreeCard(resp.PaymentMethod), nil
+}
+
+// CreateSetupIntent returns a client token tied to the customer. The client
+// collects and authenticates the card with Drop-in or 3D Secure and sends the
+// resulting nonce to CompleteSetupIntent.
+func (s *braintreeService) CreateSetupIntent(customer *pb.Customer) (*pb.SetupIntent, error) {
+	var resp struct {
+		ClientToken string `json:"client_token"`
+	}
+
+	err := s.do(http.MethodPost, "/client_token", map[string]string{"customer_id": customer.GetExtId()}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SetupIntent{
+		ClientSecret: resp.ClientToken,
+		Status:       pb.SetupIntentStatus_SETUP_INTENT_STATUS_REQUIRES_PAYMENT_METHOD,
+	}, nil
+}
+
+// CompleteSetupIntent vaults the nonce in setup.ExtId after verifying the
+// card. A declined verification fails like a declined charge.
+func (s *braintreeService) CompleteSetupIntent(customer *pb.Customer, setup *pb.SetupIntent) (*pb.SetupIntent, error) {
+	var resp struct {
+		PaymentMethod braintreePaymentMethod `json:"payment_method"`
+	}
+
+	params := braintreePaymentMethod{
+		CustomerId:         customer.GetExtId(),
+		PaymentMethodNonce: setup.GetExtId(),
+		Options:            map[string]bool{"verify_card": true},
+	}
+
+	err := s.do(http.MethodPost, "/payment_methods", map[string]braintreePaymentMethod{"payment_method": params}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	card := braintreeCard(resp.PaymentMethod)
+	card.SetupIntentId = setup.GetExtId()
+
+	return &pb.SetupIntent{
+		ExtId:  setup.GetExtId(),
+		Status: pb.SetupIntentStatus_SETUP_INTENT_STATUS_SUCCEEDED,
+		Card:   card,
+	}, nil
+}
+
+func braintreeCard(pm braintreePaymentMethod) *pb.Card {
+	expMonth, _ := strconv.ParseUint(pm.ExpirationMonth, 10, 32)
+	expYear, _ := strconv.ParseUint(pm.ExpirationYear, 10, 32)
+
+	card := &pb.Card{
+		ExtId:        pm.Token,
+		Brand:        braintreeCardBrand(pm.CardType),
+		Last4:        pm.Last4,
+		ExpMonth:     uint32(expMonth),
+		ExpYear:      uint32(expYear),
+		NetworkToken: pm.NetworkToken,
+		Bin:          pm.Bin,
+		Country:      braintreeCountry(pm.CountryOfIssuance),
+		Fingerprint:  pm.UniqueNumberIdentifier,
+		Funding:      braintreeCardFunding(pm.Debit, pm.Prepaid),
+		Wallet:       braintreeCardWallets[pm.PaymentInstrumentType],
+	}
+
+	if pm.Verification != nil {
+		card.CvcCheck = braintreeCardCheck(pm.Verification.CvvResponseCode)
+		card.PostalCodeCheck = braintreeCardCheck(pm.Verification.AvsPostalCodeResponseCode)
+	}
+
+	return card
+}
+
+// braintreeCountry converts an alpha-3 country code to the alpha-2 code
+// stored for all gateways, or "" if it is not a country.
+func braintreeCountry(alpha3 string) string {
+	region, err := language.ParseRegion(alpha3)
+	if err != nil || !region.IsCountry() {
+		return ""
+	}
+
+	return region.String()
+}
+
+func braintreeCardFunding(debit, prepaid string) pb.CardFunding {
+	switch {
+	case prepaid == "Yes":
+		return pb.CardFunding_CARD_FUNDING_PREPAID
+	case debit == "Yes":
+		return pb.CardFunding_CARD_FUNDING_DEBIT
+	case debit == "No" && prepaid == "No":
+		return pb.CardFunding_CARD_FUNDING_CREDIT
+	default:
+		return pb.CardFunding_CARD_FUNDING_UNKNOWN
+	}
+}
+
+var braintreeCardWallets = map[string]pb.CardWallet{
+	"apple_pay_card":     pb.CardWallet_CARD_WALLET_APPLE_PAY,
+	"android_pay_card":   pb.CardWallet_CARD_WALLET_GOOGLE_PAY,
+	"samsung_pay_card":   pb.CardWallet_CARD_WALLET_SAMSUNG_PAY,
+	"masterpass_card":    pb.CardWallet_CARD_WALLET_MASTERPASS,
+	"visa_checkout_card": pb.CardWallet_CARD_WALLET_VISA_CHECKOUT,
+}
+
+// braintreeCardCheck converts a CVV or AVS response code. "I" means nothing
+// was provided to check.
+func braintreeCardCheck(code string) pb.CardCheck {
+	switch code {
+	case "M":
+		return pb.CardCheck_CARD_CHECK_PASS
+	case "N":
+		return pb.CardCheck_CARD_CHECK_FAIL
+	case "U", "S":
+		return pb.CardCheck_CARD_CHECK_UNAVAILABLE
+	case "A", "B":
+		return pb.CardCheck_CARD_CHECK_UNCHECKED
+	default:
+		return pb.CardCheck_CARD_CHECK_UNSPECIFIED
+	}
+}
+
+func braintreeCardBrand(cardType string) string {
+	switch cardType {
+	case "Visa":
+		return "visa"
+	case "MasterCard":
+		return "mastercard"
+	case "American Express":
+		return "amex"
+	case "Discover":
+		return "discover"
+	case "JCB":
+		return "jcb"
+	case "Diners Club":
+		return "diners"
+	default:
+		return "unknown"
+	}
+}
+
+func (s *braintreeService) RemoveCustomerPaymentMethod(_ *pb.Customer, card *pb.Card) error {
+	return s.do(http.MethodDelete, "/payment_methods/"+url.PathEscape(card.GetExtId()), nil, nil)
+}
+
+// CreateCharge creates a sale that is submitted for settlement right away,
+// unless the charge is held for review.
+// The idempotency key is sent as the order id so FindCharge can search for it.
+func (s *braintreeService) CreateCharge(customer *pb.Customer, card *pb.Card, charge *pb.Charge) (*pb.Charge, error) {
+	params := braintreeSale(charge)
+	params.CustomerId = customer.GetExtId()
+	params.PaymentMethodToken = card.GetExtId()
+	if card.GetSetupIntentId() != "" {
+		params.TransactionSource = "unscheduled"
+	}
+
+	return s.createTransaction(params)
+}
+
+// CreateNetworkTokenCharge charges a card saved on another gateway by its
+// network token.
+func (s *braintreeService) CreateNetworkTokenCharge(card *pb.Card, charge *pb.Charge) (*pb.Charge, error) {
+	params := braintreeSale(charge)
+	params.NetworkToken = card.GetNetworkToken()
+
+	return s.createTransaction(params)
+}
+
+func braintreeSale(charge *pb.Charge) braintreeTransaction {
+	return braintreeTransaction{
+		Amount:          braintreeAmount(charge.GetAmount(), charge.GetCurrency()),
+		CurrencyIsoCode: charge.GetCurrency(),
+		OrderId:         charge.GetIdempotencyKey(),
+		CustomFields: map[string]string{
+			"charge_id": strconv.FormatInt(charge.GetId(), 10),
+		},
+		Options: map[string]bool{"submit_for_settlement": charge.GetReview() == nil},
+	}
+}
+
+func (s *braintreeService) createTransaction(params braintreeTransaction) (*pb.Charge, error) {
+	var resp struct {
+		Transaction braintreeTransaction `json:"transaction"`
+	}
+
+	err := s.do(http.MethodPost, "/transactions", map[string]braintreeTransaction{"transaction": params}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	t := resp.Transaction
+
+	log.Println("Created braintree transaction: ", t.Id, t.Status)
+
+	if decline := braintreeDecline(t); decline != nil {
+		return nil, NewDeclineError(decline, fmt.Errorf("braintree: transaction %s %s: %s %s", t.Id, t.Status, t.ProcessorResponseCode, t.ProcessorResponseText))
+	}
+
+	return &pb.Charge{
+		ExtId:  t.Id,
+		Status: braintreeChargeStatus(t.Status),
+	}, nil
+}
+
+func (s *braintreeService) FindCharge(charge *pb.Charge) (*pb.Charge, error) {
+	var resp struct {
+		Transactions []braintreeTransaction `json:"transactions"`
+	}
+
+	err := s.do(http.MethodGet, "/transactions?order_id="+url.QueryEscape(charge.GetIdempotencyKey()), nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Transactions) == 0 {
+		return nil, nil
+	}
+
+	t := resp.Transactions[0]
+
+	return &pb.Charge{
+		ExtId:   t.Id,
+		Status:  braintreeChargeStatus(t.Status),
+		Decline: braintreeDecline(t),
+	}, nil
+}
+
+// CaptureCharge submits an authorized transaction for settlement.
+func (s *braintreeService) CaptureCharge(charge *pb.Charge) (*pb.Charge, error) {
+	return s.updateTransaction(charge.GetExtId(), "submit_for_settlement")
+}
+
+// VoidCharge voids an authorized transaction.
+func (s *braintreeService) VoidCharge(charge *pb.Charge) (*pb.Charge, error) {
+	return s.updateTransaction(charge.GetExtId(), "void")
+}
+
+func (s *braintreeService) updateTransaction(id, action string) (*pb.Charge, error) {
+	var resp struct {
+		Transaction braintreeTransaction `json:"transaction"`
+	}
+
+	err := s.do(http.MethodPut, "/transactions/"+url.PathEscape(id)+"/"+action, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	t := resp.Transaction
+
+	log.Println("Updated braintree transaction: ", t.Id, action, t.Status)
+
+	return &pb.Charge{
+		ExtId:   t.Id,
+		Status:  braintreeChargeStatus(t.Status),
+		Decline: braintreeDecline(t),
+	}, nil
+}
+
+// braintreeDeclineReasons maps processor response codes.
+var braintreeDeclineReasons = map[string]pb.DeclineReason{
+	"2000": pb.DeclineReason_DECLINE_REASON_DO_NOT_HONOR,
+	"2001": pb.DeclineReason_DECLINE_REASON_INSUFFICIENT_FUNDS,
+	"2002": pb.DeclineReason_DECLINE_REASON_LIMIT_EXCEEDED,
+	"2003": pb.DeclineReason_DECLINE_REASON_LIMIT_EXCEEDED,
+	"2004": pb.DeclineReason_DECLINE_REASON_EXPIRED_CARD,
+	"2005": pb.DeclineReason_DECLINE_REASON_INCORRECT_NUMBER,
+	"2006": pb.DeclineReason_DECLINE_REASON_INCORRECT_EXPIRY,
+	"2010": pb.DeclineReason_DECLINE_REASON_INCORRECT_CVC,
+	"2012": pb.DeclineReason_DECLINE_REASON_LOST_OR_STOLEN,
+	"2013": pb.DeclineReason_DECLINE_REASON_LOST_OR_STOLEN,
+	"2014": pb.DeclineReason_DECLINE_REASON_FRAUD_SUSPECTED,
+	"2015": pb.DeclineReason_DECLINE_REASON_CARD_NOT_SUPPORTED,
+	"2047": pb.DeclineReason_DECLINE_REASON_LOST_OR_STOLEN,
+	"2057": pb.DeclineReason_DECLINE_REASON_CARD_NOT_SUPPORTED,
+	"2099": pb.DeclineReason_DECLINE_REASON_AUTHENTICATION_REQUIRED,
+	"3000": pb.DeclineReason_DECLINE_REASON_TRY_AGAIN_LATER,
+}
+
+// braintreeRejectionReasons maps the reasons Braintree's own checks reject a
+// transaction for.
+var braintreeRejectionReasons = map[string]pb.DeclineReason{
+	"cvv":            pb.DeclineReason_DECLINE_REASON_INCORRECT_CVC,
+	"fraud":          pb.DeclineReason_DECLINE_REASON_FRAUD_SUSPECTED,
+	"risk_threshold": pb.DeclineReason_DECLINE_REASON_FRAUD_SUSPECTED,
+}
+
+// braintreeDecline returns why a transaction was declined, or nil if it was
+// not.
+func braintreeDecline(t braintreeTransaction) *pb.ChargeDecline {
+	switch t.Status {
+	case "processor_declined", "settlement_declined", "failed":
+		return NewDecline(braintreeDeclineReasons[t.ProcessorResponseCode], t.Status, t.ProcessorResponseCode)
+	case "gateway_rejected":
+		return NewDecline(braintreeRejectionReasons[t.GatewayRejectionReason], t.Status, t.GatewayRejectionReason)
+	default:
+		return nil
+	}
+}
+
+// currencyExponents lists the ISO 4217 currencies whose minor unit is not a
+// hundredth of the major unit, by the number of decimals.
+var currencyExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// braintreeAmount formats an amount in minor units of currency as
+// Braintree's decimal string, e.g. 1234 is "12.34" USD but "1234" JPY.
+func braintreeAmount(amount int64, currency string) string {
+	exponent, ok := currencyExponents[strings.ToUpper(currency)]
+	if !ok {
+		exponent = 2
+	}
+
+	if exponent == 0 {
+		return strconv.FormatInt(amount, 10)
+	}
+
+	unit := int64(1)
+	for i := 0; i < exponent; i++ {
+		unit *= 10
+	}
+
+	return fmt.Sprintf("%d.%0*d", amount/unit, exponent, amount%unit)
+}
+
+func braintreeChargeStatus(status string) pb.ChargeStatus {
+	switch status {
+	case "submitted_for_settlement", "settling", "settlement_pending", "settled":
+		return pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED
+	case "authorized":
+		return pb.ChargeStatus_CHARGE_STATUS_AUTHORIZED
+	case "voided", "authorization_expired":
+		return pb.ChargeStatus_CHARGE_STATUS_CANCELED
+	case "processor_declined", "gateway_rejected", "settlement_declined", "failed":
+		return pb.ChargeStatus_CHARGE_STATUS_FAILED
+	default:
+		return pb.ChargeStatus_CHARGE_STATUS_PENDING
+	}
+}
+
+func (s *braintreeService) do(method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, s.baseURL+"/merchants/"+url.PathEscape(s.merchantId)+path, reader)
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(s.publicKey, s.privateKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return networkError(err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return statusError(resp.StatusCode, &braintreeError{StatusCode: resp.StatusCode, Message: apiErr.Message})
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
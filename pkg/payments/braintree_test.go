@@ -0,0 +1,336 @@
+package payments
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/robertkohut/go-payments/internal/config"
+	pb "github.com/robertkohut/go-payments/proto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newBraintreeStandIn serves the subset of the Braintree API the adapter uses
+// for merchant "m1", keeping transactions in memory.
+func newBraintreeStandIn(t *testing.T) *httptest.Server {
+	transactions := map[string]braintreeTransaction{}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/merchants/m1/customers", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]braintreeCustomer
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Could not decode customer: %v", err)
+		}
+		if req["customer"].Email != "jane@example.com" {
+			t.Errorf("Expected the customer's email to be sent, got %q", req["customer"].Email)
+		}
+		writeJSON(w, map[string]braintreeCustomer{"customer": {Id: "bt_cus_1"}})
+	})
+
+	mux.HandleFunc("/merchants/m1/client_token", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		writeJSON(w, map[string]string{"client_token": "token_" + req["customer_id"]})
+	})
+
+	mux.HandleFunc("/merchants/m1/payment_methods", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]braintreePaymentMethod
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Could not decode payment method: %v", err)
+		}
+		if req["payment_method"].PaymentMethodNonce == "unverified" && !req["payment_method"].Options["verify_card"] {
+			t.Errorf("Expected the card to be verified")
+		}
+		writeJSON(w, map[string]braintreePaymentMethod{"payment_method": {
+			Token:           "bt_pm_1",
+			CardType:        "Visa",
+			Last4:           "1111",
+			ExpirationMonth: "12",
+			ExpirationYear:  "2030",
+
+			UniqueNumberIdentifier: "bt_fp_1",
+			CountryOfIssuance:      "GBR",
+			Debit:                  "Yes",
+			Prepaid:                "No",
+			Verification:           &braintreeVerification{CvvResponseCode: "M", AvsPostalCodeResponseCode: "N"},
+		}})
+	})
+
+	mux.HandleFunc("/merchants/m1/transactions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			var found []braintreeTransaction
+			if tx, ok := transactions[r.URL.Query().Get("order_id")]; ok {
+				found = append(found, tx)
+			}
+			writeJSON(w, map[string][]braintreeTransaction{"transactions": found})
+			return
+		}
+
+		var req map[string]braintreeTransaction
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Could not decode transaction: %v", err)
+		}
+		tx := req["transaction"]
+		if tx.Amount != "12.34" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			writeJSON(w, map[string]string{"message": "invalid amount " + tx.Amount})
+			return
+		}
+		if tx.OrderId == "unscheduled" && tx.TransactionSource != "unscheduled" {
+			t.Errorf("Expected an unscheduled transaction, got %q", tx.TransactionSource)
+		}
+		tx.Id = "bt_tx_" + tx.OrderId
+		tx.Status = "authorized"
+		if tx.Options["submit_for_settlement"] {
+			tx.Status = "submitted_for_settlement"
+		}
+		transactions[tx.OrderId] = tx
+		writeJSON(w, map[string]braintreeTransaction{"transaction": tx})
+	})
+
+	mux.HandleFunc("/merchants/m1/transactions/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/merchants/m1/transactions/"), "/")
+
+		for key, tx := range transactions {
+			if tx.Id != id {
+				continue
+			}
+
+			switch {
+			case tx.Status != "authorized":
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				writeJSON(w, map[string]string{"message": "cannot " + action + " a " + tx.Status + " transaction"})
+				return
+			case action == "submit_for_settlement":
+				tx.Status = "submitted_for_settlement"
+			case action == "void":
+				tx.Status = "voided"
+			}
+
+			transactions[key] = tx
+			writeJSON(w, map[string]braintreeTransaction{"transaction": tx})
+			return
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "pub" || pass != "priv" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestBraintreeCharge(t *testing.T) {
+	srv := newBraintreeStandIn(t)
+
+	ps := NewBraintreeService(&config.GatewayConfig{
+		URL:            srv.URL,
+		MerchantId:     "m1",
+		PublishableKey: "pub",
+		SecretKey:      "priv",
+	})
+
+	customer := &pb.Customer{Name: "Jane", Email: "jane@example.com"}
+
+	extId, err := ps.CreateCustomer(customer)
+	if err != nil {
+		t.Fatalf("Could not create customer: %v", err)
+	}
+	customer.ExtId = extId
+
+	card, err := ps.AddCustomerPaymentMethod(customer, &pb.Card{ExtId: "nonce"})
+	if err != nil {
+		t.Fatalf("Could not add payment method: %v", err)
+	}
+
+	if card.ExtId != "bt_pm_1" || card.Brand != "visa" || card.ExpYear != 2030 {
+		t.Errorf("Unexpected card: %v", card)
+	}
+
+	if card.Fingerprint != "bt_fp_1" || card.Country != "GB" || card.Funding != pb.CardFunding_CARD_FUNDING_DEBIT ||
+		card.CvcCheck != pb.CardCheck_CARD_CHECK_PASS || card.PostalCodeCheck != pb.CardCheck_CARD_CHECK_FAIL {
+		t.Errorf("Expected the card details to be returned, got %v", card)
+	}
+
+	charge := &pb.Charge{Amount: 1234, Currency: "USD", IdempotencyKey: "key1"}
+
+	result, err := ps.CreateCharge(customer, card, charge)
+	if err != nil {
+		t.Fatalf("Could not create charge: %v", err)
+	}
+
+	if result.ExtId != "bt_tx_key1" || result.Status != pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED {
+		t.Errorf("Unexpected charge: %v", result)
+	}
+
+	found, err := ps.FindCharge(charge)
+	if err != nil {
+		t.Fatalf("Could not find charge: %v", err)
+	}
+
+	if found == nil || found.ExtId != "bt_tx_key1" {
+		t.Errorf("Expected to find the charge by idempotency key, got %v", found)
+	}
+
+	missing, err := ps.FindCharge(&pb.Charge{IdempotencyKey: "other"})
+	if err != nil || missing != nil {
+		t.Errorf("Expected no charge for an unknown key, got %v, %v", missing, err)
+	}
+}
+
+func TestBraintreeSetupIntent(t *testing.T) {
+	srv := newBraintreeStandIn(t)
+
+	ps := NewBraintreeService(&config.GatewayConfig{
+		URL:            srv.URL,
+		MerchantId:     "m1",
+		PublishableKey: "pub",
+		SecretKey:      "priv",
+	})
+
+	customer := &pb.Customer{ExtId: "bt_cus_1"}
+
+	setup, err := ps.CreateSetupIntent(customer)
+	if err != nil {
+		t.Fatalf("Could not create setup intent: %v", err)
+	}
+
+	if setup.ClientSecret != "token_bt_cus_1" || setup.Status != pb.SetupIntentStatus_SETUP_INTENT_STATUS_REQUIRES_PAYMENT_METHOD {
+		t.Errorf("Expected a client token for the customer, got %v", setup)
+	}
+
+	setup, err = ps.CompleteSetupIntent(customer, &pb.SetupIntent{ExtId: "unverified"})
+	if err != nil {
+		t.Fatalf("Could not complete setup intent: %v", err)
+	}
+
+	card := setup.Card
+	if setup.Status != pb.SetupIntentStatus_SETUP_INTENT_STATUS_SUCCEEDED || card == nil || card.ExtId != "bt_pm_1" || card.SetupIntentId != "unverified" {
+		t.Fatalf("Expected the vaulted card, got %v", setup)
+	}
+
+	_, err = ps.CreateCharge(customer, card, &pb.Charge{Amount: 1234, Currency: "USD", IdempotencyKey: "unscheduled"})
+	if err != nil {
+		t.Fatalf("Could not create charge: %v", err)
+	}
+}
+
+func TestBraintreeHeldCharge(t *testing.T) {
+	srv := newBraintreeStandIn(t)
+
+	ps := NewBraintreeService(&config.GatewayConfig{URL: srv.URL, MerchantId: "m1", PublishableKey: "pub", SecretKey: "priv"})
+
+	customer := &pb.Customer{ExtId: "bt_cus_1"}
+	card := &pb.Card{ExtId: "bt_pm_1"}
+
+	for _, tt := range []struct {
+		key    string
+		settle func(*pb.Charge) (*pb.Charge, error)
+		status pb.ChargeStatus
+	}{
+		{"approve", ps.CaptureCharge, pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED},
+		{"reject", ps.VoidCharge, pb.ChargeStatus_CHARGE_STATUS_CANCELED},
+	} {
+		charge := &pb.Charge{
+			Amount:         1234,
+			Currency:       "USD",
+			IdempotencyKey: tt.key,
+			Review:         &pb.ChargeReview{Status: pb.ReviewStatus_REVIEW_STATUS_OPEN},
+		}
+
+		result, err := ps.CreateCharge(customer, card, charge)
+		if err != nil {
+			t.Fatalf("Could not create charge: %v", err)
+		}
+
+		if result.Status != pb.ChargeStatus_CHARGE_STATUS_AUTHORIZED {
+			t.Fatalf("Expected a charge held for review to only be authorized, got %s", result.Status)
+		}
+
+		charge.ExtId = result.ExtId
+
+		settled, err := tt.settle(charge)
+		if err != nil {
+			t.Fatalf("Could not %s charge: %v", tt.key, err)
+		}
+
+		if settled.Status != tt.status {
+			t.Errorf("Expected %s, got %s", tt.status, settled.Status)
+		}
+
+		if _, err := tt.settle(charge); err == nil {
+			t.Errorf("Expected a settled charge not to be settled again")
+		}
+	}
+}
+
+func TestBraintreeError(t *testing.T) {
+	srv := newBraintreeStandIn(t)
+
+	ps := NewBraintreeService(&config.GatewayConfig{URL: srv.URL, MerchantId: "m1", PublishableKey: "pub", SecretKey: "wrong"})
+
+	_, err := ps.CreateCustomer(&pb.Customer{})
+	if e, ok := err.(*braintreeError); !ok || e.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected an unauthorized error, got %v", err)
+	}
+}
+
+func TestBraintreeUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ps := NewBraintreeService(&config.GatewayConfig{URL: srv.URL, MerchantId: "m1"})
+
+	_, err := ps.CreateCharge(&pb.Customer{}, &pb.Card{}, &pb.Charge{Amount: 100})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected ErrUnavailable for a 503, got %v", err)
+	}
+
+	// Nothing listens on a closed server, so the request is never sent.
+	srv.Close()
+
+	_, err = ps.CreateCharge(&pb.Customer{}, &pb.Card{}, &pb.Charge{Amount: 100})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected ErrUnavailable for a refused connection, got %v", err)
+	}
+}
+
+func TestBraintreeAmount(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		want     string
+	}{
+		{1234, "USD", "12.34"},
+		{5, "eur", "0.05"},
+		{1234, "JPY", "1234"},
+		{50000, "krw", "50000"},
+		{1234, "KWD", "1.234"},
+	}
+
+	for _, tt := range tests {
+		if got := braintreeAmount(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("%d %s: got %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
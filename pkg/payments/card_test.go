@@ -0,0 +1,88 @@
+package payments
+
+import (
+	pb "github.com/robertkohut/go-payments/proto"
+	"github.com/stripe/stripe-go/v74"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"testing"
+)
+
+func TestStripeCard(t *testing.T) {
+	card, err := stripeCard(&stripe.PaymentMethod{
+		ID:   "pm_1",
+		Type: stripe.PaymentMethodTypeCard,
+		Card: &stripe.PaymentMethodCard{
+			Brand:       "visa",
+			Last4:       "4242",
+			ExpMonth:    4,
+			ExpYear:     2031,
+			Country:     "US",
+			Fingerprint: "fp_1",
+			Funding:     stripe.CardFundingPrepaid,
+			Wallet:      &stripe.PaymentMethodCardWallet{Type: stripe.PaymentMethodCardWalletTypeApplePay},
+			Checks:      &stripe.PaymentMethodCardChecks{CVCCheck: "pass", AddressPostalCodeCheck: "unchecked"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not convert card: %v", err)
+	}
+
+	want := &pb.Card{
+		ExtId:           "pm_1",
+		Brand:           "visa",
+		Last4:           "4242",
+		ExpMonth:        4,
+		ExpYear:         2031,
+		Country:         "US",
+		Fingerprint:     "fp_1",
+		Funding:         pb.CardFunding_CARD_FUNDING_PREPAID,
+		Wallet:          pb.CardWallet_CARD_WALLET_APPLE_PAY,
+		CvcCheck:        pb.CardCheck_CARD_CHECK_PASS,
+		PostalCodeCheck: pb.CardCheck_CARD_CHECK_UNCHECKED,
+	}
+
+	if !proto.Equal(card, want) {
+		t.Errorf("Expected %v, got %v", want, card)
+	}
+
+	card, err = stripeCard(&stripe.PaymentMethod{ID: "pm_2", Type: stripe.PaymentMethodTypeCard, Card: &stripe.PaymentMethodCard{}})
+	if err != nil || card.Wallet != pb.CardWallet_CARD_WALLET_UNSPECIFIED || card.CvcCheck != pb.CardCheck_CARD_CHECK_UNSPECIFIED {
+		t.Errorf("Expected no wallet or checks, got %v, %v", card, err)
+	}
+
+	_, err = stripeCard(&stripe.PaymentMethod{ID: "pm_3", Type: stripe.PaymentMethodTypeSEPADebit})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a SEPA debit payment method, got %v", err)
+	}
+}
+
+func TestBraintreeCardDetails(t *testing.T) {
+	countries := map[string]string{"USA": "US", "DEU": "DE", "": "", "ZZZ": ""}
+	for alpha3, want := range countries {
+		if got := braintreeCountry(alpha3); got != want {
+			t.Errorf("%q: expected %q, got %q", alpha3, want, got)
+		}
+	}
+
+	fundings := []struct {
+		debit, prepaid string
+		want           pb.CardFunding
+	}{
+		{"No", "No", pb.CardFunding_CARD_FUNDING_CREDIT},
+		{"Yes", "No", pb.CardFunding_CARD_FUNDING_DEBIT},
+		{"Yes", "Yes", pb.CardFunding_CARD_FUNDING_PREPAID},
+		{"Unknown", "No", pb.CardFunding_CARD_FUNDING_UNKNOWN},
+	}
+	for _, f := range fundings {
+		if got := braintreeCardFunding(f.debit, f.prepaid); got != f.want {
+			t.Errorf("debit %s, prepaid %s: expected %s, got %s", f.debit, f.prepaid, f.want, got)
+		}
+	}
+
+	card := braintreeCard(braintreePaymentMethod{PaymentInstrumentType: "android_pay_card"})
+	if card.Wallet != pb.CardWallet_CARD_WALLET_GOOGLE_PAY || card.CvcCheck != pb.CardCheck_CARD_CHECK_UNSPECIFIED {
+		t.Errorf("Expected a Google Pay card without checks, got %v", card)
+	}
+}
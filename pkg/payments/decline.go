@@ -0,0 +1,83 @@
+package payments
+
+import (
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// declineMessages are shown to cardholders. Lost, stolen and suspected fraud
+// get the generic message so the cardholder is not told what the issuer
+// suspects.
+var declineMessages = map[pb.DeclineReason]string{
+	pb.DeclineReason_DECLINE_REASON_INSUFFICIENT_FUNDS:      "Your card has insufficient funds.",
+	pb.DeclineReason_DECLINE_REASON_EXPIRED_CARD:            "Your card has expired.",
+	pb.DeclineReason_DECLINE_REASON_INCORRECT_CVC:           "Your card's security code is incorrect.",
+	pb.DeclineReason_DECLINE_REASON_INCORRECT_NUMBER:        "Your card number is incorrect.",
+	pb.DeclineReason_DECLINE_REASON_INCORRECT_EXPIRY:        "Your card's expiration date is incorrect.",
+	pb.DeclineReason_DECLINE_REASON_LIMIT_EXCEEDED:          "Your card has exceeded its limit.",
+	pb.DeclineReason_DECLINE_REASON_CARD_NOT_SUPPORTED:      "Your card does not support this type of purchase.",
+	pb.DeclineReason_DECLINE_REASON_CURRENCY_NOT_SUPPORTED:  "Your card does not support this currency.",
+	pb.DeclineReason_DECLINE_REASON_AUTHENTICATION_REQUIRED: "Your card requires authentication.",
+	pb.DeclineReason_DECLINE_REASON_PROCESSING_ERROR:        "An error occurred while processing your card. Try again.",
+	pb.DeclineReason_DECLINE_REASON_TRY_AGAIN_LATER:         "Your card was declined. Try again later.",
+	pb.DeclineReason_DECLINE_REASON_INVALID_AMOUNT:          "The amount is not valid for this card.",
+}
+
+const genericDeclineMessage = "Your card was declined."
+
+// retryableDeclines may succeed if the same card is charged again later.
+var retryableDeclines = map[pb.DeclineReason]bool{
+	pb.DeclineReason_DECLINE_REASON_INSUFFICIENT_FUNDS: true,
+	pb.DeclineReason_DECLINE_REASON_LIMIT_EXCEEDED:     true,
+	pb.DeclineReason_DECLINE_REASON_PROCESSING_ERROR:   true,
+	pb.DeclineReason_DECLINE_REASON_TRY_AGAIN_LATER:    true,
+}
+
+// NewDecline builds a ChargeDecline from a reason and the gateway's codes.
+func NewDecline(reason pb.DeclineReason, code, declineCode string) *pb.ChargeDecline {
+	if reason == pb.DeclineReason_DECLINE_REASON_UNSPECIFIED {
+		reason = pb.DeclineReason_DECLINE_REASON_GENERIC
+	}
+
+	message, ok := declineMessages[reason]
+	if !ok {
+		message = genericDeclineMessage
+	}
+
+	return &pb.ChargeDecline{
+		Reason:      reason,
+		Code:        code,
+		DeclineCode: declineCode,
+		Message:     message,
+		Retryable:   retryableDeclines[reason],
+	}
+}
+
+// DeclineError is returned by adapters when the gateway declined a charge.
+// The gateway's own error is kept for errors.As.
+type DeclineError struct {
+	Decline *pb.ChargeDecline
+	err     error
+}
+
+func NewDeclineError(decline *pb.ChargeDecline, err error) *DeclineError {
+	return &DeclineError{Decline: decline, err: err}
+}
+
+func (e *DeclineError) Error() string {
+	if e.err != nil {
+		return e.err.Error()
+	}
+
+	return e.Decline.GetMessage()
+}
+
+func (e *DeclineError) Unwrap() error {
+	return e.err
+}
+
+// GRPCStatus only exposes the user-safe message to clients.
+func (e *DeclineError) GRPCStatus() *status.Status {
+	return status.New(codes.FailedPrecondition, e.Decline.GetMessage())
+}
@@ -0,0 +1,88 @@
+package payments
+
+import (
+	"errors"
+	"github.com/robertkohut/go-payments/internal/config"
+	pb "github.com/robertkohut/go-payments/proto"
+	"github.com/stripe/stripe-go/v74"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStripeDeclines(t *testing.T) {
+	tests := []struct {
+		err       *stripe.Error
+		reason    pb.DeclineReason
+		retryable bool
+	}{
+		{&stripe.Error{Type: stripe.ErrorTypeCard, Code: "card_declined", DeclineCode: "insufficient_funds"}, pb.DeclineReason_DECLINE_REASON_INSUFFICIENT_FUNDS, true},
+		{&stripe.Error{Type: stripe.ErrorTypeCard, Code: "card_declined", DeclineCode: "stolen_card"}, pb.DeclineReason_DECLINE_REASON_LOST_OR_STOLEN, false},
+		{&stripe.Error{Type: stripe.ErrorTypeCard, Code: "expired_card"}, pb.DeclineReason_DECLINE_REASON_EXPIRED_CARD, false},
+		{&stripe.Error{Type: stripe.ErrorTypeCard, Code: "incorrect_cvc"}, pb.DeclineReason_DECLINE_REASON_INCORRECT_CVC, false},
+		{&stripe.Error{Type: stripe.ErrorTypeCard, Code: "card_declined", DeclineCode: "something_new"}, pb.DeclineReason_DECLINE_REASON_GENERIC, false},
+	}
+
+	for _, tt := range tests {
+		err := stripeError(tt.err)
+
+		var declineErr *DeclineError
+		if !errors.As(err, &declineErr) {
+			t.Fatalf("%s/%s: expected a DeclineError, got %v", tt.err.Code, tt.err.DeclineCode, err)
+		}
+
+		d := declineErr.Decline
+		if d.Reason != tt.reason || d.Retryable != tt.retryable {
+			t.Errorf("%s/%s: unexpected decline %v", tt.err.Code, tt.err.DeclineCode, d)
+		}
+
+		if d.Code != string(tt.err.Code) || d.DeclineCode != string(tt.err.DeclineCode) {
+			t.Errorf("%s/%s: expected the raw codes to be kept, got %v", tt.err.Code, tt.err.DeclineCode, d)
+		}
+
+		var stripeErr *stripe.Error
+		if !errors.As(err, &stripeErr) {
+			t.Errorf("Expected the stripe error to be kept")
+		}
+	}
+}
+
+func TestDeclineMessagesAreSafe(t *testing.T) {
+	d := NewDecline(pb.DeclineReason_DECLINE_REASON_FRAUD_SUSPECTED, "card_declined", "fraudulent")
+
+	if d.Message != genericDeclineMessage {
+		t.Errorf("Expected suspected fraud to get the generic message, got %q", d.Message)
+	}
+
+	err := NewDeclineError(d, errors.New("raw gateway message"))
+	if st := status.Convert(err); st.Code() != codes.FailedPrecondition || st.Message() != genericDeclineMessage {
+		t.Errorf("Expected clients to only see the safe message, got %v", st)
+	}
+}
+
+func TestBraintreeDecline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]braintreeTransaction{"transaction": {
+			Id:                    "bt_tx_2",
+			Status:                "processor_declined",
+			ProcessorResponseCode: "2001",
+			ProcessorResponseText: "Insufficient Funds",
+		}})
+	}))
+	defer srv.Close()
+
+	ps := NewBraintreeService(&config.GatewayConfig{URL: srv.URL, MerchantId: "m1"})
+
+	_, err := ps.CreateCharge(&pb.Customer{}, &pb.Card{}, &pb.Charge{Amount: 100})
+
+	var declineErr *DeclineError
+	if !errors.As(err, &declineErr) {
+		t.Fatalf("Expected a DeclineError, got %v", err)
+	}
+
+	if declineErr.Decline.Reason != pb.DeclineReason_DECLINE_REASON_INSUFFICIENT_FUNDS || declineErr.Decline.DeclineCode != "2001" {
+		t.Errorf("Unexpected decline %v", declineErr.Decline)
+	}
+}
@@ -1,26 +1,109 @@
 package payments
 
 import (
-	"github.com/robertkohut/go-payments/internal/config"
+	"errors"
 	pb "github.com/robertkohut/go-payments/proto"
+	"net"
+	"net/http"
 )
 
+// ErrUnavailable is wrapped by adapter errors for requests the gateway never
+// processed, because it could not be reached or turned the request away.
+// Such a request can be retried on another gateway without charging twice.
+var ErrUnavailable = errors.New("gateway unavailable")
+
+// ErrTransient is wrapped by adapter errors for failures that may pass on a
+// retry, but where the gateway may already have processed the request.
+var ErrTransient = errors.New("gateway error")
+
+// ErrTimeout is wrapped by errors for calls the gateway did not answer in
+// time. The call may still complete.
+var ErrTimeout = errors.New("gateway timeout")
+
+// ErrNotVisible is wrapped by FindCharge errors when the gateway did not list
+// the charge but may not list it yet, as its search is eventually consistent.
+var ErrNotVisible = errors.New("charge not visible yet")
+
 type PaymentService interface {
 	GetPublishableKey() (string, error)
 
 	CreateCustomer(customer *pb.Customer) (string, error)
+	UpdateCustomer(customer *pb.Customer) error
 	DeleteCustomer(customer *pb.Customer) error
 
 	AddCustomerPaymentMethod(customer *pb.Customer, card *pb.Card) (*pb.Card, error)
 	RemoveCustomerPaymentMethod(customer *pb.Customer, card *pb.Card) error
-	CreateCharge(customer *pb.Customer, card *pb.Card, charge *pb.Charge) (*string, error)
+	// CreateSetupIntent starts saving a card the client collects and
+	// authenticates with the gateway's client library. CompleteSetupIntent
+	// returns its status, and once it succeeded, the saved card.
+	CreateSetupIntent(customer *pb.Customer) (*pb.SetupIntent, error)
+	CompleteSetupIntent(customer *pb.Customer, setup *pb.SetupIntent) (*pb.SetupIntent, error)
+	CreateCharge(customer *pb.Customer, card *pb.Card, charge *pb.Charge) (*pb.Charge, error)
+	// FindCharge looks a charge up by its idempotency key. It returns nil if
+	// the gateway never saw it.
+	FindCharge(charge *pb.Charge) (*pb.Charge, error)
+	// CaptureCharge and VoidCharge settle or release a charge that was only
+	// authorized. CreateCharge only authorizes charges held for review.
+	CaptureCharge(charge *pb.Charge) (*pb.Charge, error)
+	VoidCharge(charge *pb.Charge) (*pb.Charge, error)
+}
+
+// NetworkTokenService is implemented by adapters that can charge a card by its
+// network token, so a card saved on another gateway can be charged there.
+type NetworkTokenService interface {
+	CreateNetworkTokenCharge(card *pb.Card, charge *pb.Charge) (*pb.Charge, error)
+}
+
+// idempotentCharger is implemented by adapters whose CreateCharge can be sent
+// again for the same charge without charging it twice.
+type idempotentCharger interface {
+	idempotentCharges()
+}
+
+// classifiedError marks an adapter error as one of ErrUnavailable or
+// ErrTransient while keeping the original error reachable with errors.As.
+type classifiedError struct {
+	class error
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.class.Error() + ": " + e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+func (e *classifiedError) Is(target error) bool {
+	return target == e.class
+}
+
+// networkError classifies a failed HTTP request. If the connection could not
+// be made the request was never sent; any other network failure may have
+// happened after the gateway received it.
+func networkError(err error) error {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return &classifiedError{class: ErrUnavailable, err: err}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return &classifiedError{class: ErrTransient, err: err}
+	}
+
+	return err
 }
 
-func NewService(gateway string, cfg *config.Configuration) PaymentService {
-	switch gateway {
-	case "stripe":
-		return NewStripeService(cfg.Stripe)
+// statusError classifies an error response by its HTTP status.
+func statusError(statusCode int, err error) error {
+	switch {
+	case statusCode == http.StatusServiceUnavailable:
+		return &classifiedError{class: ErrUnavailable, err: err}
+	case statusCode >= 500:
+		return &classifiedError{class: ErrTransient, err: err}
 	default:
-		return nil
+		return err
 	}
 }
@@ -0,0 +1,195 @@
+package payments
+
+import (
+	"fmt"
+	"github.com/robertkohut/go-payments/internal/config"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sort"
+	"sync"
+)
+
+// Factory builds a PaymentService for one gateway account.
+type Factory func(cfg *config.GatewayConfig) PaymentService
+
+// Gateway is a gateway adapter. Id is the value stored in the gateway_id
+// column of the customers and charges it created, so it must never change.
+type Gateway struct {
+	Id   int64
+	Name string
+	New  Factory
+}
+
+var (
+	gatewaysMu     sync.RWMutex
+	gatewaysByName = make(map[string]*Gateway)
+	gatewaysById   = make(map[int64]*Gateway)
+)
+
+// Register makes a gateway adapter available by name and id. Adapters call
+// it from init; registering a name or id twice panics.
+func Register(id int64, name string, factory Factory) {
+	gatewaysMu.Lock()
+	defer gatewaysMu.Unlock()
+
+	if _, ok := gatewaysByName[name]; ok {
+		panic("payments: gateway registered twice: " + name)
+	}
+	if _, ok := gatewaysById[id]; ok {
+		panic(fmt.Sprintf("payments: gateway id registered twice: %d", id))
+	}
+
+	g := &Gateway{Id: id, Name: name, New: factory}
+	gatewaysByName[name] = g
+	gatewaysById[id] = g
+}
+
+// Gateways returns the registered gateways ordered by id.
+func Gateways() []*Gateway {
+	gatewaysMu.RLock()
+	defer gatewaysMu.RUnlock()
+
+	var gateways []*Gateway
+	for _, g := range gatewaysById {
+		gateways = append(gateways, g)
+	}
+
+	sort.Slice(gateways, func(i, j int) bool { return gateways[i].Id < gateways[j].Id })
+
+	return gateways
+}
+
+// LookupGateway returns the gateway registered under name.
+func LookupGateway(name string) (*Gateway, bool) {
+	gatewaysMu.RLock()
+	defer gatewaysMu.RUnlock()
+
+	g, ok := gatewaysByName[name]
+	return g, ok
+}
+
+// Registry resolves the PaymentService that talks to a source's account on a
+// gateway, in live or test mode.
+type Registry interface {
+	Service(sourceId, gatewayId int64, livemode bool) (PaymentService, error)
+	// DefaultGateway returns the id of the gateway new customers of a source
+	// are created on.
+	DefaultGateway(sourceId int64) int64
+	// Breakers returns the circuit breaker of every gateway account.
+	Breakers() []*Breaker
+}
+
+type registryKey struct {
+	sourceId  int64
+	gatewayId int64
+	livemode  bool
+}
+
+type registry struct {
+	static     PaymentService
+	fallback   map[registryKey]PaymentService
+	sources    map[registryKey]PaymentService
+	configured map[int64]bool
+	gateway    int64
+	gateways   map[int64]int64
+	breakers   []*Breaker
+}
+
+// NewRegistry builds a PaymentService for every registered gateway, in each
+// mode, that has credentials by default or for a source. Sources without
+// credentials of their own use the defaults. A configured source never falls
+// back to the default accounts. Every service is wrapped in the resilience
+// decorator, with a circuit breaker per account.
+func NewRegistry(cfg *config.Configuration) (Registry, error) {
+	r := &registry{
+		fallback:   make(map[registryKey]PaymentService),
+		sources:    make(map[registryKey]PaymentService),
+		configured: make(map[int64]bool),
+		gateways:   make(map[int64]int64),
+	}
+
+	g, ok := LookupGateway(cfg.Gateway)
+	if !ok {
+		return nil, fmt.Errorf("unknown gateway %q", cfg.Gateway)
+	}
+	r.gateway = g.Id
+
+	for _, source := range cfg.Sources {
+		if source.Gateway != "" {
+			g, ok := LookupGateway(source.Gateway)
+			if !ok {
+				return nil, fmt.Errorf("unknown gateway %q for source %d", source.Gateway, source.Id)
+			}
+			r.gateways[source.Id] = g.Id
+		}
+	}
+
+	for _, g := range Gateways() {
+		for _, livemode := range []bool{true, false} {
+			if creds := cfg.Credentials(g.Name, livemode); creds != nil {
+				r.fallback[registryKey{0, g.Id, livemode}] = r.wrap(cfg, g, "default", livemode, creds)
+			}
+
+			for _, source := range cfg.Sources {
+				source := source
+				if creds := source.Credentials(g.Name, livemode); creds != nil {
+					r.sources[registryKey{source.Id, g.Id, livemode}] = r.wrap(cfg, g, fmt.Sprintf("source-%d", source.Id), livemode, creds)
+					r.configured[source.Id] = true
+				}
+			}
+		}
+	}
+
+	return r, nil
+}
+
+func (r *registry) wrap(cfg *config.Configuration, g *Gateway, account string, livemode bool, creds *config.GatewayConfig) PaymentService {
+	name := fmt.Sprintf("%s/%s/%s", g.Name, account, modeName(livemode))
+
+	ps, breaker := NewResilientService(name, g.New(creds), cfg.Resilience)
+	r.breakers = append(r.breakers, breaker)
+
+	return ps
+}
+
+// NewStaticRegistry returns a registry that uses ps for every source, gateway
+// and mode.
+func NewStaticRegistry(ps PaymentService) Registry {
+	return &registry{static: ps, gateway: GatewayStripe}
+}
+
+func (r *registry) Service(sourceId, gatewayId int64, livemode bool) (PaymentService, error) {
+	if r.static != nil {
+		return r.static, nil
+	}
+
+	if ps, ok := r.sources[registryKey{sourceId, gatewayId, livemode}]; ok {
+		return ps, nil
+	}
+
+	ps, ok := r.fallback[registryKey{0, gatewayId, livemode}]
+	if !ok || r.configured[sourceId] {
+		return nil, status.Errorf(codes.FailedPrecondition, "no %s gateway %d configured for source %d", modeName(livemode), gatewayId, sourceId)
+	}
+
+	return ps, nil
+}
+
+func (r *registry) DefaultGateway(sourceId int64) int64 {
+	if id, ok := r.gateways[sourceId]; ok {
+		return id
+	}
+
+	return r.gateway
+}
+
+func (r *registry) Breakers() []*Breaker {
+	return r.breakers
+}
+
+func modeName(livemode bool) string {
+	if livemode {
+		return "live"
+	}
+	return "test"
+}
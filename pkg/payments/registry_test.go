@@ -0,0 +1,127 @@
+package payments
+
+import (
+	"github.com/robertkohut/go-payments/internal/config"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestRegistryRoutesBySource(t *testing.T) {
+	r, err := NewRegistry(&config.Configuration{
+		Gateway:    "stripe",
+		Stripe:     &config.GatewayConfig{PublishableKey: "pk_live_default", SecretKey: "sk_live_default"},
+		StripeTest: &config.GatewayConfig{PublishableKey: "pk_test_default", SecretKey: "sk_test_default"},
+		Sources: []config.SourceConfig{
+			{
+				Id:         2,
+				Stripe:     config.GatewayConfig{PublishableKey: "pk_live_two", SecretKey: "sk_live_two"},
+				StripeTest: config.GatewayConfig{PublishableKey: "pk_test_two", SecretKey: "sk_test_two"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not build registry: %v", err)
+	}
+
+	tests := []struct {
+		sourceId int64
+		livemode bool
+		want     string
+	}{
+		{1, true, "pk_live_default"},
+		{1, false, "pk_test_default"},
+		{2, true, "pk_live_two"},
+		{2, false, "pk_test_two"},
+	}
+
+	for _, tt := range tests {
+		ps, err := r.Service(tt.sourceId, GatewayStripe, tt.livemode)
+		if err != nil {
+			t.Fatalf("Could not resolve source %d: %v", tt.sourceId, err)
+		}
+
+		key, err := ps.GetPublishableKey()
+		if err != nil {
+			t.Fatalf("Could not get publishable key: %v", err)
+		}
+
+		if key != tt.want {
+			t.Errorf("Source %d, livemode %v: expected %s, got %s", tt.sourceId, tt.livemode, tt.want, key)
+		}
+	}
+}
+
+func TestRegistryWithoutDefault(t *testing.T) {
+	r, err := NewRegistry(&config.Configuration{
+		Gateway: "stripe",
+		Stripe:  &config.GatewayConfig{},
+		Sources: []config.SourceConfig{
+			{Id: 2, Stripe: config.GatewayConfig{PublishableKey: "pk_live_two", SecretKey: "sk_live_two"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not build registry: %v", err)
+	}
+
+	_, err = r.Service(1, GatewayStripe, true)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Expected FailedPrecondition, got %v", err)
+	}
+
+	// A configured source must not fall back to another account.
+	_, err = r.Service(2, GatewayStripe, false)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Expected FailedPrecondition, got %v", err)
+	}
+}
+
+func TestRegistryGateways(t *testing.T) {
+	r, err := NewRegistry(&config.Configuration{
+		Gateway: "stripe",
+		Stripe:  &config.GatewayConfig{PublishableKey: "pk_live_default", SecretKey: "sk_live_default"},
+		Sources: []config.SourceConfig{
+			{
+				Id:      2,
+				Gateway: "braintree",
+				Gateways: map[string]config.GatewayConfig{
+					"braintree": {PublishableKey: "pub", SecretKey: "priv", MerchantId: "m1"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Could not build registry: %v", err)
+	}
+
+	if id := r.DefaultGateway(1); id != GatewayStripe {
+		t.Errorf("Expected source 1 to default to stripe, got %d", id)
+	}
+
+	if id := r.DefaultGateway(2); id != GatewayBraintree {
+		t.Errorf("Expected source 2 to default to braintree, got %d", id)
+	}
+
+	ps, err := r.Service(2, GatewayBraintree, true)
+	if err != nil {
+		t.Fatalf("Could not resolve braintree for source 2: %v", err)
+	}
+
+	if rs, ok := ps.(*resilientTokenService); !ok {
+		t.Errorf("Expected a resilient braintree service, got %T", ps)
+	} else if _, ok := rs.ps.(*braintreeService); !ok {
+		t.Errorf("Expected a braintree service, got %T", rs.ps)
+	}
+
+	// Source 2 has credentials of its own, so stripe customers it may still
+	// have are not charged on the default account.
+	_, err = r.Service(2, GatewayStripe, true)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Expected FailedPrecondition, got %v", err)
+	}
+
+	_, err = NewRegistry(&config.Configuration{Gateway: "unknown"})
+	if err == nil {
+		t.Fatal("Expected an error for an unknown gateway")
+	}
+}
@@ -0,0 +1,394 @@
+package payments
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/robertkohut/go-payments/internal/config"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// gatewayCalls counts calls by "<breaker>.<operation>.<outcome>", where
+	// the outcome is ok, error, retry, timeout or rejected.
+	gatewayCalls = expvar.NewMap("gateway_calls")
+	// gatewayBreakers holds the state of every circuit breaker by name.
+	gatewayBreakers = expvar.NewMap("gateway_breakers")
+)
+
+var defaultResilience = config.ResilienceConfig{
+	Timeout:         10 * time.Second,
+	ChargeTimeout:   30 * time.Second,
+	Retries:         2,
+	RetryBackoff:    200 * time.Millisecond,
+	BreakerFailures: 5,
+	BreakerCooldown: 30 * time.Second,
+}
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker stops calls to a gateway account after consecutive failures. Once
+// the cooldown has passed a single call is let through; it closes the breaker
+// if it succeeds and opens it again if it fails.
+type Breaker struct {
+	name     string
+	failures int
+	cooldown time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failed   int
+	openedAt time.Time
+	probing  bool
+	stateVar *expvar.String
+}
+
+func NewBreaker(name string, failures int, cooldown time.Duration) *Breaker {
+	b := &Breaker{
+		name:     name,
+		failures: failures,
+		cooldown: cooldown,
+		stateVar: new(expvar.String),
+	}
+
+	b.stateVar.Set(BreakerClosed.String())
+	gatewayBreakers.Set(name, b.stateVar)
+
+	return b
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// allow reports whether a call may be made now.
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record reports the outcome of an allowed call.
+func (b *Breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	if !failed {
+		b.failed = 0
+		b.setState(BreakerClosed)
+		return
+	}
+
+	b.failed++
+	if b.state == BreakerHalfOpen || b.failed >= b.failures {
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+func (b *Breaker) setState(state BreakerState) {
+	if b.state != state {
+		b.state = state
+		b.stateVar.Set(state.String())
+	}
+}
+
+// breakerOpenError is returned without calling the gateway while its breaker
+// is open. It is an ErrUnavailable, so charges can fail over.
+type breakerOpenError struct {
+	name string
+}
+
+func (e *breakerOpenError) Error() string {
+	return fmt.Sprintf("gateway %s is unavailable", e.name)
+}
+
+func (e *breakerOpenError) Unwrap() error {
+	return ErrUnavailable
+}
+
+func (e *breakerOpenError) GRPCStatus() *status.Status {
+	return status.New(codes.Unavailable, e.Error())
+}
+
+// timeoutError is returned when a call is given up on. It is an ErrTimeout.
+type timeoutError struct {
+	name    string
+	op      string
+	timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("gateway %s did not answer %s within %s", e.name, e.op, e.timeout)
+}
+
+func (e *timeoutError) Unwrap() error {
+	return ErrTimeout
+}
+
+func (e *timeoutError) GRPCStatus() *status.Status {
+	return status.New(codes.DeadlineExceeded, e.Error())
+}
+
+// resilientService applies timeouts, retries and a circuit breaker to every
+// call to a PaymentService. Calls are retried when the gateway did not
+// process them; read-only and idempotent calls are also retried on
+// transient errors. Calls that time out are never retried, as they may
+// still complete.
+type resilientService struct {
+	ps      PaymentService
+	cfg     config.ResilienceConfig
+	breaker *Breaker
+}
+
+// resilientTokenService is a resilientService for an adapter that can charge
+// network tokens.
+type resilientTokenService struct {
+	*resilientService
+}
+
+// NewResilientService wraps ps. The returned service implements
+// NetworkTokenService only if ps does.
+func NewResilientService(name string, ps PaymentService, cfg *config.ResilienceConfig) (PaymentService, *Breaker) {
+	if cfg == nil {
+		cfg = &defaultResilience
+	}
+
+	s := &resilientService{
+		ps:      ps,
+		cfg:     *cfg,
+		breaker: NewBreaker(name, cfg.BreakerFailures, cfg.BreakerCooldown),
+	}
+
+	if _, ok := ps.(NetworkTokenService); ok {
+		return &resilientTokenService{s}, s.breaker
+	}
+
+	return s, s.breaker
+}
+
+// call runs fn under the service's policy. safe marks calls that may be
+// retried after the gateway may have processed them.
+func call[T any](s *resilientService, op string, safe bool, timeout time.Duration, fn func() (T, error)) (T, error) {
+	name := s.breaker.Name()
+
+	for attempt := 0; ; attempt++ {
+		if !s.breaker.allow() {
+			gatewayCalls.Add(name+"."+op+".rejected", 1)
+			var zero T
+			return zero, &breakerOpenError{name: name}
+		}
+
+		result, err := withTimeout(timeout, fn)
+		if errors.Is(err, ErrTimeout) {
+			err = &timeoutError{name: name, op: op, timeout: timeout}
+		}
+
+		s.breaker.record(isGatewayFailure(err))
+
+		switch {
+		case err == nil:
+			gatewayCalls.Add(name+"."+op+".ok", 1)
+			return result, nil
+		case errors.Is(err, ErrTimeout):
+			gatewayCalls.Add(name+"."+op+".timeout", 1)
+			return result, err
+		case attempt >= s.cfg.Retries || !retryable(err, safe):
+			gatewayCalls.Add(name+"."+op+".error", 1)
+			return result, err
+		}
+
+		gatewayCalls.Add(name+"."+op+".retry", 1)
+		time.Sleep(backoff(s.cfg.RetryBackoff, attempt))
+	}
+}
+
+type result[T any] struct {
+	value T
+	err   error
+}
+
+// withTimeout returns ErrTimeout if fn does not return in time. fn keeps
+// running in the background until the adapter's own client gives up.
+func withTimeout[T any](timeout time.Duration, fn func() (T, error)) (T, error) {
+	if timeout <= 0 {
+		return fn()
+	}
+
+	done := make(chan result[T], 1)
+	go func() {
+		value, err := fn()
+		done <- result[T]{value, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-timer.C:
+		var zero T
+		return zero, ErrTimeout
+	}
+}
+
+// isGatewayFailure reports whether err counts against the breaker. Errors
+// the gateway answered with, such as declines, do not.
+func isGatewayFailure(err error) bool {
+	return errors.Is(err, ErrUnavailable) || errors.Is(err, ErrTransient) || errors.Is(err, ErrTimeout)
+}
+
+func retryable(err error, safe bool) bool {
+	if errors.Is(err, ErrUnavailable) {
+		return true
+	}
+
+	return safe && errors.Is(err, ErrTransient)
+}
+
+// backoff returns a random delay between half and all of base doubled for
+// each attempt so far.
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base << uint(attempt)
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (s *resilientService) GetPublishableKey() (string, error) {
+	return call(s, "GetPublishableKey", true, s.cfg.Timeout, s.ps.GetPublishableKey)
+}
+
+func (s *resilientService) CreateCustomer(customer *pb.Customer) (string, error) {
+	return call(s, "CreateCustomer", false, s.cfg.Timeout, func() (string, error) {
+		return s.ps.CreateCustomer(customer)
+	})
+}
+
+func (s *resilientService) UpdateCustomer(customer *pb.Customer) error {
+	_, err := call(s, "UpdateCustomer", true, s.cfg.Timeout, func() (struct{}, error) {
+		return struct{}{}, s.ps.UpdateCustomer(customer)
+	})
+	return err
+}
+
+func (s *resilientService) DeleteCustomer(customer *pb.Customer) error {
+	_, err := call(s, "DeleteCustomer", false, s.cfg.Timeout, func() (struct{}, error) {
+		return struct{}{}, s.ps.DeleteCustomer(customer)
+	})
+	return err
+}
+
+func (s *resilientService) AddCustomerPaymentMethod(customer *pb.Customer, card *pb.Card) (*pb.Card, error) {
+	return call(s, "AddCustomerPaymentMethod", false, s.cfg.Timeout, func() (*pb.Card, error) {
+		return s.ps.AddCustomerPaymentMethod(customer, card)
+	})
+}
+
+func (s *resilientService) RemoveCustomerPaymentMethod(customer *pb.Customer, card *pb.Card) error {
+	_, err := call(s, "RemoveCustomerPaymentMethod", false, s.cfg.Timeout, func() (struct{}, error) {
+		return struct{}{}, s.ps.RemoveCustomerPaymentMethod(customer, card)
+	})
+	return err
+}
+
+func (s *resilientService) CreateSetupIntent(customer *pb.Customer) (*pb.SetupIntent, error) {
+	return call(s, "CreateSetupIntent", false, s.cfg.Timeout, func() (*pb.SetupIntent, error) {
+		return s.ps.CreateSetupIntent(customer)
+	})
+}
+
+func (s *resilientService) CompleteSetupIntent(customer *pb.Customer, setup *pb.SetupIntent) (*pb.SetupIntent, error) {
+	_, idempotent := s.ps.(idempotentCharger)
+
+	return call(s, "CompleteSetupIntent", idempotent, s.cfg.Timeout, func() (*pb.SetupIntent, error) {
+		return s.ps.CompleteSetupIntent(customer, setup)
+	})
+}
+
+func (s *resilientService) CreateCharge(customer *pb.Customer, card *pb.Card, charge *pb.Charge) (*pb.Charge, error) {
+	_, idempotent := s.ps.(idempotentCharger)
+
+	return call(s, "CreateCharge", idempotent, s.cfg.ChargeTimeout, func() (*pb.Charge, error) {
+		return s.ps.CreateCharge(customer, card, charge)
+	})
+}
+
+func (s *resilientService) FindCharge(charge *pb.Charge) (*pb.Charge, error) {
+	return call(s, "FindCharge", true, s.cfg.Timeout, func() (*pb.Charge, error) {
+		return s.ps.FindCharge(charge)
+	})
+}
+
+func (s *resilientService) CaptureCharge(charge *pb.Charge) (*pb.Charge, error) {
+	_, idempotent := s.ps.(idempotentCharger)
+
+	return call(s, "CaptureCharge", idempotent, s.cfg.ChargeTimeout, func() (*pb.Charge, error) {
+		return s.ps.CaptureCharge(charge)
+	})
+}
+
+func (s *resilientService) VoidCharge(charge *pb.Charge) (*pb.Charge, error) {
+	_, idempotent := s.ps.(idempotentCharger)
+
+	return call(s, "VoidCharge", idempotent, s.cfg.ChargeTimeout, func() (*pb.Charge, error) {
+		return s.ps.VoidCharge(charge)
+	})
+}
+
+func (s *resilientTokenService) CreateNetworkTokenCharge(card *pb.Card, charge *pb.Charge) (*pb.Charge, error) {
+	return call(s.resilientService, "CreateNetworkTokenCharge", false, s.cfg.ChargeTimeout, func() (*pb.Charge, error) {
+		return s.ps.(NetworkTokenService).CreateNetworkTokenCharge(card, charge)
+	})
+}
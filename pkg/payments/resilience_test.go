@@ -0,0 +1,145 @@
+package payments
+
+import (
+	"errors"
+	"github.com/robertkohut/go-payments/internal/config"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+// flakyService fails every call with the queued errors before succeeding.
+type flakyService struct {
+	PaymentService
+	errs  []error
+	calls int
+	delay time.Duration
+}
+
+func (s *flakyService) next() error {
+	s.calls++
+	time.Sleep(s.delay)
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func (s *flakyService) CreateCustomer(*pb.Customer) (string, error) {
+	return "cus_1", s.next()
+}
+
+func (s *flakyService) FindCharge(*pb.Charge) (*pb.Charge, error) {
+	return &pb.Charge{ExtId: "ch_1"}, s.next()
+}
+
+var testResilience = &config.ResilienceConfig{
+	Timeout:         50 * time.Millisecond,
+	ChargeTimeout:   50 * time.Millisecond,
+	Retries:         2,
+	RetryBackoff:    time.Millisecond,
+	BreakerFailures: 3,
+	BreakerCooldown: 50 * time.Millisecond,
+}
+
+func TestResilientRetries(t *testing.T) {
+	transient := &classifiedError{class: ErrTransient, err: errors.New("502")}
+	unavailable := &classifiedError{class: ErrUnavailable, err: errors.New("503")}
+
+	// Read-only calls are retried on transient errors.
+	fs := &flakyService{errs: []error{transient, transient}}
+	ps, _ := NewResilientService("test/find", fs, testResilience)
+
+	found, err := ps.FindCharge(&pb.Charge{})
+	if err != nil || found.ExtId != "ch_1" || fs.calls != 3 {
+		t.Errorf("Expected FindCharge to succeed on the third call, got %v, %v after %d calls", found, err, fs.calls)
+	}
+
+	// Other calls are only retried if the gateway never processed them.
+	fs = &flakyService{errs: []error{transient}}
+	ps, _ = NewResilientService("test/create-transient", fs, testResilience)
+
+	_, err = ps.CreateCustomer(&pb.Customer{})
+	if !errors.Is(err, ErrTransient) || fs.calls != 1 {
+		t.Errorf("Expected CreateCustomer not to be retried, got %v after %d calls", err, fs.calls)
+	}
+
+	fs = &flakyService{errs: []error{unavailable}}
+	ps, _ = NewResilientService("test/create-unavailable", fs, testResilience)
+
+	extId, err := ps.CreateCustomer(&pb.Customer{})
+	if err != nil || extId != "cus_1" || fs.calls != 2 {
+		t.Errorf("Expected CreateCustomer to succeed on the second call, got %v after %d calls", err, fs.calls)
+	}
+}
+
+func TestResilientTimeout(t *testing.T) {
+	fs := &flakyService{delay: 200 * time.Millisecond}
+	ps, _ := NewResilientService("test/timeout", fs, testResilience)
+
+	start := time.Now()
+	_, err := ps.FindCharge(&pb.Charge{})
+
+	if !errors.Is(err, ErrTimeout) || status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+
+	if time.Since(start) > 150*time.Millisecond {
+		t.Errorf("Expected the call to be given up after the timeout, took %s", time.Since(start))
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	transient := &classifiedError{class: ErrTransient, err: errors.New("500")}
+
+	fs := &flakyService{errs: []error{transient, transient, transient}}
+	ps, breaker := NewResilientService("test/breaker", fs, testResilience)
+
+	_, _ = ps.CreateCustomer(&pb.Customer{})
+	_, _ = ps.CreateCustomer(&pb.Customer{})
+	_, _ = ps.CreateCustomer(&pb.Customer{})
+
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("Expected the breaker to be open, got %s", breaker.State())
+	}
+
+	_, err := ps.CreateCustomer(&pb.Customer{})
+	if !errors.Is(err, ErrUnavailable) || status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected an open breaker to fail fast with Unavailable, got %v", err)
+	}
+
+	if fs.calls != 3 {
+		t.Errorf("Expected no call while the breaker is open, got %d calls", fs.calls)
+	}
+
+	if v := gatewayBreakers.Get("test/breaker").String(); v != `"open"` {
+		t.Errorf("Expected the breaker state to be published, got %s", v)
+	}
+
+	time.Sleep(testResilience.BreakerCooldown)
+
+	_, err = ps.CreateCustomer(&pb.Customer{})
+	if err != nil {
+		t.Fatalf("Expected the probe after the cooldown to succeed, got %v", err)
+	}
+
+	if breaker.State() != BreakerClosed {
+		t.Errorf("Expected the breaker to close after a successful probe, got %s", breaker.State())
+	}
+}
+
+func TestResilientNetworkTokens(t *testing.T) {
+	ps, _ := NewResilientService("test/stripe", &stripeService{}, testResilience)
+	if _, ok := ps.(NetworkTokenService); ok {
+		t.Error("Expected the stripe service not to charge network tokens")
+	}
+
+	ps, _ = NewResilientService("test/braintree", &braintreeService{}, testResilience)
+	if _, ok := ps.(NetworkTokenService); !ok {
+		t.Error("Expected the braintree service to charge network tokens")
+	}
+}
@@ -1,46 +1,109 @@
 package payments
 
 import (
+	"fmt"
 	"github.com/robertkohut/go-payments/internal/config"
 	pb "github.com/robertkohut/go-payments/proto"
 	"github.com/stripe/stripe-go/v74"
 	"github.com/stripe/stripe-go/v74/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// GatewayStripe is the gateway_id of customers and charges created on Stripe.
+const GatewayStripe = 1
+
+const stripeTimeout = 60 * time.Second
+
+func init() {
+	Register(GatewayStripe, "stripe", NewStripeService)
+}
+
 type stripeService struct {
 	publishableKey string
 	client         *client.API
 }
 
-func NewStripeService(cfg *config.StripeConfig) PaymentService {
+// NewStripeService creates a Stripe client that does not retry on its own;
+// retries are left to the resilience decorator.
+func NewStripeService(cfg *config.GatewayConfig) PaymentService {
+	backendConfig := &stripe.BackendConfig{
+		HTTPClient:        &http.Client{Timeout: stripeTimeout},
+		MaxNetworkRetries: stripe.Int64(0),
+	}
+
+	backends := &stripe.Backends{
+		API:     stripe.GetBackendWithConfig(stripe.APIBackend, backendConfig),
+		Connect: stripe.GetBackendWithConfig(stripe.ConnectBackend, backendConfig),
+		Uploads: stripe.GetBackendWithConfig(stripe.UploadsBackend, backendConfig),
+	}
+
 	return &stripeService{
 		publishableKey: cfg.PublishableKey,
-		client:         client.New(cfg.SecretKey, nil),
+		client:         client.New(cfg.SecretKey, backends),
 	}
 }
 
+// Payment intents are created with the charge's idempotency key, so sending
+// one again returns the first result.
+func (s *stripeService) idempotentCharges() {}
+
 func (s *stripeService) GetPublishableKey() (string, error) {
 	return s.publishableKey, nil
 }
 
 func (s *stripeService) CreateCustomer(customer *pb.Customer) (string, error) {
-	params := &stripe.CustomerParams{
-		Description: stripe.String(customer.Name),
+	c, err := s.client.Customers.New(stripeCustomerParams(customer))
+	if err != nil {
+		return "", stripeError(err)
 	}
 
-	c, err := s.client.Customers.New(params)
+	return c.ID, nil
+}
+
+func (s *stripeService) UpdateCustomer(customer *pb.Customer) error {
+	_, err := s.client.Customers.Update(customer.GetExtId(), stripeCustomerParams(customer))
 	if err != nil {
-		return "", err
+		return stripeError(err)
 	}
 
-	return c.ID, nil
+	return nil
+}
+
+func stripeCustomerParams(customer *pb.Customer) *stripe.CustomerParams {
+	params := &stripe.CustomerParams{
+		Name:  stripe.String(customer.GetName()),
+		Email: stripe.String(customer.GetEmail()),
+		Phone: stripe.String(customer.GetPhone()),
+	}
+
+	if address := customer.GetAddress(); address != nil {
+		params.Address = &stripe.AddressParams{
+			Line1:      stripe.String(address.GetLine1()),
+			Line2:      stripe.String(address.GetLine2()),
+			City:       stripe.String(address.GetCity()),
+			State:      stripe.String(address.GetState()),
+			PostalCode: stripe.String(address.GetPostalCode()),
+			Country:    stripe.String(address.GetCountry()),
+		}
+	}
+
+	for k, v := range customer.GetMetadata() {
+		params.AddMetadata(k, v)
+	}
+
+	return params
 }
 
 func (s *stripeService) DeleteCustomer(customer *pb.Customer) error {
 	c, err := s.client.Customers.Del(customer.ExtId, nil)
 	if err != nil {
-		return err
+		return stripeError(err)
 	}
 
 	log.Println("Deleted stripe customer: ", c.ID)
@@ -56,17 +119,160 @@ func (s *stripeService) AddCustomerPaymentMethod(customer *pb.Customer, card *pb
 		})
 
 	if err != nil {
+		return nil, stripeError(err)
+	}
+
+	vaulted, err := stripeCard(pm)
+	if err != nil {
+		_, _ = s.client.PaymentMethods.Detach(pm.ID, &stripe.PaymentMethodDetachParams{})
 		return nil, err
 	}
 
-	card = &pb.Card{
-		Brand: string(pm.Card.Brand),
-		Last4: pm.Card.Last4,
+	return vaulted, nil
+}
+
+// stripeCard converts a card payment method. Only cards can be saved, so any
+// other type of payment method is rejected.
+func stripeCard(pm *stripe.PaymentMethod) (*pb.Card, error) {
+	if pm.Type != stripe.PaymentMethodTypeCard || pm.Card == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "payment method is not a card: %s", pm.Type)
+	}
+
+	card := &pb.Card{
+		ExtId:       pm.ID,
+		Brand:       string(pm.Card.Brand),
+		Last4:       pm.Card.Last4,
+		ExpMonth:    uint32(pm.Card.ExpMonth),
+		ExpYear:     uint32(pm.Card.ExpYear),
+		Country:     pm.Card.Country,
+		Fingerprint: pm.Card.Fingerprint,
+		Funding:     stripeCardFunding(pm.Card.Funding),
+	}
+
+	if pm.Card.Wallet != nil {
+		card.Wallet = stripeCardWallets[pm.Card.Wallet.Type]
+	}
+
+	if pm.Card.Checks != nil {
+		card.CvcCheck = stripeCardCheck(string(pm.Card.Checks.CVCCheck))
+		card.PostalCodeCheck = stripeCardCheck(string(pm.Card.Checks.AddressPostalCodeCheck))
 	}
 
 	return card, nil
 }
 
+var stripeCardWallets = map[stripe.PaymentMethodCardWalletType]pb.CardWallet{
+	stripe.PaymentMethodCardWalletTypeApplePay:            pb.CardWallet_CARD_WALLET_APPLE_PAY,
+	stripe.PaymentMethodCardWalletTypeGooglePay:           pb.CardWallet_CARD_WALLET_GOOGLE_PAY,
+	stripe.PaymentMethodCardWalletTypeSamsungPay:          pb.CardWallet_CARD_WALLET_SAMSUNG_PAY,
+	stripe.PaymentMethodCardWalletTypeMasterpass:          pb.CardWallet_CARD_WALLET_MASTERPASS,
+	stripe.PaymentMethodCardWalletTypeVisaCheckout:        pb.CardWallet_CARD_WALLET_VISA_CHECKOUT,
+	stripe.PaymentMethodCardWalletTypeAmexExpressCheckout: pb.CardWallet_CARD_WALLET_AMEX_EXPRESS_CHECKOUT,
+	stripe.PaymentMethodCardWalletTypeLink:                pb.CardWallet_CARD_WALLET_LINK,
+}
+
+func stripeCardFunding(funding stripe.CardFunding) pb.CardFunding {
+	switch funding {
+	case stripe.CardFundingCredit:
+		return pb.CardFunding_CARD_FUNDING_CREDIT
+	case stripe.CardFundingDebit:
+		return pb.CardFunding_CARD_FUNDING_DEBIT
+	case stripe.CardFundingPrepaid:
+		return pb.CardFunding_CARD_FUNDING_PREPAID
+	default:
+		return pb.CardFunding_CARD_FUNDING_UNKNOWN
+	}
+}
+
+// stripeCardCheck converts the result of a CVC or postal code check. Stripe
+// leaves it empty if nothing was provided to check.
+func stripeCardCheck(check string) pb.CardCheck {
+	switch check {
+	case "pass":
+		return pb.CardCheck_CARD_CHECK_PASS
+	case "fail":
+		return pb.CardCheck_CARD_CHECK_FAIL
+	case "unavailable":
+		return pb.CardCheck_CARD_CHECK_UNAVAILABLE
+	case "unchecked":
+		return pb.CardCheck_CARD_CHECK_UNCHECKED
+	default:
+		return pb.CardCheck_CARD_CHECK_UNSPECIFIED
+	}
+}
+
+// CreateSetupIntent creates a setup intent for off-session use, which the
+// client confirms with Stripe.js using the client secret.
+func (s *stripeService) CreateSetupIntent(customer *pb.Customer) (*pb.SetupIntent, error) {
+	si, err := s.client.SetupIntents.New(&stripe.SetupIntentParams{
+		Customer:           stripe.String(customer.GetExtId()),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		Usage:              stripe.String(string(stripe.SetupIntentUsageOffSession)),
+	})
+	if err != nil {
+		return nil, stripeError(err)
+	}
+
+	return &pb.SetupIntent{
+		ExtId:        si.ID,
+		ClientSecret: si.ClientSecret,
+		Status:       stripeSetupIntentStatus(si.Status),
+	}, nil
+}
+
+// CompleteSetupIntent retrieves a setup intent the client confirmed. Stripe
+// attaches the card to the customer when the setup succeeds.
+func (s *stripeService) CompleteSetupIntent(customer *pb.Customer, setup *pb.SetupIntent) (*pb.SetupIntent, error) {
+	params := &stripe.SetupIntentParams{}
+	params.AddExpand("payment_method")
+
+	si, err := s.client.SetupIntents.Get(setup.GetExtId(), params)
+	if err != nil {
+		return nil, stripeError(err)
+	}
+
+	if si.Customer == nil || si.Customer.ID != customer.GetExtId() {
+		return nil, status.Error(codes.NotFound, "setup intent not found")
+	}
+
+	result := &pb.SetupIntent{
+		ExtId:  si.ID,
+		Status: stripeSetupIntentStatus(si.Status),
+	}
+
+	if result.Status == pb.SetupIntentStatus_SETUP_INTENT_STATUS_SUCCEEDED && si.PaymentMethod != nil {
+		result.Card, err = stripeCard(si.PaymentMethod)
+		if err != nil {
+			return nil, err
+		}
+		result.Card.SetupIntentId = si.ID
+		if si.Mandate != nil {
+			result.Card.Mandate = si.Mandate.ID
+		}
+	}
+
+	return result, nil
+}
+
+func stripeSetupIntentStatus(st stripe.SetupIntentStatus) pb.SetupIntentStatus {
+	switch st {
+	case stripe.SetupIntentStatusRequiresPaymentMethod:
+		return pb.SetupIntentStatus_SETUP_INTENT_STATUS_REQUIRES_PAYMENT_METHOD
+	case stripe.SetupIntentStatusRequiresConfirmation:
+		return pb.SetupIntentStatus_SETUP_INTENT_STATUS_REQUIRES_CONFIRMATION
+	case stripe.SetupIntentStatusRequiresAction:
+		return pb.SetupIntentStatus_SETUP_INTENT_STATUS_REQUIRES_ACTION
+	case stripe.SetupIntentStatusProcessing:
+		return pb.SetupIntentStatus_SETUP_INTENT_STATUS_PROCESSING
+	case stripe.SetupIntentStatusSucceeded:
+		return pb.SetupIntentStatus_SETUP_INTENT_STATUS_SUCCEEDED
+	case stripe.SetupIntentStatusCanceled:
+		return pb.SetupIntentStatus_SETUP_INTENT_STATUS_CANCELED
+	default:
+		return pb.SetupIntentStatus_SETUP_INTENT_STATUS_UNSPECIFIED
+	}
+}
+
 func (s *stripeService) RemoveCustomerPaymentMethod(_ *pb.Customer, card *pb.Card) error {
 	_, err := s.client.PaymentMethods.Detach(
 		card.GetExtId(),
@@ -74,38 +280,188 @@ func (s *stripeService) RemoveCustomerPaymentMethod(_ *pb.Customer, card *pb.Car
 	)
 
 	if err != nil {
-		return err
+		return stripeError(err)
 	}
 
 	return nil
 }
 
-func (s *stripeService) CreateCharge(customer *pb.Customer, card *pb.Card, charge *pb.Charge) (*string, error) {
+func (s *stripeService) CreateCharge(customer *pb.Customer, card *pb.Card, charge *pb.Charge) (*pb.Charge, error) {
 	params := &stripe.PaymentIntentParams{
 		Amount:        stripe.Int64(charge.GetAmount()),
-		Currency:      stripe.String(string(stripe.CurrencyUSD)),
+		Currency:      stripe.String(strings.ToLower(charge.GetCurrency())),
 		Customer:      stripe.String(customer.GetExtId()),
 		PaymentMethod: stripe.String(card.GetExtId()),
 		Description:   stripe.String(charge.GetDescription()),
+		Confirm:       stripe.Bool(true),
 	}
 
+	if charge.GetReview() != nil {
+		params.CaptureMethod = stripe.String(string(stripe.PaymentIntentCaptureMethodManual))
+	}
+
+	// Cards saved through a setup intent were authenticated for charges made
+	// without the cardholder present.
+	if card.GetSetupIntentId() != "" {
+		params.OffSession = stripe.Bool(true)
+		if card.GetMandate() != "" {
+			params.Mandate = stripe.String(card.GetMandate())
+		}
+	}
+
+	// The idempotency key and charge id let FindCharge resolve a charge whose
+	// outcome was never recorded locally.
+	params.SetIdempotencyKey(charge.GetIdempotencyKey())
+	params.AddMetadata("charge_id", strconv.FormatInt(charge.GetId(), 10))
+	params.AddMetadata("idempotency_key", charge.GetIdempotencyKey())
+
 	pi, err := s.client.PaymentIntents.New(params)
 	if err != nil {
-		return nil, err
+		return nil, stripeError(err)
+	}
+
+	log.Println("Created and confirmed stripe payment intent: ", pi.ID, pi.Status)
+
+	return &pb.Charge{
+		ExtId:  pi.ID,
+		Status: stripeChargeStatus(pi.Status),
+	}, nil
+}
+
+func (s *stripeService) FindCharge(charge *pb.Charge) (*pb.Charge, error) {
+	params := &stripe.PaymentIntentSearchParams{}
+	params.Query = fmt.Sprintf("metadata['idempotency_key']:'%s'", charge.GetIdempotencyKey())
+
+	iter := s.client.PaymentIntents.Search(params)
+	for iter.Next() {
+		pi := iter.PaymentIntent()
+
+		charge := &pb.Charge{
+			ExtId:  pi.ID,
+			Status: stripeChargeStatus(pi.Status),
+		}
+
+		if pi.LastPaymentError != nil && charge.Status == pb.ChargeStatus_CHARGE_STATUS_FAILED {
+			if declineErr, ok := stripeError(pi.LastPaymentError).(*DeclineError); ok {
+				charge.Decline = declineErr.Decline
+			}
+		}
+
+		return charge, nil
 	}
 
-	log.Println("Created stripe payment intent: ", pi.ID)
+	if err := iter.Err(); err != nil {
+		return nil, stripeError(err)
+	}
+
+	// Search only lists payment intents once they are indexed, which can take
+	// minutes during an outage, so an empty result does not prove Stripe never
+	// saw the charge.
+	return nil, fmt.Errorf("stripe: no payment intent for %s: %w", charge.GetIdempotencyKey(), ErrNotVisible)
+}
+
+// CaptureCharge captures an authorized payment intent. The idempotency key
+// is derived from the charge's, so a retried capture is only applied once.
+func (s *stripeService) CaptureCharge(charge *pb.Charge) (*pb.Charge, error) {
+	params := &stripe.PaymentIntentCaptureParams{}
+	params.SetIdempotencyKey(charge.GetIdempotencyKey() + "-capture")
 
-	confirmParams := &stripe.PaymentIntentConfirmParams{
-		PaymentMethod: stripe.String(card.GetExtId()), // Card ID.
+	pi, err := s.client.PaymentIntents.Capture(charge.GetExtId(), params)
+	if err != nil {
+		return nil, stripeError(err)
 	}
 
-	pi, err = s.client.PaymentIntents.Confirm(pi.ID, confirmParams)
+	log.Println("Captured stripe payment intent: ", pi.ID, pi.Status)
+
+	return &pb.Charge{
+		ExtId:  pi.ID,
+		Status: stripeChargeStatus(pi.Status),
+	}, nil
+}
+
+// VoidCharge cancels an authorized payment intent, releasing the hold on the
+// card.
+func (s *stripeService) VoidCharge(charge *pb.Charge) (*pb.Charge, error) {
+	params := &stripe.PaymentIntentCancelParams{}
+	params.SetIdempotencyKey(charge.GetIdempotencyKey() + "-void")
+
+	pi, err := s.client.PaymentIntents.Cancel(charge.GetExtId(), params)
 	if err != nil {
-		return nil, err
+		return nil, stripeError(err)
 	}
 
-	log.Println("Confirmed stripe payment intent: ", pi.ID)
+	log.Println("Canceled stripe payment intent: ", pi.ID, pi.Status)
+
+	return &pb.Charge{
+		ExtId:  pi.ID,
+		Status: stripeChargeStatus(pi.Status),
+	}, nil
+}
+
+func stripeChargeStatus(status stripe.PaymentIntentStatus) pb.ChargeStatus {
+	switch status {
+	case stripe.PaymentIntentStatusSucceeded:
+		return pb.ChargeStatus_CHARGE_STATUS_SUCCEEDED
+	case stripe.PaymentIntentStatusRequiresAction:
+		return pb.ChargeStatus_CHARGE_STATUS_REQUIRES_ACTION
+	case stripe.PaymentIntentStatusRequiresCapture:
+		return pb.ChargeStatus_CHARGE_STATUS_AUTHORIZED
+	case stripe.PaymentIntentStatusCanceled:
+		return pb.ChargeStatus_CHARGE_STATUS_CANCELED
+	case stripe.PaymentIntentStatusRequiresPaymentMethod:
+		return pb.ChargeStatus_CHARGE_STATUS_FAILED
+	default:
+		return pb.ChargeStatus_CHARGE_STATUS_PENDING
+	}
+}
+
+// stripeDeclineReasons maps Stripe's decline codes, and the error codes of
+// card errors without one.
+var stripeDeclineReasons = map[string]pb.DeclineReason{
+	"generic_decline":                 pb.DeclineReason_DECLINE_REASON_GENERIC,
+	"card_declined":                   pb.DeclineReason_DECLINE_REASON_GENERIC,
+	"insufficient_funds":              pb.DeclineReason_DECLINE_REASON_INSUFFICIENT_FUNDS,
+	"expired_card":                    pb.DeclineReason_DECLINE_REASON_EXPIRED_CARD,
+	"incorrect_cvc":                   pb.DeclineReason_DECLINE_REASON_INCORRECT_CVC,
+	"invalid_cvc":                     pb.DeclineReason_DECLINE_REASON_INCORRECT_CVC,
+	"incorrect_number":                pb.DeclineReason_DECLINE_REASON_INCORRECT_NUMBER,
+	"invalid_number":                  pb.DeclineReason_DECLINE_REASON_INCORRECT_NUMBER,
+	"invalid_expiry_month":            pb.DeclineReason_DECLINE_REASON_INCORRECT_EXPIRY,
+	"invalid_expiry_year":             pb.DeclineReason_DECLINE_REASON_INCORRECT_EXPIRY,
+	"lost_card":                       pb.DeclineReason_DECLINE_REASON_LOST_OR_STOLEN,
+	"stolen_card":                     pb.DeclineReason_DECLINE_REASON_LOST_OR_STOLEN,
+	"pickup_card":                     pb.DeclineReason_DECLINE_REASON_LOST_OR_STOLEN,
+	"fraudulent":                      pb.DeclineReason_DECLINE_REASON_FRAUD_SUSPECTED,
+	"merchant_blacklist":              pb.DeclineReason_DECLINE_REASON_FRAUD_SUSPECTED,
+	"do_not_honor":                    pb.DeclineReason_DECLINE_REASON_DO_NOT_HONOR,
+	"card_velocity_exceeded":          pb.DeclineReason_DECLINE_REASON_LIMIT_EXCEEDED,
+	"withdrawal_count_limit_exceeded": pb.DeclineReason_DECLINE_REASON_LIMIT_EXCEEDED,
+	"card_not_supported":              pb.DeclineReason_DECLINE_REASON_CARD_NOT_SUPPORTED,
+	"transaction_not_allowed":         pb.DeclineReason_DECLINE_REASON_CARD_NOT_SUPPORTED,
+	"currency_not_supported":          pb.DeclineReason_DECLINE_REASON_CURRENCY_NOT_SUPPORTED,
+	"authentication_required":         pb.DeclineReason_DECLINE_REASON_AUTHENTICATION_REQUIRED,
+	"processing_error":                pb.DeclineReason_DECLINE_REASON_PROCESSING_ERROR,
+	"try_again_later":                 pb.DeclineReason_DECLINE_REASON_TRY_AGAIN_LATER,
+	"issuer_not_available":            pb.DeclineReason_DECLINE_REASON_TRY_AGAIN_LATER,
+	"invalid_amount":                  pb.DeclineReason_DECLINE_REASON_INVALID_AMOUNT,
+}
+
+// stripeError classifies an error returned by the Stripe client. Card errors
+// become DeclineErrors.
+func stripeError(err error) error {
+	e, ok := err.(*stripe.Error)
+	if !ok {
+		return networkError(err)
+	}
+
+	if e.Type == stripe.ErrorTypeCard {
+		reason, ok := stripeDeclineReasons[string(e.DeclineCode)]
+		if !ok {
+			reason = stripeDeclineReasons[string(e.Code)]
+		}
+
+		return NewDeclineError(NewDecline(reason, string(e.Code), string(e.DeclineCode)), err)
+	}
 
-	return &pi.ID, nil
+	return statusError(e.HTTPStatusCode, err)
 }
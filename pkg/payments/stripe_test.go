@@ -0,0 +1,39 @@
+package payments
+
+import (
+	pb "github.com/robertkohut/go-payments/proto"
+	"testing"
+)
+
+func TestStripeCustomerParams(t *testing.T) {
+	params := stripeCustomerParams(&pb.Customer{
+		Name:     "Jane Doe",
+		Email:    "jane@example.com",
+		Phone:    "+1 555 010 0000",
+		Address:  &pb.Address{Line1: "1 Main St", City: "Springfield", PostalCode: "12345", Country: "US"},
+		Metadata: map[string]string{"plan": "pro"},
+	})
+
+	if *params.Name != "Jane Doe" || *params.Email != "jane@example.com" || *params.Phone != "+1 555 010 0000" {
+		t.Errorf("Expected the contact details in their own fields, got %v, %v, %v", *params.Name, *params.Email, *params.Phone)
+	}
+
+	if params.Description != nil {
+		t.Errorf("Expected no description, got %q", *params.Description)
+	}
+
+	if a := params.Address; a == nil || *a.Line1 != "1 Main St" || *a.City != "Springfield" || *a.PostalCode != "12345" || *a.Country != "US" {
+		t.Errorf("Expected the billing address, got %v", a)
+	}
+
+	if params.Metadata["plan"] != "pro" {
+		t.Errorf("Expected the metadata, got %v", params.Metadata)
+	}
+
+	// Cleared fields are sent empty so the update clears them at Stripe too.
+	params = stripeCustomerParams(&pb.Customer{})
+
+	if params.Email == nil || *params.Email != "" || params.Address != nil {
+		t.Errorf("Expected an empty email and no address, got %v, %v", params.Email, params.Address)
+	}
+}
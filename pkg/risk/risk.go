@@ -0,0 +1,209 @@
+package risk
+
+import (
+	"fmt"
+	"github.com/robertkohut/go-payments/internal/config"
+	pb "github.com/robertkohut/go-payments/proto"
+	"strings"
+	"time"
+)
+
+// Input is a charge about to be sent to the gateway.
+type Input struct {
+	Customer *pb.Customer
+	Card     *pb.Card
+	Charge   *pb.Charge
+}
+
+// History answers questions about a customer's earlier charges.
+type History interface {
+	// SelectChargeVelocity returns the number of charges made since a time,
+	// and the amount of those in a currency that did not fail. A pmId of 0
+	// counts all cards of the customer.
+	SelectChargeVelocity(customerId, pmId, currencyId int64, since time.Time) (count, amount int64, err error)
+	// CountSucceededCardCharges returns the number of charges a card paid.
+	CountSucceededCardCharges(pmId int64) (int64, error)
+}
+
+// Engine runs every rule on a charge. The verdict is the strictest action of
+// the rules that matched: allow rules only record that they matched.
+type Engine interface {
+	Evaluate(in *Input) (*pb.RiskAssessment, error)
+}
+
+type rule struct {
+	config.RiskRuleConfig
+	action pb.RiskVerdict
+	match  func(r *rule, in *Input, h History) (bool, error)
+}
+
+type engine struct {
+	rules   []*rule
+	history History
+}
+
+var matchers = map[string]func(r *rule, in *Input, h History) (bool, error){
+	"max-amount": matchMaxAmount,
+	"velocity":   matchVelocity,
+	"new-card":   matchNewCard,
+	"bin":        matchBin,
+	"country":    matchCountry,
+	"account":    matchAccount,
+}
+
+var actions = map[string]pb.RiskVerdict{
+	"allow":  pb.RiskVerdict_RISK_VERDICT_ALLOW,
+	"review": pb.RiskVerdict_RISK_VERDICT_REVIEW,
+	"block":  pb.RiskVerdict_RISK_VERDICT_BLOCK,
+}
+
+func NewEngine(rules []config.RiskRuleConfig, history History) (Engine, error) {
+	e := &engine{history: history}
+
+	for i, cfg := range rules {
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("%s-%d", cfg.Type, i+1)
+		}
+
+		match, ok := matchers[cfg.Type]
+		if !ok {
+			return nil, fmt.Errorf("risk rule %s: unknown type %q", cfg.Name, cfg.Type)
+		}
+
+		action, ok := actions[cfg.Action]
+		if !ok {
+			return nil, fmt.Errorf("risk rule %s: unknown action %q", cfg.Name, cfg.Action)
+		}
+
+		if err := validate(&cfg); err != nil {
+			return nil, fmt.Errorf("risk rule %s: %v", cfg.Name, err)
+		}
+
+		e.rules = append(e.rules, &rule{RiskRuleConfig: cfg, action: action, match: match})
+	}
+
+	return e, nil
+}
+
+func validate(cfg *config.RiskRuleConfig) error {
+	switch cfg.Type {
+	case "max-amount", "new-card":
+		if cfg.MaxAmount <= 0 {
+			return fmt.Errorf("max-amount is required")
+		}
+	case "velocity":
+		if cfg.Window <= 0 {
+			return fmt.Errorf("window is required")
+		}
+		if cfg.MaxCount <= 0 && cfg.MaxAmount <= 0 {
+			return fmt.Errorf("max-count or max-amount is required")
+		}
+		if cfg.Scope != "customer" && cfg.Scope != "card" {
+			return fmt.Errorf("scope must be customer or card")
+		}
+	}
+
+	return nil
+}
+
+func (e *engine) Evaluate(in *Input) (*pb.RiskAssessment, error) {
+	assessment := &pb.RiskAssessment{Verdict: pb.RiskVerdict_RISK_VERDICT_ALLOW}
+
+	for _, r := range e.rules {
+		if r.SourceId != 0 && r.SourceId != in.Customer.GetSourceId() {
+			continue
+		}
+
+		if r.Currency != "" && !strings.EqualFold(r.Currency, in.Charge.GetCurrency()) {
+			continue
+		}
+
+		matched, err := r.match(r, in, e.history)
+		if err != nil {
+			return nil, err
+		}
+
+		if !matched {
+			continue
+		}
+
+		assessment.MatchedRules = append(assessment.MatchedRules, r.Name)
+		if r.action > assessment.Verdict {
+			assessment.Verdict = r.action
+		}
+	}
+
+	return assessment, nil
+}
+
+func matchMaxAmount(r *rule, in *Input, _ History) (bool, error) {
+	return in.Charge.GetAmount() > r.MaxAmount, nil
+}
+
+// matchVelocity counts the charge being made along with earlier ones.
+func matchVelocity(r *rule, in *Input, h History) (bool, error) {
+	var pmId int64
+	if r.Scope == "card" {
+		pmId = in.Card.GetId()
+	}
+
+	count, amount, err := h.SelectChargeVelocity(in.Customer.GetId(), pmId, in.Charge.GetCurrencyId(), time.Now().Add(-r.Window))
+	if err != nil {
+		return false, err
+	}
+
+	if r.MaxCount > 0 && count+1 > r.MaxCount {
+		return true, nil
+	}
+
+	return r.MaxAmount > 0 && amount+in.Charge.GetAmount() > r.MaxAmount, nil
+}
+
+// matchNewCard limits the amount of the first charge paid by a card.
+func matchNewCard(r *rule, in *Input, h History) (bool, error) {
+	if in.Charge.GetAmount() <= r.MaxAmount {
+		return false, nil
+	}
+
+	paid, err := h.CountSucceededCardCharges(in.Card.GetId())
+	if err != nil {
+		return false, err
+	}
+
+	return paid == 0, nil
+}
+
+func matchBin(r *rule, in *Input, _ History) (bool, error) {
+	bin := in.Card.GetBin()
+	if bin == "" {
+		return false, nil
+	}
+
+	for _, prefix := range r.Bins {
+		if strings.HasPrefix(bin, prefix) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func matchCountry(r *rule, in *Input, _ History) (bool, error) {
+	for _, country := range r.Countries {
+		if in.Card.GetCountry() != "" && strings.EqualFold(country, in.Card.GetCountry()) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func matchAccount(r *rule, in *Input, _ History) (bool, error) {
+	for _, accountId := range r.Accounts {
+		if accountId == in.Charge.GetAccountId() {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
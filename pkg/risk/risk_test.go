@@ -0,0 +1,127 @@
+package risk
+
+import (
+	"github.com/robertkohut/go-payments/internal/config"
+	pb "github.com/robertkohut/go-payments/proto"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeHistory struct {
+	count, amount int64
+	paid          int64
+	pmId          int64
+}
+
+func (h *fakeHistory) SelectChargeVelocity(customerId, pmId, currencyId int64, since time.Time) (int64, int64, error) {
+	h.pmId = pmId
+	return h.count, h.amount, nil
+}
+
+func (h *fakeHistory) CountSucceededCardCharges(pmId int64) (int64, error) {
+	return h.paid, nil
+}
+
+func newInput(amount int64) *Input {
+	return &Input{
+		Customer: &pb.Customer{Id: 1, SourceId: 1, AccountId: 10},
+		Card:     &pb.Card{Id: 5, Bin: "424242", Country: "US"},
+		Charge:   &pb.Charge{Amount: amount, Currency: "USD", AccountId: 10},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	h := &fakeHistory{count: 5, amount: 40000, paid: 0}
+
+	e, err := NewEngine([]config.RiskRuleConfig{
+		{Name: "large", Type: "max-amount", Action: "review", MaxAmount: 50000},
+		{Name: "huge", Type: "max-amount", Action: "block", MaxAmount: 500000},
+		{Name: "eur-only", Type: "max-amount", Action: "block", Currency: "EUR", MaxAmount: 1},
+		{Name: "card-velocity", Type: "velocity", Action: "review", Scope: "card", MaxCount: 5, Window: time.Hour},
+		{Name: "customer-spend", Type: "velocity", Action: "block", Scope: "customer", MaxAmount: 100000, Window: 24 * time.Hour},
+		{Name: "new-card", Type: "new-card", Action: "review", MaxAmount: 20000},
+		{Name: "bins", Type: "bin", Action: "block", Bins: []string{"4000"}},
+		{Name: "countries", Type: "country", Action: "allow", Countries: []string{"us"}},
+		{Name: "accounts", Type: "account", Action: "block", Accounts: []int64{99}},
+	}, h)
+	if err != nil {
+		t.Fatalf("Could not build engine: %v", err)
+	}
+
+	tests := []struct {
+		amount  int64
+		verdict pb.RiskVerdict
+		rules   []string
+	}{
+		{1000, pb.RiskVerdict_RISK_VERDICT_REVIEW, []string{"card-velocity", "countries"}},
+		{30000, pb.RiskVerdict_RISK_VERDICT_REVIEW, []string{"card-velocity", "new-card", "countries"}},
+		{70000, pb.RiskVerdict_RISK_VERDICT_BLOCK, []string{"large", "card-velocity", "customer-spend", "new-card", "countries"}},
+	}
+
+	for _, tt := range tests {
+		a, err := e.Evaluate(newInput(tt.amount))
+		if err != nil {
+			t.Fatalf("Could not evaluate: %v", err)
+		}
+
+		if a.Verdict != tt.verdict || !reflect.DeepEqual(a.MatchedRules, tt.rules) {
+			t.Errorf("Amount %d: expected %s %v, got %s %v", tt.amount, tt.verdict, tt.rules, a.Verdict, a.MatchedRules)
+		}
+	}
+
+	// The card has been paid with before, so it is no longer new.
+	h.paid = 1
+	h.count = 0
+
+	a, _ := e.Evaluate(newInput(30000))
+	if a.Verdict != pb.RiskVerdict_RISK_VERDICT_ALLOW {
+		t.Errorf("Expected a known card to be allowed, got %s %v", a.Verdict, a.MatchedRules)
+	}
+
+	in := newInput(100)
+	in.Charge.AccountId = 99
+	in.Card.Bin = "40001234"
+
+	a, _ = e.Evaluate(in)
+	if a.Verdict != pb.RiskVerdict_RISK_VERDICT_BLOCK || !reflect.DeepEqual(a.MatchedRules, []string{"bins", "countries", "accounts"}) {
+		t.Errorf("Expected the bin and account to be blocked, got %s %v", a.Verdict, a.MatchedRules)
+	}
+}
+
+func TestVelocityScope(t *testing.T) {
+	h := &fakeHistory{}
+
+	for _, scope := range []string{"customer", "card"} {
+		e, err := NewEngine([]config.RiskRuleConfig{
+			{Type: "velocity", Action: "review", Scope: scope, MaxCount: 1, Window: time.Hour},
+		}, h)
+		if err != nil {
+			t.Fatalf("Could not build engine: %v", err)
+		}
+
+		if _, err := e.Evaluate(newInput(100)); err != nil {
+			t.Fatalf("Could not evaluate: %v", err)
+		}
+
+		if want := map[string]int64{"customer": 0, "card": 5}[scope]; h.pmId != want {
+			t.Errorf("Scope %s: expected pm id %d, got %d", scope, want, h.pmId)
+		}
+	}
+}
+
+func TestNewEngineErrors(t *testing.T) {
+	rules := []config.RiskRuleConfig{
+		{Type: "unknown", Action: "block"},
+		{Type: "max-amount", Action: "maybe", MaxAmount: 1},
+		{Type: "max-amount", Action: "block"},
+		{Type: "velocity", Action: "block", Scope: "card", MaxCount: 1},
+		{Type: "velocity", Action: "block", Scope: "org", MaxCount: 1, Window: time.Hour},
+	}
+
+	for _, r := range rules {
+		if _, err := NewEngine([]config.RiskRuleConfig{r}, &fakeHistory{}); err == nil {
+			t.Errorf("Expected an error for %+v", r)
+		}
+	}
+}
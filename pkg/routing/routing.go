@@ -0,0 +1,136 @@
+package routing
+
+import (
+	"fmt"
+	"github.com/robertkohut/go-payments/internal/config"
+	"github.com/robertkohut/go-payments/pkg/payments"
+	"hash/fnv"
+	"strings"
+)
+
+// Request describes a new customer or a charge to route. Customers only carry
+// a source, so rules on currency, brand or amount never match them.
+type Request struct {
+	SourceId int64
+	Currency string
+	Brand    string
+	Amount   int64
+	// Key places the request in a percentage split. The same key always
+	// lands on the same side.
+	Key string
+}
+
+// Decision is the gateway a request was routed to.
+type Decision struct {
+	Rule      string
+	GatewayId int64
+	// FailoverId is the gateway to retry a charge on if GatewayId is
+	// unavailable, or 0.
+	FailoverId int64
+}
+
+// Engine picks a gateway by the first configured rule a request matches.
+type Engine interface {
+	// Route returns nil if no rule matches.
+	Route(req *Request) *Decision
+}
+
+type rule struct {
+	config.RoutingRuleConfig
+	gatewayId  int64
+	failoverId int64
+}
+
+type engine struct {
+	rules []rule
+}
+
+func NewEngine(rules []config.RoutingRuleConfig) (Engine, error) {
+	e := &engine{}
+
+	for i, cfg := range rules {
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+
+		if cfg.Percent < 0 || cfg.Percent > 100 {
+			return nil, fmt.Errorf("routing rule %s: percent must be between 0 and 100", cfg.Name)
+		}
+
+		g, ok := payments.LookupGateway(cfg.Gateway)
+		if !ok {
+			return nil, fmt.Errorf("routing rule %s: unknown gateway %q", cfg.Name, cfg.Gateway)
+		}
+
+		r := rule{RoutingRuleConfig: cfg, gatewayId: g.Id}
+
+		if cfg.Failover != "" {
+			f, ok := payments.LookupGateway(cfg.Failover)
+			if !ok {
+				return nil, fmt.Errorf("routing rule %s: unknown failover gateway %q", cfg.Name, cfg.Failover)
+			}
+			r.failoverId = f.Id
+		}
+
+		e.rules = append(e.rules, r)
+	}
+
+	return e, nil
+}
+
+func (e *engine) Route(req *Request) *Decision {
+	for _, r := range e.rules {
+		if r.matches(req) {
+			return &Decision{
+				Rule:       r.Name,
+				GatewayId:  r.gatewayId,
+				FailoverId: r.failoverId,
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *rule) matches(req *Request) bool {
+	if r.SourceId != 0 && r.SourceId != req.SourceId {
+		return false
+	}
+
+	if r.Currency != "" && !strings.EqualFold(r.Currency, req.Currency) {
+		return false
+	}
+
+	if r.Brand != "" && r.Brand != req.Brand {
+		return false
+	}
+
+	if (r.MinAmount != 0 || r.MaxAmount != 0) && req.Amount == 0 {
+		return false
+	}
+
+	if r.MinAmount != 0 && req.Amount < r.MinAmount {
+		return false
+	}
+
+	if r.MaxAmount != 0 && req.Amount > r.MaxAmount {
+		return false
+	}
+
+	if r.Percent != 0 && bucket(r.Name, req.Key) >= r.Percent {
+		return false
+	}
+
+	return true
+}
+
+// bucket places a key in one of 100 buckets. The rule name is hashed in so
+// that splits of different rules are independent.
+func bucket(name, key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(key))
+
+	return int(h.Sum32() % 100)
+}
@@ -0,0 +1,94 @@
+package routing
+
+import (
+	"fmt"
+	"github.com/robertkohut/go-payments/internal/config"
+	"github.com/robertkohut/go-payments/pkg/payments"
+	"testing"
+)
+
+func TestRoute(t *testing.T) {
+	e, err := NewEngine([]config.RoutingRuleConfig{
+		{Name: "eur", Currency: "eur", Gateway: "braintree", Failover: "stripe"},
+		{Name: "large-visa", Brand: "visa", MinAmount: 100000, Gateway: "braintree"},
+		{Name: "source-3", SourceId: 3, Gateway: "braintree"},
+	})
+	if err != nil {
+		t.Fatalf("Could not build engine: %v", err)
+	}
+
+	tests := []struct {
+		req      Request
+		rule     string
+		failover int64
+	}{
+		{Request{SourceId: 1, Currency: "EUR", Amount: 500}, "eur", payments.GatewayStripe},
+		{Request{SourceId: 1, Currency: "USD", Brand: "visa", Amount: 150000}, "large-visa", 0},
+		{Request{SourceId: 1, Currency: "USD", Brand: "visa", Amount: 500}, "", 0},
+		{Request{SourceId: 1, Currency: "USD", Brand: "amex", Amount: 150000}, "", 0},
+		{Request{SourceId: 3}, "source-3", 0},
+		// New customers carry no amount, so amount bands never match them.
+		{Request{SourceId: 1}, "", 0},
+	}
+
+	for _, tt := range tests {
+		d := e.Route(&tt.req)
+
+		if tt.rule == "" {
+			if d != nil {
+				t.Errorf("%+v: expected no rule, got %s", tt.req, d.Rule)
+			}
+			continue
+		}
+
+		if d == nil || d.Rule != tt.rule {
+			t.Errorf("%+v: expected rule %s, got %+v", tt.req, tt.rule, d)
+			continue
+		}
+
+		if d.GatewayId != payments.GatewayBraintree || d.FailoverId != tt.failover {
+			t.Errorf("%+v: unexpected decision %+v", tt.req, d)
+		}
+	}
+}
+
+func TestRoutePercent(t *testing.T) {
+	e, err := NewEngine([]config.RoutingRuleConfig{
+		{Name: "canary", Percent: 20, Gateway: "braintree"},
+	})
+	if err != nil {
+		t.Fatalf("Could not build engine: %v", err)
+	}
+
+	routed := 0
+	for i := 0; i < 1000; i++ {
+		req := &Request{SourceId: 1, Key: fmt.Sprintf("key-%d", i)}
+
+		d := e.Route(req)
+		if d != nil {
+			routed++
+		}
+
+		if again := e.Route(req); (again != nil) != (d != nil) {
+			t.Fatalf("Key %s was routed inconsistently", req.Key)
+		}
+	}
+
+	if routed < 150 || routed > 250 {
+		t.Errorf("Expected about 200 of 1000 requests to be routed, got %d", routed)
+	}
+}
+
+func TestNewEngineErrors(t *testing.T) {
+	rules := [][]config.RoutingRuleConfig{
+		{{Gateway: "unknown"}},
+		{{Gateway: "stripe", Failover: "unknown"}},
+		{{Gateway: "stripe", Percent: 101}},
+	}
+
+	for _, r := range rules {
+		if _, err := NewEngine(r); err == nil {
+			t.Errorf("Expected an error for %+v", r)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package webhooks
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/robertkohut/go-payments/internal/services/hashid"
+	"github.com/robertkohut/go-payments/pkg/metadata"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"strings"
+	"time"
+)
+
+const statusPrefix = "WEBHOOK_DELIVERY_STATUS_"
+
+// PendingDelivery is a delivery along with what is needed to send it.
+type PendingDelivery struct {
+	Delivery *pb.WebhookDelivery
+	URL      string
+	Secret   string
+	Payload  []byte
+}
+
+type Repository interface {
+	InsertEndpoint(endpoint *pb.WebhookEndpoint) (int64, error)
+	SelectEndpoints(sourceId int64, livemode bool) ([]*pb.WebhookEndpoint, error)
+	SelectEndpoint(sourceId, endpointId int64, livemode bool) (*pb.WebhookEndpoint, error)
+	DeleteEndpoint(endpoint *pb.WebhookEndpoint) error
+
+	InsertDeliveries(event *pb.Event, payload []byte, endpoints []*pb.WebhookEndpoint) error
+	SelectDeliveries(sourceId, endpointId int64, livemode bool, st pb.WebhookDeliveryStatus, limit, offset int64) ([]*pb.WebhookDelivery, error)
+	SelectDelivery(sourceId, deliveryId int64, livemode bool) (*PendingDelivery, error)
+	SelectDueDeliveries(now time.Time, limit int) ([]*PendingDelivery, error)
+	UpdateDelivery(delivery *pb.WebhookDelivery) error
+}
+
+type repository struct {
+	db *sqlx.DB
+	hd *hashid.Service
+}
+
+func NewRepository(db *sqlx.DB, hd *hashid.Service) Repository {
+	return &repository{db: db, hd: hd}
+}
+
+func (r *repository) InsertEndpoint(endpoint *pb.WebhookEndpoint) (int64, error) {
+	stmt := `INSERT INTO webhook_endpoints (source_id, livemode, url, secret, event_types, flags) VALUES (?, ?, ?, ?, ?, ?)`
+
+	endpoint.Flags = endpoint.Flags | metadata.FlagsWebhookEndpointActive
+
+	result, err := r.db.Exec(
+		stmt,
+		endpoint.SourceId,
+		endpoint.Livemode,
+		endpoint.Url,
+		endpoint.Secret,
+		strings.Join(endpoint.EventTypes, ","),
+		endpoint.Flags,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	endpoint.Id, err = result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	endpoint.IdStr, err = r.hd.Encode([]int64{endpoint.Id, metadata.HDWebhookEndpointId})
+	endpoint.CreatedAt = timestamppb.Now()
+
+	return endpoint.Id, err
+}
+
+func (r *repository) SelectEndpoints(sourceId int64, livemode bool) ([]*pb.WebhookEndpoint, error) {
+	var endpoints []*pb.WebhookEndpoint
+
+	stmt := selectEndpointsStmt + `
+			 WHERE source_id = ?
+			   AND livemode = ?
+			   AND (flags & ?) = ?`
+
+	rows, err := r.db.Query(stmt, sourceId, livemode, metadata.FlagsWebhookEndpointActive, metadata.FlagsWebhookEndpointActive)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		endpoint, err := r.scanEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, rows.Err()
+}
+
+func (r *repository) SelectEndpoint(sourceId, endpointId int64, livemode bool) (*pb.WebhookEndpoint, error) {
+	stmt := selectEndpointsStmt + `
+			 WHERE id = ?
+			   AND source_id = ?
+			   AND livemode = ?
+			   AND (flags & ?) = ?`
+
+	row := r.db.QueryRow(stmt, endpointId, sourceId, livemode, metadata.FlagsWebhookEndpointActive, metadata.FlagsWebhookEndpointActive)
+
+	endpoint, err := r.scanEndpoint(row)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, status.Error(codes.NotFound, "webhook endpoint not found")
+	case nil:
+		return endpoint, nil
+	default:
+		return nil, err
+	}
+}
+
+// selectEndpointsStmt lists the columns read by scanEndpoint.
+const selectEndpointsStmt = `SELECT id, source_id, livemode, url, event_types, flags, created_at FROM webhook_endpoints`
+
+func (r *repository) scanEndpoint(row interface{ Scan(...interface{}) error }) (*pb.WebhookEndpoint, error) {
+	endpoint := &pb.WebhookEndpoint{}
+
+	var eventTypes string
+	var createdAt time.Time
+
+	err := row.Scan(
+		&endpoint.Id,
+		&endpoint.SourceId,
+		&endpoint.Livemode,
+		&endpoint.Url,
+		&eventTypes,
+		&endpoint.Flags,
+		&createdAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if eventTypes != "" {
+		endpoint.EventTypes = strings.Split(eventTypes, ",")
+	}
+
+	endpoint.CreatedAt = timestamppb.New(createdAt)
+	endpoint.IdStr, err = r.hd.Encode([]int64{endpoint.Id, metadata.HDWebhookEndpointId})
+
+	return endpoint, err
+}
+
+func (r *repository) DeleteEndpoint(endpoint *pb.WebhookEndpoint) error {
+	stmt := `UPDATE webhook_endpoints SET flags = flags &~ ?
+				 WHERE id = ?
+				   AND source_id = ?`
+
+	_, err := r.db.Exec(stmt, metadata.FlagsWebhookEndpointActive, endpoint.Id, endpoint.SourceId)
+
+	return err
+}
+
+// InsertDeliveries queues the event for each endpoint. An event is queued at
+// most once per endpoint, so relaying it again is harmless.
+func (r *repository) InsertDeliveries(event *pb.Event, payload []byte, endpoints []*pb.WebhookEndpoint) error {
+	stmt := `INSERT IGNORE INTO webhook_deliveries (endpoint_id, event_id, event_type, livemode, payload, status, next_attempt_at)
+			 VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for _, endpoint := range endpoints {
+		_, err := tx.Exec(
+			stmt,
+			endpoint.Id,
+			event.Id,
+			event.Type,
+			event.Livemode,
+			payload,
+			statusName(pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_PENDING),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// EraseCustomerData blanks the payload of every delivery of an event about a
+// customer within tx.
+func EraseCustomerData(tx *sqlx.Tx, customerId int64) error {
+	stmt := `UPDATE webhook_deliveries d
+			 INNER JOIN events e ON e.id = d.event_id
+			 SET d.payload = '{}'
+			 WHERE e.customer_id = ?`
+
+	_, err := tx.Exec(stmt, customerId)
+
+	return err
+}
+
+const selectDeliveriesStmt = `SELECT d.id,
+                    d.endpoint_id,
+                    d.event_id,
+                    d.event_type,
+                    d.livemode,
+                    d.status,
+                    d.attempts,
+                    d.last_status_code,
+                    d.last_error,
+                    d.next_attempt_at,
+                    d.created_at,
+                    d.updated_at,
+                    e.url,
+                    e.secret,
+                    d.payload
+            FROM webhook_deliveries d
+            INNER JOIN webhook_endpoints e ON e.id = d.endpoint_id`
+
+func (r *repository) SelectDeliveries(sourceId, endpointId int64, livemode bool, st pb.WebhookDeliveryStatus, limit, offset int64) ([]*pb.WebhookDelivery, error) {
+	var deliveries []*pb.WebhookDelivery
+
+	stmt := selectDeliveriesStmt + ` WHERE e.source_id = ? AND d.livemode = ?`
+	args := []interface{}{sourceId, livemode}
+
+	if endpointId != 0 {
+		stmt += ` AND d.endpoint_id = ?`
+		args = append(args, endpointId)
+	}
+
+	if st != pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_UNSPECIFIED {
+		stmt += ` AND d.status = ?`
+		args = append(args, statusName(st))
+	}
+
+	stmt += ` ORDER BY d.id DESC`
+
+	if limit > 0 {
+		stmt += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, offset)
+	}
+
+	pending, err := r.queryDeliveries(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range pending {
+		deliveries = append(deliveries, p.Delivery)
+	}
+
+	return deliveries, nil
+}
+
+func (r *repository) SelectDelivery(sourceId, deliveryId int64, livemode bool) (*PendingDelivery, error) {
+	stmt := selectDeliveriesStmt + ` WHERE d.id = ? AND e.source_id = ? AND d.livemode = ?`
+
+	pending, err := r.queryDeliveries(stmt, deliveryId, sourceId, livemode)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pending) == 0 {
+		return nil, status.Error(codes.NotFound, "webhook delivery not found")
+	}
+
+	return pending[0], nil
+}
+
+func (r *repository) SelectDueDeliveries(now time.Time, limit int) ([]*PendingDelivery, error) {
+	stmt := selectDeliveriesStmt + ` WHERE d.status IN (?, ?)
+              AND d.next_attempt_at <= ?
+              AND (e.flags & ?) = ?
+            ORDER BY d.next_attempt_at ASC
+            LIMIT ?`
+
+	return r.queryDeliveries(
+		stmt,
+		statusName(pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_PENDING),
+		statusName(pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_RETRYING),
+		now,
+		metadata.FlagsWebhookEndpointActive,
+		metadata.FlagsWebhookEndpointActive,
+		limit,
+	)
+}
+
+func (r *repository) queryDeliveries(stmt string, args ...interface{}) ([]*PendingDelivery, error) {
+	var deliveries []*PendingDelivery
+
+	rows, err := r.db.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		d := &pb.WebhookDelivery{}
+		p := &PendingDelivery{Delivery: d}
+
+		var endpointId, eventId int64
+		var deliveryStatus string
+		var nextAttemptAt, createdAt, updatedAt time.Time
+
+		err := rows.Scan(
+			&d.Id,
+			&endpointId,
+			&eventId,
+			&d.EventType,
+			&d.Livemode,
+			&deliveryStatus,
+			&d.Attempts,
+			&d.LastStatusCode,
+			&d.LastError,
+			&nextAttemptAt,
+			&createdAt,
+			&updatedAt,
+			&p.URL,
+			&p.Secret,
+			&p.Payload,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		d.Status, err = parseStatus(deliveryStatus)
+		if err != nil {
+			return nil, err
+		}
+
+		d.NextAttemptAt = timestamppb.New(nextAttemptAt)
+		d.CreatedAt = timestamppb.New(createdAt)
+		d.UpdatedAt = timestamppb.New(updatedAt)
+
+		d.IdStr, _ = r.hd.Encode([]int64{d.Id, metadata.HDWebhookDeliveryId})
+		d.EndpointId, _ = r.hd.Encode([]int64{endpointId, metadata.HDWebhookEndpointId})
+		d.EventId, _ = r.hd.Encode([]int64{eventId, metadata.HDEventId})
+
+		deliveries = append(deliveries, p)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (r *repository) UpdateDelivery(delivery *pb.WebhookDelivery) error {
+	stmt := `UPDATE webhook_deliveries
+			 SET status = ?,
+			     attempts = ?,
+			     last_status_code = ?,
+			     last_error = ?,
+			     next_attempt_at = ?,
+			     updated_at = CURRENT_TIMESTAMP
+			 WHERE id = ?`
+
+	_, err := r.db.Exec(
+		stmt,
+		statusName(delivery.Status),
+		delivery.Attempts,
+		delivery.LastStatusCode,
+		delivery.LastError,
+		delivery.NextAttemptAt.AsTime(),
+		delivery.Id,
+	)
+
+	return err
+}
+
+func statusName(st pb.WebhookDeliveryStatus) string {
+	return strings.ToLower(strings.TrimPrefix(st.String(), statusPrefix))
+}
+
+func parseStatus(name string) (pb.WebhookDeliveryStatus, error) {
+	st, ok := pb.WebhookDeliveryStatus_value[statusPrefix+strings.ToUpper(name)]
+	if !ok {
+		return pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_UNSPECIFIED, fmt.Errorf("unknown webhook delivery status %q", name)
+	}
+
+	return pb.WebhookDeliveryStatus(st), nil
+}
@@ -0,0 +1,277 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/robertkohut/go-payments/internal/config"
+	"github.com/robertkohut/go-payments/internal/services/hashid"
+	"github.com/robertkohut/go-payments/pkg/events"
+	"github.com/robertkohut/go-payments/pkg/metadata"
+	pb "github.com/robertkohut/go-payments/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const dueBatchSize = 100
+
+type Service interface {
+	// Endpoints receive the events of the mode they were created in, and
+	// deliveries are only visible in their event's mode.
+	CreateEndpoint(sourceId int64, livemode bool, endpointUrl string, eventTypes []string) (*pb.WebhookEndpoint, error)
+	ListEndpoints(sourceId int64, livemode bool) ([]*pb.WebhookEndpoint, error)
+	DeleteEndpoint(sourceId int64, livemode bool, endpointId string) error
+
+	ListDeliveries(req *pb.ListWebhookDeliveriesRequest, livemode bool) ([]*pb.WebhookDelivery, error)
+	Redeliver(sourceId int64, livemode bool, deliveryId string) (*pb.WebhookDelivery, error)
+
+	// Publish queues an outbox event for every endpoint of its source and
+	// mode subscribed to it. It satisfies events.Sink.
+	Publish(event *pb.Event) error
+	// DeliverDue sends queued deliveries whose next attempt is due.
+	DeliverDue() (int, error)
+}
+
+type service struct {
+	repo   Repository
+	hd     *hashid.Service
+	cfg    *config.WebhooksConfig
+	client *http.Client
+}
+
+func NewService(repo Repository, hd *hashid.Service, cfg *config.WebhooksConfig) Service {
+	return &service{
+		repo:   repo,
+		hd:     hd,
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (s *service) CreateEndpoint(sourceId int64, livemode bool, endpointUrl string, eventTypes []string) (*pb.WebhookEndpoint, error) {
+	u, err := url.Parse(endpointUrl)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid webhook url")
+	}
+
+	if len(eventTypes) == 0 {
+		eventTypes = []string{"*"}
+	}
+
+	for _, t := range eventTypes {
+		if t != "*" && !events.IsType(t) {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown event type %q", t)
+		}
+	}
+
+	endpoint := &pb.WebhookEndpoint{
+		SourceId:   sourceId,
+		Livemode:   livemode,
+		Url:        endpointUrl,
+		Secret:     newSecret(),
+		EventTypes: eventTypes,
+	}
+
+	_, err = s.repo.InsertEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoint, nil
+}
+
+func (s *service) ListEndpoints(sourceId int64, livemode bool) ([]*pb.WebhookEndpoint, error) {
+	return s.repo.SelectEndpoints(sourceId, livemode)
+}
+
+func (s *service) DeleteEndpoint(sourceId int64, livemode bool, endpointId string) error {
+	id, err := s.hd.DecodeId(endpointId, metadata.HDWebhookEndpointId)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid endpoint id")
+	}
+
+	endpoint, err := s.repo.SelectEndpoint(sourceId, id, livemode)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.DeleteEndpoint(endpoint)
+}
+
+func (s *service) ListDeliveries(req *pb.ListWebhookDeliveriesRequest, livemode bool) ([]*pb.WebhookDelivery, error) {
+	var endpointId int64
+
+	if req.GetEndpointId() != "" {
+		var err error
+		endpointId, err = s.hd.DecodeId(req.GetEndpointId(), metadata.HDWebhookEndpointId)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid endpoint id")
+		}
+	}
+
+	return s.repo.SelectDeliveries(req.GetSourceId(), endpointId, livemode, req.GetStatus(), req.GetLimit(), req.GetOffset())
+}
+
+// Redeliver sends a delivery again right away, whatever its current status.
+func (s *service) Redeliver(sourceId int64, livemode bool, deliveryId string) (*pb.WebhookDelivery, error) {
+	id, err := s.hd.DecodeId(deliveryId, metadata.HDWebhookDeliveryId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid delivery id")
+	}
+
+	pending, err := s.repo.SelectDelivery(sourceId, id, livemode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.attempt(pending)
+	if err != nil {
+		return nil, err
+	}
+
+	return pending.Delivery, nil
+}
+
+func (s *service) Publish(event *pb.Event) error {
+	endpoints, err := s.repo.SelectEndpoints(event.SourceId, event.Livemode)
+	if err != nil {
+		return err
+	}
+
+	var subscribed []*pb.WebhookEndpoint
+	for _, endpoint := range endpoints {
+		if subscribes(endpoint, event.Type) {
+			subscribed = append(subscribed, endpoint)
+		}
+	}
+
+	if len(subscribed) == 0 {
+		return nil
+	}
+
+	payload, err := protojson.Marshal(metadata.HideInternalIds(event))
+	if err != nil {
+		return err
+	}
+
+	return s.repo.InsertDeliveries(event, payload, subscribed)
+}
+
+func (s *service) DeliverDue() (int, error) {
+	due, err := s.repo.SelectDueDeliveries(time.Now(), dueBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+
+	for _, pending := range due {
+		if err := s.attempt(pending); err != nil {
+			return delivered, err
+		}
+
+		if pending.Delivery.Status == pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_SUCCEEDED {
+			delivered++
+		}
+	}
+
+	return delivered, nil
+}
+
+// attempt POSTs a delivery once and records the outcome. A failed delivery
+// is retried with exponential backoff until it has used up its attempts,
+// after which it is dead-lettered.
+func (s *service) attempt(pending *PendingDelivery) error {
+	d := pending.Delivery
+	now := time.Now()
+
+	code, err := s.post(pending, now)
+
+	d.Attempts++
+	d.LastStatusCode = int32(code)
+	d.NextAttemptAt = timestamppb.New(now)
+
+	switch {
+	case err == nil:
+		d.Status = pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_SUCCEEDED
+		d.LastError = ""
+	case int(d.Attempts) >= s.cfg.MaxAttempts:
+		d.Status = pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_DEAD
+		d.LastError = err.Error()
+		log.Println("Webhook delivery dead-lettered", d.IdStr, err)
+	default:
+		d.Status = pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_RETRYING
+		d.LastError = err.Error()
+		d.NextAttemptAt = timestamppb.New(now.Add(s.backoff(int(d.Attempts))))
+	}
+
+	d.UpdatedAt = timestamppb.New(now)
+
+	return s.repo.UpdateDelivery(d)
+}
+
+func (s *service) post(pending *PendingDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, pending.URL, bytes.NewReader(pending.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventTypeHeader, pending.Delivery.EventType)
+	req.Header.Set(SignatureHeader, Sign(pending.Secret, now.Unix(), pending.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// backoff doubles the base delay for every failed attempt, capped at the
+// configured maximum, with up to half of it randomised.
+func (s *service) backoff(attempts int) time.Duration {
+	d := s.cfg.BackoffBase
+	for i := 1; i < attempts && d < s.cfg.BackoffMax; i++ {
+		d *= 2
+	}
+
+	if d > s.cfg.BackoffMax {
+		d = s.cfg.BackoffMax
+	}
+
+	return d/2 + time.Duration(mathrand.Int63n(int64(d/2)+1))
+}
+
+func subscribes(endpoint *pb.WebhookEndpoint, eventType string) bool {
+	for _, t := range endpoint.EventTypes {
+		if t == "*" || t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newSecret() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+
+	return "whsec_" + hex.EncodeToString(b)
+}
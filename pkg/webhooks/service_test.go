@@ -0,0 +1,192 @@
+package webhooks
+
+import (
+	"github.com/robertkohut/go-payments/internal/config"
+	pb "github.com/robertkohut/go-payments/proto"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memoryRepository struct {
+	Repository
+	endpoints  []*pb.WebhookEndpoint
+	deliveries []*PendingDelivery
+}
+
+func (r *memoryRepository) SelectEndpoints(sourceId int64, livemode bool) ([]*pb.WebhookEndpoint, error) {
+	var endpoints []*pb.WebhookEndpoint
+	for _, e := range r.endpoints {
+		if e.SourceId == sourceId && e.Livemode == livemode {
+			endpoints = append(endpoints, e)
+		}
+	}
+	return endpoints, nil
+}
+
+func (r *memoryRepository) InsertDeliveries(event *pb.Event, payload []byte, endpoints []*pb.WebhookEndpoint) error {
+	for _, e := range endpoints {
+		r.deliveries = append(r.deliveries, &PendingDelivery{
+			Delivery: &pb.WebhookDelivery{
+				Id:        int64(len(r.deliveries) + 1),
+				EventType: event.Type,
+				Livemode:  event.Livemode,
+				Status:    pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_PENDING,
+			},
+			URL:     e.Url,
+			Secret:  e.Secret,
+			Payload: payload,
+		})
+	}
+	return nil
+}
+
+func (r *memoryRepository) SelectDueDeliveries(now time.Time, limit int) ([]*PendingDelivery, error) {
+	var due []*PendingDelivery
+	for _, p := range r.deliveries {
+		d := p.Delivery
+		if (d.Status == pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_PENDING ||
+			d.Status == pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_RETRYING) &&
+			(d.NextAttemptAt == nil || !d.NextAttemptAt.AsTime().After(now)) {
+			due = append(due, p)
+		}
+	}
+	return due, nil
+}
+
+func (r *memoryRepository) UpdateDelivery(delivery *pb.WebhookDelivery) error {
+	return nil
+}
+
+func newTestService(repo Repository) *service {
+	return NewService(repo, nil, &config.WebhooksConfig{
+		Timeout:     time.Second,
+		MaxAttempts: 3,
+		BackoffBase: time.Millisecond,
+		BackoffMax:  time.Millisecond,
+	}).(*service)
+}
+
+func TestDeliverSignedWebhook(t *testing.T) {
+	const secret = "whsec_test"
+
+	var received int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := Verify(secret, r.Header.Get(SignatureHeader), body, time.Minute); err != nil {
+			t.Errorf("Could not verify signature: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get(EventTypeHeader) != "charge.succeeded" {
+			t.Errorf("unexpected event type %q", r.Header.Get(EventTypeHeader))
+		}
+		received++
+	}))
+	defer receiver.Close()
+
+	repo := &memoryRepository{
+		endpoints: []*pb.WebhookEndpoint{
+			{Id: 1, SourceId: 1, Url: receiver.URL, Secret: secret, EventTypes: []string{"charge.succeeded"}},
+			{Id: 2, SourceId: 1, Url: receiver.URL, Secret: secret, EventTypes: []string{"card.added"}},
+			{Id: 3, SourceId: 2, Url: receiver.URL, Secret: secret, EventTypes: []string{"*"}},
+		},
+	}
+	svc := newTestService(repo)
+
+	err := svc.Publish(&pb.Event{Id: 1, Type: "charge.succeeded", SourceId: 1})
+	if err != nil {
+		t.Fatalf("Could not publish event: %v", err)
+	}
+
+	if len(repo.deliveries) != 1 {
+		t.Fatalf("expected 1 queued delivery, got %d", len(repo.deliveries))
+	}
+
+	n, err := svc.DeliverDue()
+	if err != nil {
+		t.Fatalf("Could not deliver webhooks: %v", err)
+	}
+
+	if n != 1 || received != 1 {
+		t.Fatalf("expected 1 delivery, got %d (received %d)", n, received)
+	}
+
+	d := repo.deliveries[0].Delivery
+	if d.Status != pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_SUCCEEDED || d.LastStatusCode != http.StatusOK {
+		t.Fatalf("unexpected delivery state: %v", d)
+	}
+}
+
+func TestFailedWebhookIsDeadLettered(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	repo := &memoryRepository{
+		endpoints: []*pb.WebhookEndpoint{
+			{Id: 1, SourceId: 1, Url: receiver.URL, Secret: "whsec_test", EventTypes: []string{"*"}},
+		},
+	}
+	svc := newTestService(repo)
+
+	if err := svc.Publish(&pb.Event{Id: 1, Type: "charge.failed", SourceId: 1}); err != nil {
+		t.Fatalf("Could not publish event: %v", err)
+	}
+
+	d := repo.deliveries[0].Delivery
+
+	for i := 1; i <= 3; i++ {
+		time.Sleep(2 * time.Millisecond)
+
+		if _, err := svc.DeliverDue(); err != nil {
+			t.Fatalf("Could not deliver webhooks: %v", err)
+		}
+
+		if int(d.Attempts) != i {
+			t.Fatalf("expected %d attempts, got %d", i, d.Attempts)
+		}
+	}
+
+	if d.Status != pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_DEAD {
+		t.Fatalf("expected delivery to be dead-lettered, got %s", d.Status)
+	}
+
+	if d.LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("unexpected last status code %d", d.LastStatusCode)
+	}
+}
+
+func TestWebhooksAreSeparatedByMode(t *testing.T) {
+	repo := &memoryRepository{
+		endpoints: []*pb.WebhookEndpoint{
+			{Id: 1, SourceId: 1, Livemode: true, Url: "https://live.example.com", EventTypes: []string{"*"}},
+			{Id: 2, SourceId: 1, Url: "https://test.example.com", EventTypes: []string{"*"}},
+		},
+	}
+	svc := newTestService(repo)
+
+	if err := svc.Publish(&pb.Event{Id: 1, Type: "charge.succeeded", SourceId: 1}); err != nil {
+		t.Fatalf("Could not publish event: %v", err)
+	}
+
+	if len(repo.deliveries) != 1 || repo.deliveries[0].URL != "https://test.example.com" || repo.deliveries[0].Delivery.Livemode {
+		t.Fatalf("Expected a test mode event to reach the test mode endpoint only, got %v", repo.deliveries)
+	}
+
+	if !strings.Contains(string(repo.deliveries[0].Payload), `"type"`) || strings.Contains(string(repo.deliveries[0].Payload), `"livemode":true`) {
+		t.Errorf("Unexpected payload %s", repo.deliveries[0].Payload)
+	}
+
+	if err := svc.Publish(&pb.Event{Id: 2, Type: "charge.succeeded", SourceId: 1, Livemode: true}); err != nil {
+		t.Fatalf("Could not publish event: %v", err)
+	}
+
+	if len(repo.deliveries) != 2 || repo.deliveries[1].URL != "https://live.example.com" || !strings.Contains(string(repo.deliveries[1].Payload), `"livemode":true`) {
+		t.Fatalf("Expected a live event to reach the live endpoint with livemode set, got %v", repo.deliveries)
+	}
+}
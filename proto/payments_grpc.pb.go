@@ -22,11 +22,39 @@ const (
 	PaymentService_GetPublishableKey_FullMethodName               = "/payments.PaymentService/GetPublishableKey"
 	PaymentService_CreateCustomer_FullMethodName                  = "/payments.PaymentService/CreateCustomer"
 	PaymentService_GetCustomerById_FullMethodName                 = "/payments.PaymentService/GetCustomerById"
+	PaymentService_UpdateCustomer_FullMethodName                  = "/payments.PaymentService/UpdateCustomer"
+	PaymentService_DeleteCustomer_FullMethodName                  = "/payments.PaymentService/DeleteCustomer"
+	PaymentService_RestoreCustomer_FullMethodName                 = "/payments.PaymentService/RestoreCustomer"
+	PaymentService_ListCustomers_FullMethodName                   = "/payments.PaymentService/ListCustomers"
+	PaymentService_SearchCustomers_FullMethodName                 = "/payments.PaymentService/SearchCustomers"
+	PaymentService_CreateOrganization_FullMethodName              = "/payments.PaymentService/CreateOrganization"
+	PaymentService_GetOrganization_FullMethodName                 = "/payments.PaymentService/GetOrganization"
+	PaymentService_LinkOrganizationAccount_FullMethodName         = "/payments.PaymentService/LinkOrganizationAccount"
+	PaymentService_UnlinkOrganizationAccount_FullMethodName       = "/payments.PaymentService/UnlinkOrganizationAccount"
+	PaymentService_ListOrganizationCharges_FullMethodName         = "/payments.PaymentService/ListOrganizationCharges"
 	PaymentService_AddCustomerPaymentMethod_FullMethodName        = "/payments.PaymentService/AddCustomerPaymentMethod"
+	PaymentService_CreateSetupIntent_FullMethodName               = "/payments.PaymentService/CreateSetupIntent"
+	PaymentService_CompleteSetupIntent_FullMethodName             = "/payments.PaymentService/CompleteSetupIntent"
 	PaymentService_RemoveCustomerPaymentMethod_FullMethodName     = "/payments.PaymentService/RemoveCustomerPaymentMethod"
 	PaymentService_SetCustomerPrimaryPaymentMethod_FullMethodName = "/payments.PaymentService/SetCustomerPrimaryPaymentMethod"
+	PaymentService_ListExpiringCards_FullMethodName               = "/payments.PaymentService/ListExpiringCards"
 	PaymentService_CreateCharge_FullMethodName                    = "/payments.PaymentService/CreateCharge"
 	PaymentService_RetrieveCustomerCharges_FullMethodName         = "/payments.PaymentService/RetrieveCustomerCharges"
+	PaymentService_WatchCharges_FullMethodName                    = "/payments.PaymentService/WatchCharges"
+	PaymentService_GetCharge_FullMethodName                       = "/payments.PaymentService/GetCharge"
+	PaymentService_UpdateCharge_FullMethodName                    = "/payments.PaymentService/UpdateCharge"
+	PaymentService_ListReviews_FullMethodName                     = "/payments.PaymentService/ListReviews"
+	PaymentService_ApproveReview_FullMethodName                   = "/payments.PaymentService/ApproveReview"
+	PaymentService_RejectReview_FullMethodName                    = "/payments.PaymentService/RejectReview"
+	PaymentService_CreateBlocklistEntry_FullMethodName            = "/payments.PaymentService/CreateBlocklistEntry"
+	PaymentService_ListBlocklistEntries_FullMethodName            = "/payments.PaymentService/ListBlocklistEntries"
+	PaymentService_UpdateBlocklistEntry_FullMethodName            = "/payments.PaymentService/UpdateBlocklistEntry"
+	PaymentService_DeleteBlocklistEntry_FullMethodName            = "/payments.PaymentService/DeleteBlocklistEntry"
+	PaymentService_CreateWebhookEndpoint_FullMethodName           = "/payments.PaymentService/CreateWebhookEndpoint"
+	PaymentService_ListWebhookEndpoints_FullMethodName            = "/payments.PaymentService/ListWebhookEndpoints"
+	PaymentService_DeleteWebhookEndpoint_FullMethodName           = "/payments.PaymentService/DeleteWebhookEndpoint"
+	PaymentService_ListWebhookDeliveries_FullMethodName           = "/payments.PaymentService/ListWebhookDeliveries"
+	PaymentService_RedeliverWebhook_FullMethodName                = "/payments.PaymentService/RedeliverWebhook"
 )
 
 // PaymentServiceClient is the client API for PaymentService service.
@@ -36,11 +64,39 @@ type PaymentServiceClient interface {
 	GetPublishableKey(ctx context.Context, in *GetPublishableKeyRequest, opts ...grpc.CallOption) (*GetPublishableKeyResponse, error)
 	CreateCustomer(ctx context.Context, in *CreateCustomerRequest, opts ...grpc.CallOption) (*CreateCustomerResponse, error)
 	GetCustomerById(ctx context.Context, in *GetCustomerByIdRequest, opts ...grpc.CallOption) (*GetCustomerByIdResponse, error)
+	UpdateCustomer(ctx context.Context, in *UpdateCustomerRequest, opts ...grpc.CallOption) (*UpdateCustomerResponse, error)
+	DeleteCustomer(ctx context.Context, in *DeleteCustomerRequest, opts ...grpc.CallOption) (*DeleteCustomerResponse, error)
+	RestoreCustomer(ctx context.Context, in *RestoreCustomerRequest, opts ...grpc.CallOption) (*RestoreCustomerResponse, error)
+	ListCustomers(ctx context.Context, in *ListCustomersRequest, opts ...grpc.CallOption) (*ListCustomersResponse, error)
+	SearchCustomers(ctx context.Context, in *SearchCustomersRequest, opts ...grpc.CallOption) (*SearchCustomersResponse, error)
+	CreateOrganization(ctx context.Context, in *CreateOrganizationRequest, opts ...grpc.CallOption) (*CreateOrganizationResponse, error)
+	GetOrganization(ctx context.Context, in *GetOrganizationRequest, opts ...grpc.CallOption) (*GetOrganizationResponse, error)
+	LinkOrganizationAccount(ctx context.Context, in *LinkOrganizationAccountRequest, opts ...grpc.CallOption) (*LinkOrganizationAccountResponse, error)
+	UnlinkOrganizationAccount(ctx context.Context, in *UnlinkOrganizationAccountRequest, opts ...grpc.CallOption) (*UnlinkOrganizationAccountResponse, error)
+	ListOrganizationCharges(ctx context.Context, in *ListOrganizationChargesRequest, opts ...grpc.CallOption) (*ListOrganizationChargesResponse, error)
 	AddCustomerPaymentMethod(ctx context.Context, in *AddCustomerPaymentMethodRequest, opts ...grpc.CallOption) (*AddCustomerPaymentMethodResponse, error)
+	CreateSetupIntent(ctx context.Context, in *CreateSetupIntentRequest, opts ...grpc.CallOption) (*CreateSetupIntentResponse, error)
+	CompleteSetupIntent(ctx context.Context, in *CompleteSetupIntentRequest, opts ...grpc.CallOption) (*CompleteSetupIntentResponse, error)
 	RemoveCustomerPaymentMethod(ctx context.Context, in *RemoveCustomerPaymentMethodRequest, opts ...grpc.CallOption) (*RemoveCustomerPaymentMethodResponse, error)
 	SetCustomerPrimaryPaymentMethod(ctx context.Context, in *SetCustomerPrimaryPaymentMethodRequest, opts ...grpc.CallOption) (*SetCustomerPrimaryPaymentMethodResponse, error)
+	ListExpiringCards(ctx context.Context, in *ListExpiringCardsRequest, opts ...grpc.CallOption) (*ListExpiringCardsResponse, error)
 	CreateCharge(ctx context.Context, in *CreateChargeRequest, opts ...grpc.CallOption) (*CreateChargeResponse, error)
 	RetrieveCustomerCharges(ctx context.Context, in *RetrieveCustomerChargesRequest, opts ...grpc.CallOption) (*RetrieveCustomerChargesResponse, error)
+	WatchCharges(ctx context.Context, in *WatchChargesRequest, opts ...grpc.CallOption) (PaymentService_WatchChargesClient, error)
+	GetCharge(ctx context.Context, in *GetChargeRequest, opts ...grpc.CallOption) (*GetChargeResponse, error)
+	UpdateCharge(ctx context.Context, in *UpdateChargeRequest, opts ...grpc.CallOption) (*UpdateChargeResponse, error)
+	ListReviews(ctx context.Context, in *ListReviewsRequest, opts ...grpc.CallOption) (*ListReviewsResponse, error)
+	ApproveReview(ctx context.Context, in *ApproveReviewRequest, opts ...grpc.CallOption) (*ApproveReviewResponse, error)
+	RejectReview(ctx context.Context, in *RejectReviewRequest, opts ...grpc.CallOption) (*RejectReviewResponse, error)
+	CreateBlocklistEntry(ctx context.Context, in *CreateBlocklistEntryRequest, opts ...grpc.CallOption) (*CreateBlocklistEntryResponse, error)
+	ListBlocklistEntries(ctx context.Context, in *ListBlocklistEntriesRequest, opts ...grpc.CallOption) (*ListBlocklistEntriesResponse, error)
+	UpdateBlocklistEntry(ctx context.Context, in *UpdateBlocklistEntryRequest, opts ...grpc.CallOption) (*UpdateBlocklistEntryResponse, error)
+	DeleteBlocklistEntry(ctx context.Context, in *DeleteBlocklistEntryRequest, opts ...grpc.CallOption) (*DeleteBlocklistEntryResponse, error)
+	CreateWebhookEndpoint(ctx context.Context, in *CreateWebhookEndpointRequest, opts ...grpc.CallOption) (*CreateWebhookEndpointResponse, error)
+	ListWebhookEndpoints(ctx context.Context, in *ListWebhookEndpointsRequest, opts ...grpc.CallOption) (*ListWebhookEndpointsResponse, error)
+	DeleteWebhookEndpoint(ctx context.Context, in *DeleteWebhookEndpointRequest, opts ...grpc.CallOption) (*DeleteWebhookEndpointResponse, error)
+	ListWebhookDeliveries(ctx context.Context, in *ListWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ListWebhookDeliveriesResponse, error)
+	RedeliverWebhook(ctx context.Context, in *RedeliverWebhookRequest, opts ...grpc.CallOption) (*RedeliverWebhookResponse, error)
 }
 
 type paymentServiceClient struct {
@@ -78,6 +134,96 @@ func (c *paymentServiceClient) GetCustomerById(ctx context.Context, in *GetCusto
 	return out, nil
 }
 
+func (c *paymentServiceClient) UpdateCustomer(ctx context.Context, in *UpdateCustomerRequest, opts ...grpc.CallOption) (*UpdateCustomerResponse, error) {
+	out := new(UpdateCustomerResponse)
+	err := c.cc.Invoke(ctx, PaymentService_UpdateCustomer_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) DeleteCustomer(ctx context.Context, in *DeleteCustomerRequest, opts ...grpc.CallOption) (*DeleteCustomerResponse, error) {
+	out := new(DeleteCustomerResponse)
+	err := c.cc.Invoke(ctx, PaymentService_DeleteCustomer_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) RestoreCustomer(ctx context.Context, in *RestoreCustomerRequest, opts ...grpc.CallOption) (*RestoreCustomerResponse, error) {
+	out := new(RestoreCustomerResponse)
+	err := c.cc.Invoke(ctx, PaymentService_RestoreCustomer_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) ListCustomers(ctx context.Context, in *ListCustomersRequest, opts ...grpc.CallOption) (*ListCustomersResponse, error) {
+	out := new(ListCustomersResponse)
+	err := c.cc.Invoke(ctx, PaymentService_ListCustomers_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) SearchCustomers(ctx context.Context, in *SearchCustomersRequest, opts ...grpc.CallOption) (*SearchCustomersResponse, error) {
+	out := new(SearchCustomersResponse)
+	err := c.cc.Invoke(ctx, PaymentService_SearchCustomers_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) CreateOrganization(ctx context.Context, in *CreateOrganizationRequest, opts ...grpc.CallOption) (*CreateOrganizationResponse, error) {
+	out := new(CreateOrganizationResponse)
+	err := c.cc.Invoke(ctx, PaymentService_CreateOrganization_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) GetOrganization(ctx context.Context, in *GetOrganizationRequest, opts ...grpc.CallOption) (*GetOrganizationResponse, error) {
+	out := new(GetOrganizationResponse)
+	err := c.cc.Invoke(ctx, PaymentService_GetOrganization_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) LinkOrganizationAccount(ctx context.Context, in *LinkOrganizationAccountRequest, opts ...grpc.CallOption) (*LinkOrganizationAccountResponse, error) {
+	out := new(LinkOrganizationAccountResponse)
+	err := c.cc.Invoke(ctx, PaymentService_LinkOrganizationAccount_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) UnlinkOrganizationAccount(ctx context.Context, in *UnlinkOrganizationAccountRequest, opts ...grpc.CallOption) (*UnlinkOrganizationAccountResponse, error) {
+	out := new(UnlinkOrganizationAccountResponse)
+	err := c.cc.Invoke(ctx, PaymentService_UnlinkOrganizationAccount_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) ListOrganizationCharges(ctx context.Context, in *ListOrganizationChargesRequest, opts ...grpc.CallOption) (*ListOrganizationChargesResponse, error) {
+	out := new(ListOrganizationChargesResponse)
+	err := c.cc.Invoke(ctx, PaymentService_ListOrganizationCharges_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *paymentServiceClient) AddCustomerPaymentMethod(ctx context.Context, in *AddCustomerPaymentMethodRequest, opts ...grpc.CallOption) (*AddCustomerPaymentMethodResponse, error) {
 	out := new(AddCustomerPaymentMethodResponse)
 	err := c.cc.Invoke(ctx, PaymentService_AddCustomerPaymentMethod_FullMethodName, in, out, opts...)
@@ -87,6 +233,24 @@ func (c *paymentServiceClient) AddCustomerPaymentMethod(ctx context.Context, in
 	return out, nil
 }
 
+func (c *paymentServiceClient) CreateSetupIntent(ctx context.Context, in *CreateSetupIntentRequest, opts ...grpc.CallOption) (*CreateSetupIntentResponse, error) {
+	out := new(CreateSetupIntentResponse)
+	err := c.cc.Invoke(ctx, PaymentService_CreateSetupIntent_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) CompleteSetupIntent(ctx context.Context, in *CompleteSetupIntentRequest, opts ...grpc.CallOption) (*CompleteSetupIntentResponse, error) {
+	out := new(CompleteSetupIntentResponse)
+	err := c.cc.Invoke(ctx, PaymentService_CompleteSetupIntent_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *paymentServiceClient) RemoveCustomerPaymentMethod(ctx context.Context, in *RemoveCustomerPaymentMethodRequest, opts ...grpc.CallOption) (*RemoveCustomerPaymentMethodResponse, error) {
 	out := new(RemoveCustomerPaymentMethodResponse)
 	err := c.cc.Invoke(ctx, PaymentService_RemoveCustomerPaymentMethod_FullMethodName, in, out, opts...)
@@ -105,6 +269,15 @@ func (c *paymentServiceClient) SetCustomerPrimaryPaymentMethod(ctx context.Conte
 	return out, nil
 }
 
+func (c *paymentServiceClient) ListExpiringCards(ctx context.Context, in *ListExpiringCardsRequest, opts ...grpc.CallOption) (*ListExpiringCardsResponse, error) {
+	out := new(ListExpiringCardsResponse)
+	err := c.cc.Invoke(ctx, PaymentService_ListExpiringCards_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *paymentServiceClient) CreateCharge(ctx context.Context, in *CreateChargeRequest, opts ...grpc.CallOption) (*CreateChargeResponse, error) {
 	out := new(CreateChargeResponse)
 	err := c.cc.Invoke(ctx, PaymentService_CreateCharge_FullMethodName, in, out, opts...)
@@ -123,6 +296,164 @@ func (c *paymentServiceClient) RetrieveCustomerCharges(ctx context.Context, in *
 	return out, nil
 }
 
+func (c *paymentServiceClient) WatchCharges(ctx context.Context, in *WatchChargesRequest, opts ...grpc.CallOption) (PaymentService_WatchChargesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &PaymentService_ServiceDesc.Streams[0], PaymentService_WatchCharges_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &paymentServiceWatchChargesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type PaymentService_WatchChargesClient interface {
+	Recv() (*WatchChargesResponse, error)
+	grpc.ClientStream
+}
+
+type paymentServiceWatchChargesClient struct {
+	grpc.ClientStream
+}
+
+func (x *paymentServiceWatchChargesClient) Recv() (*WatchChargesResponse, error) {
+	m := new(WatchChargesResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *paymentServiceClient) GetCharge(ctx context.Context, in *GetChargeRequest, opts ...grpc.CallOption) (*GetChargeResponse, error) {
+	out := new(GetChargeResponse)
+	err := c.cc.Invoke(ctx, PaymentService_GetCharge_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) UpdateCharge(ctx context.Context, in *UpdateChargeRequest, opts ...grpc.CallOption) (*UpdateChargeResponse, error) {
+	out := new(UpdateChargeResponse)
+	err := c.cc.Invoke(ctx, PaymentService_UpdateCharge_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) ListReviews(ctx context.Context, in *ListReviewsRequest, opts ...grpc.CallOption) (*ListReviewsResponse, error) {
+	out := new(ListReviewsResponse)
+	err := c.cc.Invoke(ctx, PaymentService_ListReviews_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) ApproveReview(ctx context.Context, in *ApproveReviewRequest, opts ...grpc.CallOption) (*ApproveReviewResponse, error) {
+	out := new(ApproveReviewResponse)
+	err := c.cc.Invoke(ctx, PaymentService_ApproveReview_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) RejectReview(ctx context.Context, in *RejectReviewRequest, opts ...grpc.CallOption) (*RejectReviewResponse, error) {
+	out := new(RejectReviewResponse)
+	err := c.cc.Invoke(ctx, PaymentService_RejectReview_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) CreateBlocklistEntry(ctx context.Context, in *CreateBlocklistEntryRequest, opts ...grpc.CallOption) (*CreateBlocklistEntryResponse, error) {
+	out := new(CreateBlocklistEntryResponse)
+	err := c.cc.Invoke(ctx, PaymentService_CreateBlocklistEntry_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) ListBlocklistEntries(ctx context.Context, in *ListBlocklistEntriesRequest, opts ...grpc.CallOption) (*ListBlocklistEntriesResponse, error) {
+	out := new(ListBlocklistEntriesResponse)
+	err := c.cc.Invoke(ctx, PaymentService_ListBlocklistEntries_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) UpdateBlocklistEntry(ctx context.Context, in *UpdateBlocklistEntryRequest, opts ...grpc.CallOption) (*UpdateBlocklistEntryResponse, error) {
+	out := new(UpdateBlocklistEntryResponse)
+	err := c.cc.Invoke(ctx, PaymentService_UpdateBlocklistEntry_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) DeleteBlocklistEntry(ctx context.Context, in *DeleteBlocklistEntryRequest, opts ...grpc.CallOption) (*DeleteBlocklistEntryResponse, error) {
+	out := new(DeleteBlocklistEntryResponse)
+	err := c.cc.Invoke(ctx, PaymentService_DeleteBlocklistEntry_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) CreateWebhookEndpoint(ctx context.Context, in *CreateWebhookEndpointRequest, opts ...grpc.CallOption) (*CreateWebhookEndpointResponse, error) {
+	out := new(CreateWebhookEndpointResponse)
+	err := c.cc.Invoke(ctx, PaymentService_CreateWebhookEndpoint_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) ListWebhookEndpoints(ctx context.Context, in *ListWebhookEndpointsRequest, opts ...grpc.CallOption) (*ListWebhookEndpointsResponse, error) {
+	out := new(ListWebhookEndpointsResponse)
+	err := c.cc.Invoke(ctx, PaymentService_ListWebhookEndpoints_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) DeleteWebhookEndpoint(ctx context.Context, in *DeleteWebhookEndpointRequest, opts ...grpc.CallOption) (*DeleteWebhookEndpointResponse, error) {
+	out := new(DeleteWebhookEndpointResponse)
+	err := c.cc.Invoke(ctx, PaymentService_DeleteWebhookEndpoint_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) ListWebhookDeliveries(ctx context.Context, in *ListWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ListWebhookDeliveriesResponse, error) {
+	out := new(ListWebhookDeliveriesResponse)
+	err := c.cc.Invoke(ctx, PaymentService_ListWebhookDeliveries_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentServiceClient) RedeliverWebhook(ctx context.Context, in *RedeliverWebhookRequest, opts ...grpc.CallOption) (*RedeliverWebhookResponse, error) {
+	out := new(RedeliverWebhookResponse)
+	err := c.cc.Invoke(ctx, PaymentService_RedeliverWebhook_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PaymentServiceServer is the server API for PaymentService service.
 // All implementations must embed UnimplementedPaymentServiceServer
 // for forward compatibility
@@ -130,11 +461,39 @@ type PaymentServiceServer interface {
 	GetPublishableKey(context.Context, *GetPublishableKeyRequest) (*GetPublishableKeyResponse, error)
 	CreateCustomer(context.Context, *CreateCustomerRequest) (*CreateCustomerResponse, error)
 	GetCustomerById(context.Context, *GetCustomerByIdRequest) (*GetCustomerByIdResponse, error)
+	UpdateCustomer(context.Context, *UpdateCustomerRequest) (*UpdateCustomerResponse, error)
+	DeleteCustomer(context.Context, *DeleteCustomerRequest) (*DeleteCustomerResponse, error)
+	RestoreCustomer(context.Context, *RestoreCustomerRequest) (*RestoreCustomerResponse, error)
+	ListCustomers(context.Context, *ListCustomersRequest) (*ListCustomersResponse, error)
+	SearchCustomers(context.Context, *SearchCustomersRequest) (*SearchCustomersResponse, error)
+	CreateOrganization(context.Context, *CreateOrganizationRequest) (*CreateOrganizationResponse, error)
+	GetOrganization(context.Context, *GetOrganizationRequest) (*GetOrganizationResponse, error)
+	LinkOrganizationAccount(context.Context, *LinkOrganizationAccountRequest) (*LinkOrganizationAccountResponse, error)
+	UnlinkOrganizationAccount(context.Context, *UnlinkOrganizationAccountRequest) (*UnlinkOrganizationAccountResponse, error)
+	ListOrganizationCharges(context.Context, *ListOrganizationChargesRequest) (*ListOrganizationChargesResponse, error)
 	AddCustomerPaymentMethod(context.Context, *AddCustomerPaymentMethodRequest) (*AddCustomerPaymentMethodResponse, error)
+	CreateSetupIntent(context.Context, *CreateSetupIntentRequest) (*CreateSetupIntentResponse, error)
+	CompleteSetupIntent(context.Context, *CompleteSetupIntentRequest) (*CompleteSetupIntentResponse, error)
 	RemoveCustomerPaymentMethod(context.Context, *RemoveCustomerPaymentMethodRequest) (*RemoveCustomerPaymentMethodResponse, error)
 	SetCustomerPrimaryPaymentMethod(context.Context, *SetCustomerPrimaryPaymentMethodRequest) (*SetCustomerPrimaryPaymentMethodResponse, error)
+	ListExpiringCards(context.Context, *ListExpiringCardsRequest) (*ListExpiringCardsResponse, error)
 	CreateCharge(context.Context, *CreateChargeRequest) (*CreateChargeResponse, error)
 	RetrieveCustomerCharges(context.Context, *RetrieveCustomerChargesRequest) (*RetrieveCustomerChargesResponse, error)
+	WatchCharges(*WatchChargesRequest, PaymentService_WatchChargesServer) error
+	GetCharge(context.Context, *GetChargeRequest) (*GetChargeResponse, error)
+	UpdateCharge(context.Context, *UpdateChargeRequest) (*UpdateChargeResponse, error)
+	ListReviews(context.Context, *ListReviewsRequest) (*ListReviewsResponse, error)
+	ApproveReview(context.Context, *ApproveReviewRequest) (*ApproveReviewResponse, error)
+	RejectReview(context.Context, *RejectReviewRequest) (*RejectReviewResponse, error)
+	CreateBlocklistEntry(context.Context, *CreateBlocklistEntryRequest) (*CreateBlocklistEntryResponse, error)
+	ListBlocklistEntries(context.Context, *ListBlocklistEntriesRequest) (*ListBlocklistEntriesResponse, error)
+	UpdateBlocklistEntry(context.Context, *UpdateBlocklistEntryRequest) (*UpdateBlocklistEntryResponse, error)
+	DeleteBlocklistEntry(context.Context, *DeleteBlocklistEntryRequest) (*DeleteBlocklistEntryResponse, error)
+	CreateWebhookEndpoint(context.Context, *CreateWebhookEndpointRequest) (*CreateWebhookEndpointResponse, error)
+	ListWebhookEndpoints(context.Context, *ListWebhookEndpointsRequest) (*ListWebhookEndpointsResponse, error)
+	DeleteWebhookEndpoint(context.Context, *DeleteWebhookEndpointRequest) (*DeleteWebhookEndpointResponse, error)
+	ListWebhookDeliveries(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesResponse, error)
+	RedeliverWebhook(context.Context, *RedeliverWebhookRequest) (*RedeliverWebhookResponse, error)
 	mustEmbedUnimplementedPaymentServiceServer()
 }
 
@@ -151,21 +510,105 @@ func (UnimplementedPaymentServiceServer) CreateCustomer(context.Context, *Create
 func (UnimplementedPaymentServiceServer) GetCustomerById(context.Context, *GetCustomerByIdRequest) (*GetCustomerByIdResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetCustomerById not implemented")
 }
+func (UnimplementedPaymentServiceServer) UpdateCustomer(context.Context, *UpdateCustomerRequest) (*UpdateCustomerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateCustomer not implemented")
+}
+func (UnimplementedPaymentServiceServer) DeleteCustomer(context.Context, *DeleteCustomerRequest) (*DeleteCustomerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteCustomer not implemented")
+}
+func (UnimplementedPaymentServiceServer) RestoreCustomer(context.Context, *RestoreCustomerRequest) (*RestoreCustomerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreCustomer not implemented")
+}
+func (UnimplementedPaymentServiceServer) ListCustomers(context.Context, *ListCustomersRequest) (*ListCustomersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListCustomers not implemented")
+}
+func (UnimplementedPaymentServiceServer) SearchCustomers(context.Context, *SearchCustomersRequest) (*SearchCustomersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchCustomers not implemented")
+}
+func (UnimplementedPaymentServiceServer) CreateOrganization(context.Context, *CreateOrganizationRequest) (*CreateOrganizationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateOrganization not implemented")
+}
+func (UnimplementedPaymentServiceServer) GetOrganization(context.Context, *GetOrganizationRequest) (*GetOrganizationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOrganization not implemented")
+}
+func (UnimplementedPaymentServiceServer) LinkOrganizationAccount(context.Context, *LinkOrganizationAccountRequest) (*LinkOrganizationAccountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LinkOrganizationAccount not implemented")
+}
+func (UnimplementedPaymentServiceServer) UnlinkOrganizationAccount(context.Context, *UnlinkOrganizationAccountRequest) (*UnlinkOrganizationAccountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnlinkOrganizationAccount not implemented")
+}
+func (UnimplementedPaymentServiceServer) ListOrganizationCharges(context.Context, *ListOrganizationChargesRequest) (*ListOrganizationChargesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListOrganizationCharges not implemented")
+}
 func (UnimplementedPaymentServiceServer) AddCustomerPaymentMethod(context.Context, *AddCustomerPaymentMethodRequest) (*AddCustomerPaymentMethodResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method AddCustomerPaymentMethod not implemented")
 }
+func (UnimplementedPaymentServiceServer) CreateSetupIntent(context.Context, *CreateSetupIntentRequest) (*CreateSetupIntentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSetupIntent not implemented")
+}
+func (UnimplementedPaymentServiceServer) CompleteSetupIntent(context.Context, *CompleteSetupIntentRequest) (*CompleteSetupIntentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CompleteSetupIntent not implemented")
+}
 func (UnimplementedPaymentServiceServer) RemoveCustomerPaymentMethod(context.Context, *RemoveCustomerPaymentMethodRequest) (*RemoveCustomerPaymentMethodResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RemoveCustomerPaymentMethod not implemented")
 }
 func (UnimplementedPaymentServiceServer) SetCustomerPrimaryPaymentMethod(context.Context, *SetCustomerPrimaryPaymentMethodRequest) (*SetCustomerPrimaryPaymentMethodResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SetCustomerPrimaryPaymentMethod not implemented")
 }
+func (UnimplementedPaymentServiceServer) ListExpiringCards(context.Context, *ListExpiringCardsRequest) (*ListExpiringCardsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListExpiringCards not implemented")
+}
 func (UnimplementedPaymentServiceServer) CreateCharge(context.Context, *CreateChargeRequest) (*CreateChargeResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateCharge not implemented")
 }
 func (UnimplementedPaymentServiceServer) RetrieveCustomerCharges(context.Context, *RetrieveCustomerChargesRequest) (*RetrieveCustomerChargesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RetrieveCustomerCharges not implemented")
 }
+func (UnimplementedPaymentServiceServer) WatchCharges(*WatchChargesRequest, PaymentService_WatchChargesServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchCharges not implemented")
+}
+func (UnimplementedPaymentServiceServer) GetCharge(context.Context, *GetChargeRequest) (*GetChargeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCharge not implemented")
+}
+func (UnimplementedPaymentServiceServer) UpdateCharge(context.Context, *UpdateChargeRequest) (*UpdateChargeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateCharge not implemented")
+}
+func (UnimplementedPaymentServiceServer) ListReviews(context.Context, *ListReviewsRequest) (*ListReviewsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListReviews not implemented")
+}
+func (UnimplementedPaymentServiceServer) ApproveReview(context.Context, *ApproveReviewRequest) (*ApproveReviewResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ApproveReview not implemented")
+}
+func (UnimplementedPaymentServiceServer) RejectReview(context.Context, *RejectReviewRequest) (*RejectReviewResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RejectReview not implemented")
+}
+func (UnimplementedPaymentServiceServer) CreateBlocklistEntry(context.Context, *CreateBlocklistEntryRequest) (*CreateBlocklistEntryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateBlocklistEntry not implemented")
+}
+func (UnimplementedPaymentServiceServer) ListBlocklistEntries(context.Context, *ListBlocklistEntriesRequest) (*ListBlocklistEntriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBlocklistEntries not implemented")
+}
+func (UnimplementedPaymentServiceServer) UpdateBlocklistEntry(context.Context, *UpdateBlocklistEntryRequest) (*UpdateBlocklistEntryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateBlocklistEntry not implemented")
+}
+func (UnimplementedPaymentServiceServer) DeleteBlocklistEntry(context.Context, *DeleteBlocklistEntryRequest) (*DeleteBlocklistEntryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteBlocklistEntry not implemented")
+}
+func (UnimplementedPaymentServiceServer) CreateWebhookEndpoint(context.Context, *CreateWebhookEndpointRequest) (*CreateWebhookEndpointResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateWebhookEndpoint not implemented")
+}
+func (UnimplementedPaymentServiceServer) ListWebhookEndpoints(context.Context, *ListWebhookEndpointsRequest) (*ListWebhookEndpointsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWebhookEndpoints not implemented")
+}
+func (UnimplementedPaymentServiceServer) DeleteWebhookEndpoint(context.Context, *DeleteWebhookEndpointRequest) (*DeleteWebhookEndpointResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteWebhookEndpoint not implemented")
+}
+func (UnimplementedPaymentServiceServer) ListWebhookDeliveries(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWebhookDeliveries not implemented")
+}
+func (UnimplementedPaymentServiceServer) RedeliverWebhook(context.Context, *RedeliverWebhookRequest) (*RedeliverWebhookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RedeliverWebhook not implemented")
+}
 func (UnimplementedPaymentServiceServer) mustEmbedUnimplementedPaymentServiceServer() {}
 
 // UnsafePaymentServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -233,120 +676,675 @@ func _PaymentService_GetCustomerById_Handler(srv interface{}, ctx context.Contex
 	return interceptor(ctx, in, info, handler)
 }
 
-func _PaymentService_AddCustomerPaymentMethod_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(AddCustomerPaymentMethodRequest)
+func _PaymentService_UpdateCustomer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateCustomerRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(PaymentServiceServer).AddCustomerPaymentMethod(ctx, in)
+		return srv.(PaymentServiceServer).UpdateCustomer(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: PaymentService_AddCustomerPaymentMethod_FullMethodName,
+		FullMethod: PaymentService_UpdateCustomer_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(PaymentServiceServer).AddCustomerPaymentMethod(ctx, req.(*AddCustomerPaymentMethodRequest))
+		return srv.(PaymentServiceServer).UpdateCustomer(ctx, req.(*UpdateCustomerRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _PaymentService_RemoveCustomerPaymentMethod_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(RemoveCustomerPaymentMethodRequest)
+func _PaymentService_DeleteCustomer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteCustomerRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(PaymentServiceServer).RemoveCustomerPaymentMethod(ctx, in)
+		return srv.(PaymentServiceServer).DeleteCustomer(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: PaymentService_RemoveCustomerPaymentMethod_FullMethodName,
+		FullMethod: PaymentService_DeleteCustomer_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(PaymentServiceServer).RemoveCustomerPaymentMethod(ctx, req.(*RemoveCustomerPaymentMethodRequest))
+		return srv.(PaymentServiceServer).DeleteCustomer(ctx, req.(*DeleteCustomerRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _PaymentService_SetCustomerPrimaryPaymentMethod_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(SetCustomerPrimaryPaymentMethodRequest)
+func _PaymentService_RestoreCustomer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreCustomerRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(PaymentServiceServer).SetCustomerPrimaryPaymentMethod(ctx, in)
+		return srv.(PaymentServiceServer).RestoreCustomer(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: PaymentService_SetCustomerPrimaryPaymentMethod_FullMethodName,
+		FullMethod: PaymentService_RestoreCustomer_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(PaymentServiceServer).SetCustomerPrimaryPaymentMethod(ctx, req.(*SetCustomerPrimaryPaymentMethodRequest))
+		return srv.(PaymentServiceServer).RestoreCustomer(ctx, req.(*RestoreCustomerRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _PaymentService_CreateCharge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(CreateChargeRequest)
+func _PaymentService_ListCustomers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCustomersRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(PaymentServiceServer).CreateCharge(ctx, in)
+		return srv.(PaymentServiceServer).ListCustomers(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: PaymentService_CreateCharge_FullMethodName,
+		FullMethod: PaymentService_ListCustomers_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(PaymentServiceServer).CreateCharge(ctx, req.(*CreateChargeRequest))
+		return srv.(PaymentServiceServer).ListCustomers(ctx, req.(*ListCustomersRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _PaymentService_RetrieveCustomerCharges_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(RetrieveCustomerChargesRequest)
+func _PaymentService_SearchCustomers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchCustomersRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(PaymentServiceServer).RetrieveCustomerCharges(ctx, in)
+		return srv.(PaymentServiceServer).SearchCustomers(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: PaymentService_RetrieveCustomerCharges_FullMethodName,
+		FullMethod: PaymentService_SearchCustomers_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(PaymentServiceServer).RetrieveCustomerCharges(ctx, req.(*RetrieveCustomerChargesRequest))
+		return srv.(PaymentServiceServer).SearchCustomers(ctx, req.(*SearchCustomersRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-// PaymentService_ServiceDesc is the grpc.ServiceDesc for PaymentService service.
-// It's only intended for direct use with grpc.RegisterService,
-// and not to be introspected or modified (even as a copy)
-var PaymentService_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "payments.PaymentService",
-	HandlerType: (*PaymentServiceServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "GetPublishableKey",
-			Handler:    _PaymentService_GetPublishableKey_Handler,
-		},
-		{
-			MethodName: "CreateCustomer",
-			Handler:    _PaymentService_CreateCustomer_Handler,
-		},
-		{
-			MethodName: "GetCustomerById",
-			Handler:    _PaymentService_GetCustomerById_Handler,
-		},
-		{
-			MethodName: "AddCustomerPaymentMethod",
-			Handler:    _PaymentService_AddCustomerPaymentMethod_Handler,
-		},
-		{
+func _PaymentService_CreateOrganization_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateOrganizationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).CreateOrganization(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_CreateOrganization_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).CreateOrganization(ctx, req.(*CreateOrganizationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_GetOrganization_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOrganizationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).GetOrganization(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_GetOrganization_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).GetOrganization(ctx, req.(*GetOrganizationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_LinkOrganizationAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LinkOrganizationAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).LinkOrganizationAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_LinkOrganizationAccount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).LinkOrganizationAccount(ctx, req.(*LinkOrganizationAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_UnlinkOrganizationAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnlinkOrganizationAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).UnlinkOrganizationAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_UnlinkOrganizationAccount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).UnlinkOrganizationAccount(ctx, req.(*UnlinkOrganizationAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_ListOrganizationCharges_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListOrganizationChargesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).ListOrganizationCharges(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_ListOrganizationCharges_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).ListOrganizationCharges(ctx, req.(*ListOrganizationChargesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_AddCustomerPaymentMethod_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddCustomerPaymentMethodRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).AddCustomerPaymentMethod(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_AddCustomerPaymentMethod_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).AddCustomerPaymentMethod(ctx, req.(*AddCustomerPaymentMethodRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_CreateSetupIntent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateSetupIntentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).CreateSetupIntent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_CreateSetupIntent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).CreateSetupIntent(ctx, req.(*CreateSetupIntentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_CompleteSetupIntent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompleteSetupIntentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).CompleteSetupIntent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_CompleteSetupIntent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).CompleteSetupIntent(ctx, req.(*CompleteSetupIntentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_RemoveCustomerPaymentMethod_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveCustomerPaymentMethodRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).RemoveCustomerPaymentMethod(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_RemoveCustomerPaymentMethod_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).RemoveCustomerPaymentMethod(ctx, req.(*RemoveCustomerPaymentMethodRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_SetCustomerPrimaryPaymentMethod_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetCustomerPrimaryPaymentMethodRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).SetCustomerPrimaryPaymentMethod(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_SetCustomerPrimaryPaymentMethod_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).SetCustomerPrimaryPaymentMethod(ctx, req.(*SetCustomerPrimaryPaymentMethodRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_ListExpiringCards_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListExpiringCardsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).ListExpiringCards(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_ListExpiringCards_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).ListExpiringCards(ctx, req.(*ListExpiringCardsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_CreateCharge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateChargeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).CreateCharge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_CreateCharge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).CreateCharge(ctx, req.(*CreateChargeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_RetrieveCustomerCharges_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RetrieveCustomerChargesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).RetrieveCustomerCharges(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_RetrieveCustomerCharges_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).RetrieveCustomerCharges(ctx, req.(*RetrieveCustomerChargesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_WatchCharges_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchChargesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PaymentServiceServer).WatchCharges(m, &paymentServiceWatchChargesServer{stream})
+}
+
+type PaymentService_WatchChargesServer interface {
+	Send(*WatchChargesResponse) error
+	grpc.ServerStream
+}
+
+type paymentServiceWatchChargesServer struct {
+	grpc.ServerStream
+}
+
+func (x *paymentServiceWatchChargesServer) Send(m *WatchChargesResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _PaymentService_GetCharge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetChargeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).GetCharge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_GetCharge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).GetCharge(ctx, req.(*GetChargeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_UpdateCharge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateChargeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).UpdateCharge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_UpdateCharge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).UpdateCharge(ctx, req.(*UpdateChargeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_ListReviews_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListReviewsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).ListReviews(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_ListReviews_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).ListReviews(ctx, req.(*ListReviewsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_ApproveReview_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ApproveReviewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).ApproveReview(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_ApproveReview_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).ApproveReview(ctx, req.(*ApproveReviewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_RejectReview_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RejectReviewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).RejectReview(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_RejectReview_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).RejectReview(ctx, req.(*RejectReviewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_CreateBlocklistEntry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateBlocklistEntryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).CreateBlocklistEntry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_CreateBlocklistEntry_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).CreateBlocklistEntry(ctx, req.(*CreateBlocklistEntryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_ListBlocklistEntries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBlocklistEntriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).ListBlocklistEntries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_ListBlocklistEntries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).ListBlocklistEntries(ctx, req.(*ListBlocklistEntriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_UpdateBlocklistEntry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateBlocklistEntryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).UpdateBlocklistEntry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_UpdateBlocklistEntry_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).UpdateBlocklistEntry(ctx, req.(*UpdateBlocklistEntryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_DeleteBlocklistEntry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteBlocklistEntryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).DeleteBlocklistEntry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_DeleteBlocklistEntry_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).DeleteBlocklistEntry(ctx, req.(*DeleteBlocklistEntryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_CreateWebhookEndpoint_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateWebhookEndpointRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).CreateWebhookEndpoint(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_CreateWebhookEndpoint_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).CreateWebhookEndpoint(ctx, req.(*CreateWebhookEndpointRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_ListWebhookEndpoints_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWebhookEndpointsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).ListWebhookEndpoints(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_ListWebhookEndpoints_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).ListWebhookEndpoints(ctx, req.(*ListWebhookEndpointsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_DeleteWebhookEndpoint_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteWebhookEndpointRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).DeleteWebhookEndpoint(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_DeleteWebhookEndpoint_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).DeleteWebhookEndpoint(ctx, req.(*DeleteWebhookEndpointRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_ListWebhookDeliveries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWebhookDeliveriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).ListWebhookDeliveries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_ListWebhookDeliveries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).ListWebhookDeliveries(ctx, req.(*ListWebhookDeliveriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PaymentService_RedeliverWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RedeliverWebhookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).RedeliverWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_RedeliverWebhook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).RedeliverWebhook(ctx, req.(*RedeliverWebhookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PaymentService_ServiceDesc is the grpc.ServiceDesc for PaymentService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PaymentService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "payments.PaymentService",
+	HandlerType: (*PaymentServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetPublishableKey",
+			Handler:    _PaymentService_GetPublishableKey_Handler,
+		},
+		{
+			MethodName: "CreateCustomer",
+			Handler:    _PaymentService_CreateCustomer_Handler,
+		},
+		{
+			MethodName: "GetCustomerById",
+			Handler:    _PaymentService_GetCustomerById_Handler,
+		},
+		{
+			MethodName: "UpdateCustomer",
+			Handler:    _PaymentService_UpdateCustomer_Handler,
+		},
+		{
+			MethodName: "DeleteCustomer",
+			Handler:    _PaymentService_DeleteCustomer_Handler,
+		},
+		{
+			MethodName: "RestoreCustomer",
+			Handler:    _PaymentService_RestoreCustomer_Handler,
+		},
+		{
+			MethodName: "ListCustomers",
+			Handler:    _PaymentService_ListCustomers_Handler,
+		},
+		{
+			MethodName: "SearchCustomers",
+			Handler:    _PaymentService_SearchCustomers_Handler,
+		},
+		{
+			MethodName: "CreateOrganization",
+			Handler:    _PaymentService_CreateOrganization_Handler,
+		},
+		{
+			MethodName: "GetOrganization",
+			Handler:    _PaymentService_GetOrganization_Handler,
+		},
+		{
+			MethodName: "LinkOrganizationAccount",
+			Handler:    _PaymentService_LinkOrganizationAccount_Handler,
+		},
+		{
+			MethodName: "UnlinkOrganizationAccount",
+			Handler:    _PaymentService_UnlinkOrganizationAccount_Handler,
+		},
+		{
+			MethodName: "ListOrganizationCharges",
+			Handler:    _PaymentService_ListOrganizationCharges_Handler,
+		},
+		{
+			MethodName: "AddCustomerPaymentMethod",
+			Handler:    _PaymentService_AddCustomerPaymentMethod_Handler,
+		},
+		{
+			MethodName: "CreateSetupIntent",
+			Handler:    _PaymentService_CreateSetupIntent_Handler,
+		},
+		{
+			MethodName: "CompleteSetupIntent",
+			Handler:    _PaymentService_CompleteSetupIntent_Handler,
+		},
+		{
 			MethodName: "RemoveCustomerPaymentMethod",
 			Handler:    _PaymentService_RemoveCustomerPaymentMethod_Handler,
 		},
@@ -354,6 +1352,10 @@ var PaymentService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SetCustomerPrimaryPaymentMethod",
 			Handler:    _PaymentService_SetCustomerPrimaryPaymentMethod_Handler,
 		},
+		{
+			MethodName: "ListExpiringCards",
+			Handler:    _PaymentService_ListExpiringCards_Handler,
+		},
 		{
 			MethodName: "CreateCharge",
 			Handler:    _PaymentService_CreateCharge_Handler,
@@ -362,7 +1364,69 @@ var PaymentService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "RetrieveCustomerCharges",
 			Handler:    _PaymentService_RetrieveCustomerCharges_Handler,
 		},
+		{
+			MethodName: "GetCharge",
+			Handler:    _PaymentService_GetCharge_Handler,
+		},
+		{
+			MethodName: "UpdateCharge",
+			Handler:    _PaymentService_UpdateCharge_Handler,
+		},
+		{
+			MethodName: "ListReviews",
+			Handler:    _PaymentService_ListReviews_Handler,
+		},
+		{
+			MethodName: "ApproveReview",
+			Handler:    _PaymentService_ApproveReview_Handler,
+		},
+		{
+			MethodName: "RejectReview",
+			Handler:    _PaymentService_RejectReview_Handler,
+		},
+		{
+			MethodName: "CreateBlocklistEntry",
+			Handler:    _PaymentService_CreateBlocklistEntry_Handler,
+		},
+		{
+			MethodName: "ListBlocklistEntries",
+			Handler:    _PaymentService_ListBlocklistEntries_Handler,
+		},
+		{
+			MethodName: "UpdateBlocklistEntry",
+			Handler:    _PaymentService_UpdateBlocklistEntry_Handler,
+		},
+		{
+			MethodName: "DeleteBlocklistEntry",
+			Handler:    _PaymentService_DeleteBlocklistEntry_Handler,
+		},
+		{
+			MethodName: "CreateWebhookEndpoint",
+			Handler:    _PaymentService_CreateWebhookEndpoint_Handler,
+		},
+		{
+			MethodName: "ListWebhookEndpoints",
+			Handler:    _PaymentService_ListWebhookEndpoints_Handler,
+		},
+		{
+			MethodName: "DeleteWebhookEndpoint",
+			Handler:    _PaymentService_DeleteWebhookEndpoint_Handler,
+		},
+		{
+			MethodName: "ListWebhookDeliveries",
+			Handler:    _PaymentService_ListWebhookDeliveries_Handler,
+		},
+		{
+			MethodName: "RedeliverWebhook",
+			Handler:    _PaymentService_RedeliverWebhook_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchCharges",
+			Handler:       _PaymentService_WatchCharges_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "payments.proto",
 }